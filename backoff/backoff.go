@@ -2,14 +2,21 @@
 // Use of this source code is governed by a MIT-license.
 // See http://olivere.mit-license.org/license.txt for details.
 
+// Package backoff implements backoff algorithms with state, i.e. a
+// Backoff returns the next wait interval on each call to Next.
+//
+// The algorithms themselves are implemented by package elastic, e.g.
+// elastic.ExponentialBackoff and elastic.SimpleBackoff, which are used by
+// both the Client (via elastic.SetRetrier) and the BulkProcessor. The types
+// in this package only keep track of the number of retries. New code should
+// use the algorithms of package elastic directly.
 package backoff
 
 import (
-	"math"
-	"math/rand"
 	"sync"
-	"sync/atomic"
 	"time"
+
+	"gopkg.in/olivere/elastic.v2"
 )
 
 // Backoff is an interface for different types of backoff algorithms.
@@ -27,30 +34,28 @@ const Stop time.Duration = -1
 // Each call to Next returns the next value from that fixed list.
 // After each value is returned, subsequent calls to Next will only return
 // the last element. The caller may specify if the values are "jittered".
+//
+// SimpleBackoff uses elastic.SimpleBackoff to compute the intervals.
 type SimpleBackoff struct {
 	sync.Mutex
-	ticks  []int
-	index  int
-	jitter bool
-	stop   bool
+	b     *elastic.SimpleBackoff
+	n     int // number of ticks
+	retry int
+	stop  bool
 }
 
 // NewSimpleBackoff creates a SimpleBackoff algorithm with the specified
 // list of fixed intervals in milliseconds.
 func NewSimpleBackoff(ticks ...int) *SimpleBackoff {
 	return &SimpleBackoff{
-		ticks:  ticks,
-		index:  0,
-		jitter: false,
-		stop:   false,
+		b: elastic.NewSimpleBackoff(ticks...),
+		n: len(ticks),
 	}
 }
 
 // Jitter, when set, randomizes to return a value of [0.5*value .. 1.5*value].
 func (b *SimpleBackoff) Jitter(doJitter bool) *SimpleBackoff {
-	b.Lock()
-	defer b.Unlock()
-	b.jitter = doJitter
+	b.b.Jitter(doJitter)
 	return b
 }
 
@@ -68,50 +73,37 @@ func (b *SimpleBackoff) Next() time.Duration {
 	b.Lock()
 	defer b.Unlock()
 
-	i := b.index
-	if i >= len(b.ticks) {
-		if b.stop {
+	d, ok := b.b.Next(b.retry)
+	if !ok {
+		if b.stop || b.n == 0 {
 			return Stop
 		}
-		i = len(b.ticks) - 1
-		b.index = i
-	} else {
-		b.index++
+		d, _ = b.b.Next(b.n - 1)
+		return d
 	}
-
-	ms := b.ticks[i]
-	if b.jitter {
-		ms = jitter(ms)
-	}
-	return time.Duration(ms) * time.Millisecond
+	b.retry++
+	return d
 }
 
 // Reset resets SimpleBackoff.
 func (b *SimpleBackoff) Reset() {
 	b.Lock()
-	b.index = 0
+	b.retry = 0
 	b.Unlock()
 }
 
-// jitter randomizes the interval to return a value of [0.5*millis .. 1.5*millis].
-func jitter(millis int) int {
-	if millis <= 0 {
-		return 0
-	}
-	return millis/2 + rand.Intn(millis)
-}
-
 // -- Exponential --
 
 // ExponentialBackoff implements the simple exponential backoff described by
 // Douglas Thain at http://dthain.blogspot.de/2009/02/exponential-backoff-in-distributed.html.
+//
+// ExponentialBackoff uses elastic.ExponentialBackoff to compute the intervals.
 type ExponentialBackoff struct {
 	sync.Mutex
-	t    float64 // initial timeout (in msec)
-	f    float64 // exponential factor (e.g. 2)
-	m    float64 // maximum timeout (in msec)
-	n    int64   // number of retries
-	stop bool    // indicates whether Next should send "Stop" whan max timeout is reached
+	b     *elastic.ExponentialBackoff
+	max   time.Duration // maximum wait interval
+	retry int           // number of retries
+	stop  bool          // indicates whether Next should send "Stop" whan max timeout is reached
 }
 
 // NewExponentialBackoff returns a ExponentialBackoff backoff policy.
@@ -119,11 +111,8 @@ type ExponentialBackoff struct {
 // and maxTimeout to set the maximum wait interval.
 func NewExponentialBackoff(initialTimeout, maxTimeout time.Duration) *ExponentialBackoff {
 	return &ExponentialBackoff{
-		t:    float64(int64(initialTimeout / time.Millisecond)),
-		f:    2.0,
-		m:    float64(int64(maxTimeout / time.Millisecond)),
-		n:    0,
-		stop: false,
+		b:   elastic.NewExponentialBackoff(initialTimeout, maxTimeout),
+		max: maxTimeout,
 	}
 }
 
@@ -137,23 +126,24 @@ func (b *ExponentialBackoff) SendStop(doStop bool) *ExponentialBackoff {
 }
 
 // Next returns the next wait interval.
-func (t *ExponentialBackoff) Next() time.Duration {
-	t.Lock()
-	defer t.Unlock()
-
-	n := float64(atomic.AddInt64(&t.n, 1))
-	r := 1.0 + rand.Float64() // random number in [1..2]
-	m := math.Min(r*t.t*math.Pow(t.f, n), t.m)
-	if t.stop && m >= t.m {
-		return Stop
+func (b *ExponentialBackoff) Next() time.Duration {
+	b.Lock()
+	defer b.Unlock()
+
+	b.retry++
+	d, ok := b.b.Next(b.retry)
+	if !ok {
+		if b.stop {
+			return Stop
+		}
+		return b.max
 	}
-	d := time.Duration(int64(m)) * time.Millisecond
 	return d
 }
 
 // Reset resets the backoff policy so that it can be reused.
-func (t *ExponentialBackoff) Reset() {
-	t.Lock()
-	t.n = 0
-	t.Unlock()
+func (b *ExponentialBackoff) Reset() {
+	b.Lock()
+	b.retry = 0
+	b.Unlock()
 }
@@ -9,7 +9,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 
 	"gopkg.in/olivere/elastic.v2/uritemplates"
 )
@@ -35,6 +38,9 @@ type BulkService struct {
 	refresh  *bool
 	pretty   bool
 
+	body        bytes.Buffer // serialized requests
+	ends        []int        // end offset of each request in body
+	bodyErr     error        // first error serializing requests
 	sizeInBytes int64
 }
 
@@ -48,6 +54,9 @@ func NewBulkService(client *Client) *BulkService {
 
 func (s *BulkService) reset() {
 	s.requests = make([]BulkableRequest, 0)
+	s.body.Reset()
+	s.ends = nil
+	s.bodyErr = nil
 	s.sizeInBytes = 0
 }
 
@@ -89,16 +98,54 @@ func (s *BulkService) Pretty(pretty bool) *BulkService {
 
 // Add adds bulkable requests, i.e. BulkIndexRequest, BulkUpdateRequest,
 // and/or BulkDeleteRequest.
+//
+// Requests are serialized when they are added. Changes to a request after
+// it has been added are not reflected in the next batch.
 func (s *BulkService) Add(requests ...BulkableRequest) *BulkService {
 	for _, r := range requests {
 		s.requests = append(s.requests, r)
-		s.sizeInBytes += s.estimateSizeInBytes(r)
+		if err := writeBulkableRequest(&s.body, r); err != nil && s.bodyErr == nil {
+			s.bodyErr = err
+		}
+		s.ends = append(s.ends, s.body.Len())
+		s.sizeInBytes = int64(s.body.Len())
 	}
 	return s
 }
 
+// addSerialized adds a request whose on-wire representation has already
+// been serialized, e.g. by BulkProcessor when writing it to the spool.
+func (s *BulkService) addSerialized(r BulkableRequest, data []byte) {
+	s.requests = append(s.requests, r)
+	s.body.Write(data)
+	s.ends = append(s.ends, s.body.Len())
+	s.sizeInBytes = int64(s.body.Len())
+}
+
+// takeSerialized returns the requests and their on-wire representation,
+// and resets the service. The caller owns the returned slices.
+// It returns an error if a request could not be serialized.
+func (s *BulkService) takeSerialized() ([]BulkableRequest, [][]byte, error) {
+	if err := s.bodyErr; err != nil {
+		s.reset()
+		return nil, nil, err
+	}
+	requests, body := s.requests, s.body.Bytes()
+	data := make([][]byte, len(s.ends))
+	start := 0
+	for i, end := range s.ends {
+		data[i] = body[start:end:end]
+		start = end
+	}
+	// Hand over the buffer instead of reusing it
+	s.body = bytes.Buffer{}
+	s.reset()
+	return requests, data, nil
+}
+
 // EstimatedSizeInBytes returns the estimated size of all bulkable
-// requests added via Add.
+// requests added via Add. As requests are serialized when they are
+// added, this is the exact size of the body sent to Elasticsearch.
 func (s *BulkService) EstimatedSizeInBytes() int64 {
 	return s.sizeInBytes
 }
@@ -123,20 +170,10 @@ func (s *BulkService) NumberOfActions() int {
 }
 
 func (s *BulkService) bodyAsString() (string, error) {
-	var buf bytes.Buffer
-
-	for _, req := range s.requests {
-		source, err := req.Source()
-		if err != nil {
-			return "", err
-		}
-		for _, line := range source {
-			buf.WriteString(line)
-			buf.WriteByte('\n')
-		}
+	if s.bodyErr != nil {
+		return "", s.bodyErr
 	}
-
-	return buf.String(), nil
+	return s.body.String(), nil
 }
 
 // Do runs DoC() with default context.
@@ -204,6 +241,7 @@ func (s *BulkService) DoC(ctx context.Context) (*BulkResponse, error) {
 	if err := s.client.decoder.Decode(res.Body, ret); err != nil {
 		return nil, err
 	}
+	ret.requests = s.requests
 
 	// Reset so the request can be reused
 	s.reset()
@@ -256,6 +294,8 @@ type BulkResponse struct {
 	Took   int                            `json:"took,omitempty"`
 	Errors bool                           `json:"errors,omitempty"`
 	Items  []map[string]*BulkResponseItem `json:"items,omitempty"`
+
+	requests []BulkableRequest // requests that resulted in this response
 }
 
 // BulkResponseItem is the result of a single bulk request.
@@ -354,3 +394,137 @@ func (r *BulkResponse) Succeeded() []*BulkResponseItem {
 	}
 	return succeeded
 }
+
+// Request returns the bulk request at the given position, i.e. the
+// request that resulted in Items[i]. It returns nil if the request is
+// unknown, e.g. because the response has not been returned from BulkService.
+func (r *BulkResponse) Request(i int) BulkableRequest {
+	if i < 0 || i >= len(r.requests) {
+		return nil
+	}
+	return r.requests[i]
+}
+
+// Failures returns details about all items of a bulk response that
+// have errors, i.e. those that don't have a status code between 200
+// and 299. Each failure is mapped back to the position of the bulk request
+// that caused it.
+func (r *BulkResponse) Failures() []*BulkResponseFailure {
+	if r.Items == nil {
+		return nil
+	}
+	var failures []*BulkResponseFailure
+	for i, item := range r.Items {
+		for action, result := range item {
+			if !(result.Status >= 200 && result.Status <= 299) {
+				failures = append(failures, &BulkResponseFailure{
+					Position: i,
+					Action:   action,
+					Request:  r.Request(i),
+					Item:     result,
+				})
+			}
+		}
+	}
+	return failures
+}
+
+// Summary returns statistics about the bulk response, e.g. the number of
+// failed items grouped by error type, status, and index.
+func (r *BulkResponse) Summary() *BulkResponseSummary {
+	sum := &BulkResponseSummary{
+		FailedByType:   make(map[string]int),
+		FailedByStatus: make(map[int]int),
+		FailedByIndex:  make(map[string]int),
+	}
+	for _, item := range r.Items {
+		for _, result := range item {
+			sum.Total++
+			if result.Status >= 200 && result.Status <= 299 {
+				sum.Succeeded++
+				continue
+			}
+			sum.Failed++
+			sum.FailedByType[result.ErrorType()]++
+			sum.FailedByStatus[result.Status]++
+			sum.FailedByIndex[result.Index]++
+		}
+	}
+	return sum
+}
+
+// Err returns a *BulkError if any of the items of the bulk response
+// failed, and nil otherwise.
+func (r *BulkResponse) Err() error {
+	failures := r.Failures()
+	if len(failures) == 0 {
+		return nil
+	}
+	return &BulkError{Failures: failures, Summary: r.Summary()}
+}
+
+// Err returns the error of a single bulk response item as an *Error,
+// or nil if the item succeeded.
+func (item *BulkResponseItem) Err() error {
+	if item.Status >= 200 && item.Status <= 299 {
+		return nil
+	}
+	return &Error{Status: item.Status, Message: item.Error}
+}
+
+// ErrorType returns the type of error of a failed bulk response item,
+// i.e. the name of the exception as reported by Elasticsearch, e.g.
+// "MapperParsingException" for an error like
+// "MapperParsingException[failed to parse [age]]". If the type cannot be
+// determined, e.g. because the error is empty, the HTTP status text
+// is returned instead.
+func (item *BulkResponseItem) ErrorType() string {
+	if i := strings.Index(item.Error, "["); i > 0 {
+		return item.Error[:i]
+	}
+	if item.Error != "" && !strings.ContainsAny(item.Error, " \t") {
+		return item.Error
+	}
+	return http.StatusText(item.Status)
+}
+
+// BulkResponseFailure describes a single failed item in a bulk response.
+type BulkResponseFailure struct {
+	Position int               // position of the item and its request
+	Action   string            // action, e.g. "index" or "delete"
+	Request  BulkableRequest   // request that failed (nil if unknown)
+	Item     *BulkResponseItem // item as returned by Elasticsearch
+}
+
+// BulkResponseSummary contains statistics about a bulk response.
+type BulkResponseSummary struct {
+	Total          int            // # of items
+	Succeeded      int            // # of successful items
+	Failed         int            // # of failed items
+	FailedByType   map[string]int // # of failed items by error type
+	FailedByStatus map[int]int    // # of failed items by status code
+	FailedByIndex  map[string]int // # of failed items by index
+}
+
+// BulkError is returned from BulkResponse.Err if one or more items
+// of a bulk response failed.
+type BulkError struct {
+	Failures []*BulkResponseFailure
+	Summary  *BulkResponseSummary
+}
+
+// Error returns a string representation of the error, including
+// the number of failures by error type.
+func (e *BulkError) Error() string {
+	var types []string
+	for typ := range e.Summary.FailedByType {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	var details []string
+	for _, typ := range types {
+		details = append(details, fmt.Sprintf("%s (%d)", typ, e.Summary.FailedByType[typ]))
+	}
+	return fmt.Sprintf("elastic: %d of %d bulk requests failed: %s",
+		e.Summary.Failed, e.Summary.Total, strings.Join(details, ", "))
+}
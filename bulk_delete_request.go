@@ -5,8 +5,9 @@
 package elastic
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
+	"io"
 	"strings"
 )
 
@@ -116,43 +117,42 @@ func (r *BulkDeleteRequest) Source() ([]string, error) {
 	if r.source != nil {
 		return r.source, nil
 	}
-	lines := make([]string, 1)
 
-	source := make(map[string]interface{})
-	deleteCommand := make(map[string]interface{})
-	if r.index != "" {
-		deleteCommand["_index"] = r.index
-	}
-	if r.typ != "" {
-		deleteCommand["_type"] = r.typ
-	}
-	if r.id != "" {
-		deleteCommand["_id"] = r.id
-	}
-	if r.parent != "" {
-		deleteCommand["_parent"] = r.parent
-	}
-	if r.routing != "" {
-		deleteCommand["_routing"] = r.routing
-	}
-	if r.version > 0 {
-		deleteCommand["_version"] = r.version
-	}
-	if r.versionType != "" {
-		deleteCommand["_version_type"] = r.versionType
-	}
-	if r.refresh != nil {
-		deleteCommand["refresh"] = *r.refresh
-	}
-	source["delete"] = deleteCommand
-
-	body, err := json.Marshal(source)
-	if err != nil {
+	var buf bytes.Buffer
+	if _, err := r.writeTo(&buf); err != nil {
 		return nil, err
 	}
+	lines := []string{strings.TrimSuffix(buf.String(), "\n")}
 
-	lines[0] = string(body)
 	r.source = lines
-
 	return lines, nil
 }
+
+// WriteTo writes the on-wire representation of the delete request to w,
+// i.e. the line returned by Source, followed by a newline.
+// It implements the io.WriterTo interface.
+func (r *BulkDeleteRequest) WriteTo(w io.Writer) (int64, error) {
+	if r.source != nil {
+		return writeBulkLines(w, r.source)
+	}
+	return r.writeTo(w)
+}
+
+func (r *BulkDeleteRequest) writeTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	meta := &bulkRequestMetaData{
+		Index:       r.index,
+		Type:        r.typ,
+		Id:          r.id,
+		Parent:      r.parent,
+		Routing:     r.routing,
+		VersionType: r.versionType,
+		Refresh:     r.refresh,
+	}
+	if r.version > 0 {
+		meta.Version = r.version
+	}
+	err := writeBulkCommand(cw, "delete", meta)
+	return cw.n, err
+}
@@ -5,8 +5,9 @@
 package elastic
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
+	"io"
 	"strings"
 )
 
@@ -163,70 +164,55 @@ func (r *BulkIndexRequest) Source() ([]string, error) {
 		return r.source, nil
 	}
 
-	lines := make([]string, 2)
-
-	// "index" ...
-	command := make(map[string]interface{})
-	indexCommand := make(map[string]interface{})
-	if r.index != "" {
-		indexCommand["_index"] = r.index
-	}
-	if r.typ != "" {
-		indexCommand["_type"] = r.typ
-	}
-	if r.id != "" {
-		indexCommand["_id"] = r.id
-	}
-	if r.routing != "" {
-		indexCommand["_routing"] = r.routing
+	var buf bytes.Buffer
+	if _, err := r.writeTo(&buf); err != nil {
+		return nil, err
 	}
-	if r.parent != "" {
-		indexCommand["_parent"] = r.parent
+	lines := strings.SplitN(strings.TrimSuffix(buf.String(), "\n"), "\n", 2)
+
+	r.source = lines
+	return lines, nil
+}
+
+// WriteTo writes the on-wire representation of the index request to w,
+// i.e. the lines returned by Source, each followed by a newline.
+// It implements the io.WriterTo interface.
+func (r *BulkIndexRequest) WriteTo(w io.Writer) (int64, error) {
+	if r.source != nil {
+		return writeBulkLines(w, r.source)
 	}
-	if r.timestamp != "" {
-		indexCommand["_timestamp"] = r.timestamp
+	return r.writeTo(w)
+}
+
+func (r *BulkIndexRequest) writeTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	// "index" ...
+	meta := &bulkRequestMetaData{
+		Index:       r.index,
+		Type:        r.typ,
+		Id:          r.id,
+		Routing:     r.routing,
+		Parent:      r.parent,
+		Timestamp:   r.timestamp,
+		VersionType: r.versionType,
+		Refresh:     r.refresh,
 	}
 	if r.ttl > 0 {
-		indexCommand["_ttl"] = r.ttl
+		meta.Ttl = r.ttl
 	}
 	if r.version > 0 {
-		indexCommand["_version"] = r.version
-	}
-	if r.versionType != "" {
-		indexCommand["_version_type"] = r.versionType
+		meta.Version = r.version
 	}
-	if r.refresh != nil {
-		indexCommand["refresh"] = *r.refresh
+	if err := writeBulkCommand(cw, r.opType, meta); err != nil {
+		return cw.n, err
 	}
-	command[r.opType] = indexCommand
-	line, err := json.Marshal(command)
-	if err != nil {
-		return nil, err
-	}
-	lines[0] = string(line)
 
 	// "field1" ...
-	if r.doc != nil {
-		switch t := r.doc.(type) {
-		default:
-			body, err := json.Marshal(r.doc)
-			if err != nil {
-				return nil, err
-			}
-			lines[1] = string(body)
-		case json.RawMessage:
-			lines[1] = string(t)
-		case *json.RawMessage:
-			lines[1] = string(*t)
-		case string:
-			lines[1] = t
-		case *string:
-			lines[1] = *t
-		}
-	} else {
-		lines[1] = "{}"
+	doc := r.doc
+	if doc == nil {
+		doc = "{}"
 	}
-
-	r.source = lines
-	return lines, nil
+	err := writeBulkDoc(cw, doc)
+	return cw.n, err
 }
@@ -5,11 +5,12 @@
 package elastic
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
-
-	"gopkg.in/olivere/elastic.v2/backoff"
 )
 
 // BulkProcessorService allows to easily process bulk requests. It allows setting
@@ -21,7 +22,7 @@ import (
 // BulkProcessorService, by default, commits either every 1000 requests or when the
 // (estimated) size of the bulk requests exceeds 5 MB. However, it does not
 // commit periodically. BulkProcessorService also does retry by default, using
-// an exponential backoff algorithm.
+// an exponential backoff algorithm. Use Backoff or Retrier to change that.
 //
 // The caller is responsible for setting the index and type on every
 // bulk request added to BulkProcessorService.
@@ -39,19 +40,22 @@ type BulkProcessorService struct {
 	bulkSize       int           // # of bytes after which to commit
 	flushInterval  time.Duration // periodic flush interval
 	wantStats      bool          // indicates whether to gather statistics
-	initialTimeout time.Duration // initial wait time before retry on errors
-	maxTimeout     time.Duration // max time to wait for retry on errors
+	retrier        Retrier       // strategy for retrying failed commits
+	maxAttempts    int           // max # of commit attempts (0 = unlimited)
+	maxElapsedTime time.Duration // max time to retry a commit (0 = unlimited)
+	spoolDir       string        // directory of the spool (empty if disabled)
+	spoolSize      int64         // max size of a spool segment
+	spoolSync      bool          // indicates whether to fsync after each write
 }
 
 // NewBulkProcessorService creates a new BulkProcessorService.
 func NewBulkProcessorService(client *Client) *BulkProcessorService {
 	return &BulkProcessorService{
-		c:              client,
-		numWorkers:     1,
-		bulkActions:    1000,
-		bulkSize:       5 << 20, // 5 MB
-		initialTimeout: time.Duration(200) * time.Millisecond,
-		maxTimeout:     time.Duration(10000) * time.Millisecond,
+		c:           client,
+		numWorkers:  1,
+		bulkActions: 1000,
+		bulkSize:    5 << 20, // 5 MB
+		retrier:     NewBackoffRetrier(NewExponentialBackoff(200*time.Millisecond, 10*time.Second)),
 	}
 }
 
@@ -121,6 +125,88 @@ func (s *BulkProcessorService) Stats(wantStats bool) *BulkProcessorService {
 	return s
 }
 
+// Backoff specifies the backoff strategy to use when committing bulk
+// requests fails, e.g. NewExponentialBackoff or NewSimpleBackoff.
+// It is a shortcut for Retrier(NewBackoffRetrier(backoff)).
+//
+// The default is an exponential backoff that starts at 200ms and
+// stops retrying when the wait interval would exceed 10s.
+func (s *BulkProcessorService) Backoff(backoff Backoff) *BulkProcessorService {
+	if backoff == nil {
+		backoff = StopBackoff{}
+	}
+	s.retrier = NewBackoffRetrier(backoff)
+	return s
+}
+
+// Retrier specifies the strategy to use when committing bulk requests
+// fails. It is e.g. possible to use the same Retrier that has been
+// passed to the client via SetRetrier. As there is no single HTTP request
+// or response associated with a commit, the Retrier is called with
+// nil for both.
+//
+// Passing nil disables retries.
+func (s *BulkProcessorService) Retrier(retrier Retrier) *BulkProcessorService {
+	if retrier == nil {
+		retrier = noRetries
+	}
+	s.retrier = retrier
+	return s
+}
+
+// MaxAttempts specifies the maximum number of attempts to commit bulk
+// requests, including the first attempt. Defaults to 0, i.e. the number
+// of attempts is only limited by Backoff or Retrier.
+func (s *BulkProcessorService) MaxAttempts(maxAttempts int) *BulkProcessorService {
+	s.maxAttempts = maxAttempts
+	return s
+}
+
+// MaxElapsedTime specifies the maximum time to spend on committing
+// bulk requests, including retries. No further retries are made if the
+// next retry would exceed that limit. Defaults to 0, i.e. the time is only
+// limited by Backoff or Retrier.
+func (s *BulkProcessorService) MaxElapsedTime(maxElapsedTime time.Duration) *BulkProcessorService {
+	s.maxElapsedTime = maxElapsedTime
+	return s
+}
+
+// Spool enables a durable, on-disk spool for bulk requests in the given
+// directory. Requests are written to the spool before Add returns and
+// removed from the spool once Elasticsearch reported them as successful.
+// Requests that are left in the spool, e.g. because the process crashed
+// or because Elasticsearch was overloaded (429) or unavailable (5xx),
+// are replayed when the bulk processor is started again, resulting in
+// at-least-once semantics.
+//
+// Requests that failed permanently, e.g. with a mapping error (400) or
+// a version conflict (409), are removed from the spool as sending them
+// again would fail again. They are only reported to the After callback,
+// as failed items of the response, and counted in SpoolFailed.
+//
+// The directory must not be shared with other bulk processors.
+// The spool is disabled by default.
+func (s *BulkProcessorService) Spool(dir string) *BulkProcessorService {
+	s.spoolDir = dir
+	return s
+}
+
+// SpoolSegmentSize specifies the size (in bytes) after which a new
+// segment file is started in the spool. Defaults to 64 MB.
+func (s *BulkProcessorService) SpoolSegmentSize(size int64) *BulkProcessorService {
+	s.spoolSize = size
+	return s
+}
+
+// SpoolSync specifies whether to flush the spool to stable storage
+// after each request has been written. This makes the spool survive
+// operating system crashes at the cost of slower calls to Add.
+// It is disabled by default.
+func (s *BulkProcessorService) SpoolSync(sync bool) *BulkProcessorService {
+	s.spoolSync = sync
+	return s
+}
+
 // Do creates a new BulkProcessor and starts it.
 // Consider the BulkProcessor as a running instance that accepts bulk requests
 // and commits them to Elasticsearch, spreading the work across one or more
@@ -142,8 +228,12 @@ func (s *BulkProcessorService) Do() (*BulkProcessor, error) {
 		s.bulkSize,
 		s.flushInterval,
 		s.wantStats,
-		s.initialTimeout,
-		s.maxTimeout)
+		s.retrier,
+		s.maxAttempts,
+		s.maxElapsedTime,
+		s.spoolDir,
+		s.spoolSize,
+		s.spoolSync)
 
 	err := p.Start()
 	if err != nil {
@@ -166,6 +256,14 @@ type BulkProcessorStats struct {
 	Succeeded int64 // # of requests that ES reported as successful
 	Failed    int64 // # of requests that ES reported as failed
 
+	// # of requests rejected by Add because they could not be spooled,
+	// plus # of requests removed from the spool because ES rejected them
+	SpoolFailed int64
+
+	ShutdownAborted     bool          // true if Close gave up before all requests were committed
+	ShutdownUncommitted int64         // # of requests that were not committed on Close
+	ShutdownDuration    time.Duration // time it took to Close the processor
+
 	Workers []*BulkProcessorWorkerStats // stats for each worker
 }
 
@@ -173,6 +271,8 @@ type BulkProcessorStats struct {
 type BulkProcessorWorkerStats struct {
 	Queued       int64         // # of requests queued in this worker
 	LastDuration time.Duration // duration of last commit
+	Retries      int64         // # of times this worker retried a commit
+	LastRetries  int64         // # of retries of the last commit
 }
 
 // newBulkProcessorStats initializes and returns a BulkProcessorStats struct.
@@ -196,6 +296,10 @@ func (st *BulkProcessorStats) dup() *BulkProcessorStats {
 	dst.Deleted = st.Deleted
 	dst.Succeeded = st.Succeeded
 	dst.Failed = st.Failed
+	dst.SpoolFailed = st.SpoolFailed
+	dst.ShutdownAborted = st.ShutdownAborted
+	dst.ShutdownUncommitted = st.ShutdownUncommitted
+	dst.ShutdownDuration = st.ShutdownDuration
 	for _, src := range st.Workers {
 		dst.Workers = append(dst.Workers, src.dup())
 	}
@@ -206,6 +310,8 @@ func (st *BulkProcessorWorkerStats) dup() *BulkProcessorWorkerStats {
 	dst := new(BulkProcessorWorkerStats)
 	dst.Queued = st.Queued
 	dst.LastDuration = st.LastDuration
+	dst.Retries = st.Retries
+	dst.LastRetries = st.LastRetries
 	return dst
 }
 
@@ -225,14 +331,21 @@ type BulkProcessor struct {
 	bulkSize       int
 	numWorkers     int
 	executionId    int64
-	requestsC      chan BulkableRequest
+	requestsC      chan bulkSpoolEntry
 	workerWg       sync.WaitGroup
 	workers        []*bulkWorker
 	flushInterval  time.Duration
 	flusherStopC   chan struct{}
 	wantStats      bool
-	initialTimeout time.Duration // initial wait time before retry on errors
-	maxTimeout     time.Duration // max time to wait for retry on errors
+	retrier        Retrier       // strategy for retrying failed commits
+	maxAttempts    int           // max # of commit attempts (0 = unlimited)
+	maxElapsedTime time.Duration // max time to retry a commit (0 = unlimited)
+	spoolDir       string        // directory of the spool (empty if disabled)
+	spoolSize      int64         // max size of a spool segment
+	spoolSync      bool          // indicates whether to fsync after each write
+	spool          *bulkSpool
+	ctx            context.Context    // context for commits, see CloseC
+	cancel         context.CancelFunc // aborts commits in progress
 
 	startedMu sync.Mutex // guards the following block
 	started   bool
@@ -251,8 +364,12 @@ func newBulkProcessor(
 	bulkSize int,
 	flushInterval time.Duration,
 	wantStats bool,
-	initialTimeout time.Duration,
-	maxTimeout time.Duration) *BulkProcessor {
+	retrier Retrier,
+	maxAttempts int,
+	maxElapsedTime time.Duration,
+	spoolDir string,
+	spoolSize int64,
+	spoolSync bool) *BulkProcessor {
 	return &BulkProcessor{
 		c:              client,
 		beforeFn:       beforeFn,
@@ -263,13 +380,20 @@ func newBulkProcessor(
 		bulkSize:       bulkSize,
 		flushInterval:  flushInterval,
 		wantStats:      wantStats,
-		initialTimeout: initialTimeout,
-		maxTimeout:     maxTimeout,
+		retrier:        retrier,
+		maxAttempts:    maxAttempts,
+		maxElapsedTime: maxElapsedTime,
+		spoolDir:       spoolDir,
+		spoolSize:      spoolSize,
+		spoolSync:      spoolSync,
 	}
 }
 
 // Start starts the bulk processor. If the processor is already started,
 // nil is returned.
+//
+// If a spool has been configured, Start replays all requests that have
+// not been committed before.
 func (p *BulkProcessor) Start() error {
 	p.startedMu.Lock()
 	defer p.startedMu.Unlock()
@@ -283,7 +407,19 @@ func (p *BulkProcessor) Start() error {
 		p.numWorkers = 1
 	}
 
-	p.requestsC = make(chan BulkableRequest)
+	// Open the spool (if enabled)
+	var replay []bulkSpoolEntry
+	if p.spoolDir != "" {
+		spool, entries, err := openBulkSpool(p.spoolDir, p.spoolSize, p.spoolSync)
+		if err != nil {
+			return err
+		}
+		p.spool = spool
+		replay = entries
+	}
+
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.requestsC = make(chan bulkSpoolEntry)
 	p.executionId = 0
 	p.stats = newBulkProcessorStats(p.numWorkers)
 
@@ -303,6 +439,11 @@ func (p *BulkProcessor) Start() error {
 
 	p.started = true
 
+	// Replay requests found in the spool
+	for _, entry := range replay {
+		p.requestsC <- entry
+	}
+
 	return nil
 }
 
@@ -314,31 +455,89 @@ func (p *BulkProcessor) Stop() error {
 // Close stops the bulk processor previously started with Do.
 // If it is already stopped, this is a no-op and nil is returned.
 //
+// Close waits until all outstanding requests have been committed or
+// retrying them has failed. Use CloseC to limit the time to wait.
+//
 // By implementing Close, BulkProcessor implements the io.Closer interface.
 func (p *BulkProcessor) Close() error {
+	_, err := p.CloseC(nil)
+	return err
+}
+
+// CloseC stops the bulk processor previously started with Do.
+// Like Close, it asks the workers to commit their outstanding requests.
+// However, when the given context is done before all workers finished,
+// CloseC aborts all commits in progress and returns the context's error.
+//
+// CloseC returns the requests that have not been committed, either because
+// the context was done or because committing them failed. If the processor
+// is already stopped, this is a no-op and nil is returned.
+func (p *BulkProcessor) CloseC(ctx context.Context) ([]BulkableRequest, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	p.startedMu.Lock()
 	defer p.startedMu.Unlock()
 
 	// Already stopped? Do nothing.
 	if !p.started {
-		return nil
+		return nil, nil
+	}
+
+	start := time.Now()
+
+	// Stop flusher (if enabled) and all workers. This may block until
+	// commits in progress are done, so we run it in the background.
+	done := make(chan struct{})
+	go func() {
+		if p.flusherStopC != nil {
+			p.flusherStopC <- struct{}{}
+			<-p.flusherStopC
+			close(p.flusherStopC)
+			p.flusherStopC = nil
+		}
+		close(p.requestsC)
+		p.workerWg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// Abort commits in progress and wait for the workers to give up
+		err = ctx.Err()
+		p.cancel()
+		<-done
 	}
+	p.cancel()
 
-	// Stop flusher (if enabled)
-	if p.flusherStopC != nil {
-		p.flusherStopC <- struct{}{}
-		<-p.flusherStopC
-		close(p.flusherStopC)
-		p.flusherStopC = nil
+	// Collect requests that have not been committed
+	var uncommitted []BulkableRequest
+	for _, w := range p.workers {
+		uncommitted = append(uncommitted, w.service.requests...)
 	}
 
-	// Stop all workers.
-	close(p.requestsC)
-	p.workerWg.Wait()
+	// Close the spool (if enabled)
+	if p.spool != nil {
+		if serr := p.spool.Close(); serr != nil && err == nil {
+			err = serr
+		}
+		p.spool = nil
+	}
+
+	p.statsMu.Lock()
+	if p.wantStats {
+		p.stats.ShutdownAborted = ctx.Err() != nil
+		p.stats.ShutdownUncommitted = int64(len(uncommitted))
+		p.stats.ShutdownDuration = time.Since(start)
+	}
+	p.statsMu.Unlock()
 
 	p.started = false
 
-	return nil
+	return uncommitted, err
 }
 
 // Stats returns the latest bulk processor statistics.
@@ -353,8 +552,48 @@ func (p *BulkProcessor) Stats() BulkProcessorStats {
 // Add adds a single request to commit by the BulkProcessorService.
 //
 // The caller is responsible for setting the index and type on the request.
-func (p *BulkProcessor) Add(request BulkableRequest) {
-	p.requestsC <- request
+//
+// If a spool has been configured, the request is written to the spool
+// before it is passed on to the workers. If that fails, the request is
+// not processed and the error is returned. Without a spool, Add always
+// returns nil.
+func (p *BulkProcessor) Add(request BulkableRequest) error {
+	if p.spool == nil {
+		p.requestsC <- bulkSpoolEntry{request: request}
+		return nil
+	}
+	// Serialize the request only once, for both the spool and the worker
+	var buf bytes.Buffer
+	if err := writeBulkableRequest(&buf, request); err != nil {
+		return p.spoolFailed(err)
+	}
+	return p.addSerialized(request, buf.Bytes())
+}
+
+// addSerialized adds a request whose on-wire representation has already
+// been serialized, e.g. by a BulkService. It must not be modified after.
+func (p *BulkProcessor) addSerialized(request BulkableRequest, data []byte) error {
+	entry := bulkSpoolEntry{request: request, data: data}
+	if p.spool != nil {
+		ref, err := p.spool.Append(data)
+		if err != nil {
+			return p.spoolFailed(err)
+		}
+		entry.ref = ref
+	}
+	p.requestsC <- entry
+	return nil
+}
+
+// spoolFailed counts a request that could not be spooled and returns
+// the error for Add.
+func (p *BulkProcessor) spoolFailed(err error) error {
+	p.statsMu.Lock()
+	if p.wantStats {
+		p.stats.SpoolFailed++
+	}
+	p.statsMu.Unlock()
+	return fmt.Errorf("elastic: bulk processor %q failed to spool request: %v", p.name, err)
 }
 
 // Flush manually asks all workers to commit their outstanding requests.
@@ -401,6 +640,7 @@ type bulkWorker struct {
 	bulkActions int
 	bulkSize    int
 	service     *BulkService
+	spooled     []bulkSpoolRef // spool references of requests in service
 	flushC      chan struct{}
 	flushAckC   chan struct{}
 }
@@ -430,10 +670,15 @@ func (w *bulkWorker) work() {
 	var stop bool
 	for !stop {
 		select {
-		case req, open := <-w.p.requestsC:
+		case entry, open := <-w.p.requestsC:
 			if open {
 				// Received a new request
-				w.service.Add(req)
+				if entry.data != nil {
+					w.service.addSerialized(entry.request, entry.data)
+				} else {
+					w.service.Add(entry.request)
+				}
+				w.spooled = append(w.spooled, entry.ref)
 				if w.commitRequired() {
 					w.commit() // TODO swallow errors here?
 				}
@@ -460,18 +705,6 @@ func (w *bulkWorker) work() {
 func (w *bulkWorker) commit() error {
 	var res *BulkResponse
 
-	// commitFunc will commit bulk requests and, on failure, be retried
-	// via exponential backoff
-	commitFunc := func() error {
-		var err error
-		res, err = w.service.Do()
-		return err
-	}
-	// notifyFunc will be called if retry fails
-	notifyFunc := func(err error, d time.Duration) {
-		w.p.c.errorf("elastic: bulk processor %q failed but will retry in %v: %v", w.p.name, d, err)
-	}
-
 	id := atomic.AddInt64(&w.p.executionId, 1)
 
 	// Update # documents in queue before eventual retries
@@ -490,11 +723,30 @@ func (w *bulkWorker) commit() error {
 	}
 
 	// Commit bulk requests
-	policy := backoff.NewExponentialBackoff(w.p.initialTimeout, w.p.maxTimeout).SendStop(true)
-	err := backoff.RetryNotify(commitFunc, policy, notifyFunc)
+	res, err := w.commitWithRetries()
 	w.updateStats(res)
 	if err != nil {
 		w.p.c.errorf("elastic: bulk processor %q failed: %v", w.p.name, err)
+	} else {
+		// Remove requests from the spool that Elasticsearch reported as
+		// successful or rejected permanently. Requests that failed
+		// temporarily stay in the spool and are replayed when the bulk
+		// processor is started again.
+		if w.p.spool != nil {
+			done, rejected := settleBulkSpool(res, w.spooled)
+			if serr := w.p.spool.Commit(done); serr != nil {
+				w.p.c.errorf("elastic: bulk processor %q failed to truncate spool: %v", w.p.name, serr)
+			}
+			if rejected > 0 {
+				w.p.c.errorf("elastic: bulk processor %q removed %d rejected requests from spool", w.p.name, rejected)
+				w.p.statsMu.Lock()
+				if w.p.wantStats {
+					w.p.stats.SpoolFailed += int64(rejected)
+				}
+				w.p.statsMu.Unlock()
+			}
+		}
+		w.spooled = nil
 	}
 
 	// Invoke after callback
@@ -505,6 +757,56 @@ func (w *bulkWorker) commit() error {
 	return err
 }
 
+// commitWithRetries sends the bulk requests to Elasticsearch. On failure,
+// it asks the retrier of the bulk processor whether and when to try again,
+// honoring the maximum number of attempts and the maximum elapsed time.
+func (w *bulkWorker) commitWithRetries() (*BulkResponse, error) {
+	start := time.Now()
+	var retries int64
+	defer func() {
+		w.p.statsMu.Lock()
+		if w.p.wantStats {
+			w.p.stats.Workers[w.i].Retries += retries
+			w.p.stats.Workers[w.i].LastRetries = retries
+		}
+		w.p.statsMu.Unlock()
+	}()
+
+	for attempt := 1; ; attempt++ {
+		res, err := w.service.DoC(w.p.ctx)
+		if err == nil {
+			return res, nil
+		}
+		if w.p.ctx.Err() != nil {
+			return nil, w.p.ctx.Err()
+		}
+		if w.p.maxAttempts > 0 && attempt >= w.p.maxAttempts {
+			return nil, err
+		}
+		wait, goahead, rerr := w.p.retrier.Retry(attempt, nil, nil, err)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if !goahead {
+			return nil, err
+		}
+		if w.p.maxElapsedTime > 0 && time.Since(start)+wait > w.p.maxElapsedTime {
+			return nil, err
+		}
+
+		w.p.c.errorf("elastic: bulk processor %q failed but will retry in %v: %v", w.p.name, wait, err)
+		retries++
+
+		t := time.NewTimer(wait)
+		select {
+		case <-w.p.ctx.Done():
+			t.Stop()
+			return nil, w.p.ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
 func (w *bulkWorker) updateStats(res *BulkResponse) {
 	// Update stats
 	if res != nil {
@@ -5,8 +5,13 @@
 package elastic
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -327,6 +332,336 @@ func TestBulkProcessorFlush(t *testing.T) {
 	}
 }
 
+func TestBulkProcessorSpool(t *testing.T) {
+	//client := setupTestClientAndCreateIndexAndLog(t, SetTraceLog(log.New(os.Stdout, "", 0)))
+	client := setupTestClientAndCreateIndex(t)
+
+	dir, err := ioutil.TempDir("", "elastic-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Simulate requests left over from a crashed bulk processor
+	spool, _, err := openBulkSpool(dir, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 10; i++ {
+		tweet := tweet{User: "olivere", Message: fmt.Sprintf("%d. %s", i, randomString(rand.Intn(64)))}
+		request := NewBulkIndexRequest().Index(testIndexName).Type("tweet").Id(fmt.Sprintf("%d", i)).Doc(tweet)
+		if _, err := spoolRequest(spool, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := client.BulkProcessor().Name("Spool-1").Spool(dir).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 11; i <= 20; i++ {
+		tweet := tweet{User: "olivere", Message: fmt.Sprintf("%d. %s", i, randomString(rand.Intn(64)))}
+		request := NewBulkIndexRequest().Index(testIndexName).Type("tweet").Id(fmt.Sprintf("%d", i)).Doc(tweet)
+		p.Add(request)
+	}
+	err = p.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Spool must be empty after all requests have been committed
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected spool to be empty; got: %d files", len(files))
+	}
+
+	// Check number of documents that were bulk indexed
+	_, err = client.Flush(testIndexName).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := client.Count(testIndexName).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 20 {
+		t.Fatalf("expected %d documents; got: %d", 20, count)
+	}
+}
+
+func TestBulkProcessorSpoolFailure(t *testing.T) {
+	client, err := NewSimpleClient(SetURL("http://127.0.0.1:9"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "elastic-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := client.BulkProcessor().Name("Spool-2").Spool(dir).Stats(true).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the spool unwritable, so requests must be rejected
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	err = p.Add(NewBulkDeleteRequest().Index(testIndexName).Type("tweet").Id("1"))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if got, want := p.Stats().SpoolFailed, int64(1); got != want {
+		t.Errorf("expected SpoolFailed = %d; got %d", want, got)
+	}
+
+	uncommitted, err := p.CloseC(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uncommitted) != 0 {
+		t.Errorf("expected no uncommitted requests; got: %d", len(uncommitted))
+	}
+}
+
+func TestBulkProcessorSpoolRejectedRequests(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+	ts.Handle = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		fmt.Fprint(w, `{"took":1,"errors":true,"items":[`+
+			`{"delete":{"_id":"1","status":200}},`+
+			`{"delete":{"_id":"2","status":400,"error":"MapperParsingException[failed to parse]"}},`+
+			`{"delete":{"_id":"3","status":429,"error":"EsRejectedExecutionException[rejected execution]"}}]}`)
+	}
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "elastic-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var failed int
+	p, err := client.BulkProcessor().
+		Name("Spool-3").
+		BulkActions(-1).
+		BulkSize(-1).
+		Spool(dir).
+		Stats(true).
+		After(func(id int64, requests []BulkableRequest, res *BulkResponse, err error) {
+			if res != nil {
+				failed += len(res.Failed())
+			}
+		}).
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := p.Add(NewBulkDeleteRequest().Index(testIndexName).Type("tweet").Id(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := failed, 2; got != want {
+		t.Errorf("expected %d failed requests reported to After; got %d", want, got)
+	}
+	if got, want := p.Stats().SpoolFailed, int64(1); got != want {
+		t.Errorf("expected SpoolFailed = %d; got %d", want, got)
+	}
+
+	// Only the request that failed temporarily is left in the spool
+	_, entries, err := openBulkSpool(dir, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(entries), 1; got != want {
+		t.Fatalf("expected %d requests in spool; got %d", want, got)
+	}
+	if got, want := entries[0].request.String(), `{"delete":{"_id":"3","_index":"`+testIndexName+`","_type":"tweet"}}`; got != want {
+		t.Errorf("expected %s; got %s", want, got)
+	}
+}
+
+func TestBulkProcessorCloseWithDeadline(t *testing.T) {
+	// Elasticsearch is unavailable, so commits will fail and be retried
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"unavailable","status":503}`, http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := client.BulkProcessor().
+		Name("CloseC-1").
+		Workers(2).
+		BulkActions(-1).
+		BulkSize(-1).
+		Stats(true).
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const numDocs = 10
+	for i := 1; i <= numDocs; i++ {
+		tweet := tweet{User: "olivere", Message: fmt.Sprintf("%d. %s", i, randomString(rand.Intn(64)))}
+		request := NewBulkIndexRequest().Index(testIndexName).Type("tweet").Id(fmt.Sprintf("%d", i)).Doc(tweet)
+		p.Add(request)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	uncommitted, err := p.CloseC(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v; got: %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected CloseC to give up after the deadline; took %v", elapsed)
+	}
+	if got, want := len(uncommitted), numDocs; got != want {
+		t.Errorf("expected %d uncommitted requests; got: %d", want, got)
+	}
+
+	stats := p.Stats()
+	if !stats.ShutdownAborted {
+		t.Error("expected shutdown to be aborted")
+	}
+	if got, want := stats.ShutdownUncommitted, int64(numDocs); got != want {
+		t.Errorf("expected %d uncommitted requests in stats; got: %d", want, got)
+	}
+	if stats.ShutdownDuration <= 0 {
+		t.Errorf("expected shutdown duration > 0; got: %v", stats.ShutdownDuration)
+	}
+
+	// Closing again is a no-op
+	uncommitted, err = p.CloseC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uncommitted) != 0 {
+		t.Errorf("expected no uncommitted requests; got: %d", len(uncommitted))
+	}
+}
+
+func TestBulkProcessorRetries(t *testing.T) {
+	// Elasticsearch fails for the first two requests
+	var calls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) <= 2 {
+			http.Error(w, `{"error":"unavailable","status":503}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"took":1,"errors":false,"items":[{"index":{"_index":"elastic-test","_type":"tweet","_id":"1","_version":1,"status":201}}]}`)
+	}))
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failures int64
+	p, err := client.BulkProcessor().
+		Name("Retries-1").
+		BulkActions(-1).
+		BulkSize(-1).
+		Backoff(NewConstantBackoff(10 * time.Millisecond)).
+		Stats(true).
+		After(func(executionId int64, requests []BulkableRequest, response *BulkResponse, err error) {
+			if err != nil {
+				atomic.AddInt64(&failures, 1)
+			}
+		}).
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Add(NewBulkIndexRequest().Index(testIndexName).Type("tweet").Id("1").Doc(tweet{User: "olivere"}))
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := p.Stats()
+	if got, want := stats.Committed, int64(1); got != want {
+		t.Errorf("expected %d commits; got: %d", want, got)
+	}
+	if got, want := stats.Workers[0].Retries, int64(2); got != want {
+		t.Errorf("expected %d retries; got: %d", want, got)
+	}
+	if got, want := stats.Workers[0].LastRetries, int64(2); got != want {
+		t.Errorf("expected %d retries of last commit; got: %d", want, got)
+	}
+	if failures != 0 {
+		t.Errorf("expected 0 calls to failure callback; got: %d", failures)
+	}
+}
+
+func TestBulkProcessorMaxAttempts(t *testing.T) {
+	// Elasticsearch is unavailable
+	var calls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		http.Error(w, `{"error":"unavailable","status":503}`, http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failures int64
+	p, err := client.BulkProcessor().
+		Name("MaxAttempts-1").
+		BulkActions(-1).
+		BulkSize(-1).
+		Retrier(NewBackoffRetrier(ZeroBackoff{})).
+		MaxAttempts(3).
+		Stats(true).
+		After(func(executionId int64, requests []BulkableRequest, response *BulkResponse, err error) {
+			if err != nil {
+				atomic.AddInt64(&failures, 1)
+			}
+		}).
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Add(NewBulkIndexRequest().Index(testIndexName).Type("tweet").Id("1").Doc(tweet{User: "olivere"}))
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := atomic.LoadInt64(&calls), int64(3); got != want {
+		t.Errorf("expected %d attempts; got: %d", want, got)
+	}
+	if got, want := p.Stats().Workers[0].Retries, int64(2); got != want {
+		t.Errorf("expected %d retries; got: %d", want, got)
+	}
+	if got, want := failures, int64(1); got != want {
+		t.Errorf("expected %d calls to failure callback; got: %d", want, got)
+	}
+}
+
 // -- Helper --
 
 func testBulkProcessor(t *testing.T, numDocs int, svc *BulkProcessorService) {
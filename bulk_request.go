@@ -5,13 +5,140 @@
 package elastic
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 )
 
 // -- Bulkable request (index/update/delete) --
 
 // Generic interface to bulkable requests.
+//
+// Bulkable requests may additionally implement io.WriterTo to write their
+// on-wire representation, i.e. the lines returned by Source, each followed
+// by a newline, directly to a writer. BulkService and BulkProcessor use
+// this to avoid building intermediate strings.
 type BulkableRequest interface {
 	fmt.Stringer
 	Source() ([]string, error)
 }
+
+// writeBulkableRequest writes the on-wire representation of r to buf.
+// It uses io.WriterTo if implemented by r, and falls back to Source
+// otherwise. On error, buf is left unchanged.
+func writeBulkableRequest(buf *bytes.Buffer, r BulkableRequest) error {
+	n := buf.Len()
+	var err error
+	if w, ok := r.(io.WriterTo); ok {
+		_, err = w.WriteTo(buf)
+	} else {
+		var lines []string
+		lines, err = r.Source()
+		if err == nil {
+			_, err = writeBulkLines(buf, lines)
+		}
+	}
+	if err != nil {
+		buf.Truncate(n)
+	}
+	return err
+}
+
+// writeBulkLines writes the given lines to w, each followed by a newline.
+func writeBulkLines(w io.Writer, lines []string) (int64, error) {
+	var written int64
+	for _, line := range lines {
+		n, err := io.WriteString(w, line)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		n, err = w.Write(newline)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// writeBulkDoc writes the document of a bulk request to w, followed by
+// a newline. Strings and raw JSON messages are written as is, everything
+// else is serialized as JSON.
+func writeBulkDoc(w *countingWriter, doc interface{}) error {
+	var err error
+	switch t := doc.(type) {
+	default:
+		return json.NewEncoder(w).Encode(doc)
+	case json.RawMessage:
+		_, err = w.Write(t)
+	case *json.RawMessage:
+		_, err = w.Write(*t)
+	case string:
+		_, err = io.WriteString(w, t)
+	case *string:
+		_, err = io.WriteString(w, *t)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(newline)
+	return err
+}
+
+// writeBulkCommand writes the action-and-meta-data line of a bulk request
+// to w, e.g. {"index":{"_id":"1"}}, followed by a newline.
+func writeBulkCommand(w io.Writer, action string, meta *bulkRequestMetaData) error {
+	name, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	for _, p := range [][]byte{openBrace, name, colon, body, closeBraceNewline} {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	openBrace         = []byte{'{'}
+	colon             = []byte{':'}
+	closeBraceNewline = []byte{'}', '\n'}
+)
+
+var newline = []byte{'\n'}
+
+// countingWriter counts the number of bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// bulkRequestMetaData is the action-and-meta-data line of a bulk request,
+// i.e. the part in { "index" : { ... } }. Its fields are sorted by name
+// so that it serializes exactly like a map.
+type bulkRequestMetaData struct {
+	Id              string `json:"_id,omitempty"`
+	Index           string `json:"_index,omitempty"`
+	Parent          string `json:"_parent,omitempty"`
+	RetryOnConflict *int   `json:"_retry_on_conflict,omitempty"`
+	Routing         string `json:"_routing,omitempty"`
+	Timestamp       string `json:"_timestamp,omitempty"`
+	Ttl             int64  `json:"_ttl,omitempty"`
+	Type            string `json:"_type,omitempty"`
+	Version         int64  `json:"_version,omitempty"`
+	VersionType     string `json:"_version_type,omitempty"`
+	Refresh         *bool  `json:"refresh,omitempty"`
+}
@@ -0,0 +1,541 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultBulkSpoolSegmentSize is the size (in bytes) after which
+	// a spool segment is sealed and a new segment is started.
+	DefaultBulkSpoolSegmentSize = 64 << 20 // 64 MB
+
+	// bulkSpoolSegmentExt is the file extension of spool segments.
+	bulkSpoolSegmentExt = ".ndjson"
+
+	// bulkSpoolAckExt is the file extension of the files that record
+	// the committed requests of a segment.
+	bulkSpoolAckExt = ".ack"
+)
+
+// bulkSpool is a write-ahead log for bulk requests. It is used by
+// BulkProcessor to persist requests before they are handed to the workers,
+// and to forget about them after they have been committed successfully.
+//
+// The spool is a directory of segment files. Each segment contains the
+// on-wire representation of the bulk requests, i.e. the NDJSON lines
+// returned by BulkableRequest.Source. A segment is sealed when it exceeds
+// the maximum segment size, and it is removed once all of its requests
+// have been committed. Until then, the positions of its committed requests
+// are recorded in an ack file next to the segment, so that they are not
+// replayed when the spool is opened again.
+type bulkSpool struct {
+	dir         string
+	segmentSize int64
+	sync        bool
+
+	mu       sync.Mutex // guards the following block
+	nextId   int64
+	current  *bulkSpoolSegment
+	segments map[int64]*bulkSpoolSegment
+}
+
+// bulkSpoolSegment is a single file in a bulkSpool.
+type bulkSpoolSegment struct {
+	id      int64
+	path    string
+	f       *os.File // nil for segments that are only replayed
+	acks    *os.File // ack file; opened on the first commit
+	size    int64    // # of bytes written
+	n       int      // # of requests written
+	pending int      // # of requests not yet committed
+	sealed  bool     // true if no more requests will be written
+}
+
+// bulkSpoolRef refers to a request in a spool segment.
+type bulkSpoolRef struct {
+	segment *bulkSpoolSegment // nil if the request has not been spooled
+	pos     int               // position of the request in the segment
+}
+
+// openBulkSpool opens the spool in the given directory, creating the
+// directory if necessary. It returns the spool and all requests that
+// were found in the existing segments and need to be replayed.
+// Segments with committed requests are compacted first, so that only
+// requests that have not been committed are replayed.
+func openBulkSpool(dir string, segmentSize int64, sync bool) (*bulkSpool, []bulkSpoolEntry, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultBulkSpoolSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	s := &bulkSpool{
+		dir:         dir,
+		segmentSize: segmentSize,
+		sync:        sync,
+		segments:    make(map[int64]*bulkSpoolSegment),
+	}
+
+	ids, err := s.segmentIds()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ids) > 0 {
+		s.nextId = ids[len(ids)-1] + 1
+	}
+	var entries []bulkSpoolEntry
+	for _, id := range ids {
+		requests, err := readBulkSpoolSegment(s.segmentPath(id))
+		if err != nil {
+			return nil, nil, err
+		}
+		acked, err := readBulkSpoolAcks(s.ackPath(id))
+		if err != nil {
+			return nil, nil, err
+		}
+		var remaining []BulkableRequest
+		for i, r := range requests {
+			if !acked[i] {
+				remaining = append(remaining, r)
+			}
+		}
+		if len(remaining) == 0 {
+			if err := s.remove(id); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if len(remaining) < len(requests) {
+			if id, err = s.compact(id, remaining); err != nil {
+				return nil, nil, err
+			}
+		}
+		seg := &bulkSpoolSegment{
+			id:      id,
+			path:    s.segmentPath(id),
+			n:       len(remaining),
+			pending: len(remaining),
+			sealed:  true,
+		}
+		s.segments[id] = seg
+		for i, r := range remaining {
+			entries = append(entries, bulkSpoolEntry{request: r, ref: bulkSpoolRef{segment: seg, pos: i}})
+		}
+	}
+	return s, entries, nil
+}
+
+// compact writes the given requests of the segment with the given id
+// to a new segment, and removes the old segment and its ack file.
+// It returns the id of the new segment.
+func (s *bulkSpool) compact(id int64, requests []BulkableRequest) (int64, error) {
+	newId := s.nextId
+	path := s.segmentPath(newId)
+	tmp := path + ".tmp"
+	var buf bytes.Buffer
+	for _, r := range requests {
+		if err := writeBulkableRequest(&buf, r); err != nil {
+			return 0, err
+		}
+	}
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	s.nextId++
+	// If we crash before the old segment is removed, its remaining
+	// requests are replayed twice, which is fine for at-least-once.
+	if err := s.remove(id); err != nil {
+		return 0, err
+	}
+	return newId, nil
+}
+
+// remove deletes the segment with the given id and its ack file.
+func (s *bulkSpool) remove(id int64) error {
+	for _, path := range []string{s.segmentPath(id), s.ackPath(id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// segmentIds returns the sorted list of ids of all segments in the spool.
+func (s *bulkSpool) segmentIds() ([]int64, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, bulkSpoolSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(name, bulkSpoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Sort(int64Slice(ids))
+	return ids, nil
+}
+
+// segmentPath returns the file name of the segment with the given id.
+func (s *bulkSpool) segmentPath(id int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, bulkSpoolSegmentExt))
+}
+
+// ackPath returns the file name of the ack file of the segment
+// with the given id.
+func (s *bulkSpool) ackPath(id int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, bulkSpoolAckExt))
+}
+
+// Append writes the on-wire representation of a request, as serialized
+// by writeBulkableRequest, to the current segment and returns a reference
+// to the request in that segment.
+func (s *bulkSpool) Append(data []byte) (bulkSpoolRef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil {
+		if err := s.rotate(); err != nil {
+			return bulkSpoolRef{}, err
+		}
+	}
+	seg := s.current
+	n, err := seg.f.Write(data)
+	seg.size += int64(n)
+	if err == nil && s.sync {
+		err = seg.f.Sync()
+	}
+	if err != nil {
+		// Do not append to a segment that might end with a partial line.
+		s.current = nil
+		s.seal(seg)
+		return bulkSpoolRef{}, err
+	}
+	ref := bulkSpoolRef{segment: seg, pos: seg.n}
+	seg.n++
+	seg.pending++
+	if seg.size >= s.segmentSize {
+		if err := s.seal(seg); err != nil {
+			return bulkSpoolRef{}, err
+		}
+		s.current = nil
+	}
+	return ref, nil
+}
+
+// rotate starts a new segment. The caller must hold s.mu.
+func (s *bulkSpool) rotate() error {
+	id := s.nextId
+	path := s.segmentPath(id)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.nextId++
+	seg := &bulkSpoolSegment{id: id, path: path, f: f}
+	s.segments[id] = seg
+	s.current = seg
+	return nil
+}
+
+// seal closes the file of the given segment so that no more requests
+// are written to it. The caller must hold s.mu.
+func (s *bulkSpool) seal(seg *bulkSpoolSegment) error {
+	seg.sealed = true
+	if seg.f != nil {
+		err := seg.f.Close()
+		seg.f = nil
+		if err != nil {
+			return err
+		}
+	}
+	return s.truncate(seg)
+}
+
+// truncate removes the segment and its ack file if it is sealed and has
+// no pending requests. The caller must hold s.mu.
+func (s *bulkSpool) truncate(seg *bulkSpoolSegment) error {
+	if !seg.sealed || seg.pending > 0 {
+		return nil
+	}
+	delete(s.segments, seg.id)
+	if seg.acks != nil {
+		seg.acks.Close()
+		seg.acks = nil
+	}
+	return s.remove(seg.id)
+}
+
+// Commit marks the given requests as committed by recording them in
+// the ack files of their segments. Segments that are sealed and have
+// no more pending requests are removed from disk.
+func (s *bulkSpool) Commit(refs []bulkSpoolRef) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Group positions by segment, keeping the order of the segments
+	var segments []*bulkSpoolSegment
+	positions := make(map[*bulkSpoolSegment][]byte)
+	for _, ref := range refs {
+		if ref.segment == nil {
+			continue
+		}
+		if _, found := positions[ref.segment]; !found {
+			segments = append(segments, ref.segment)
+		}
+		positions[ref.segment] = strconv.AppendInt(positions[ref.segment], int64(ref.pos), 10)
+		positions[ref.segment] = append(positions[ref.segment], '\n')
+	}
+
+	var firstErr error
+	for _, seg := range segments {
+		if err := s.ack(seg, positions[seg]); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		seg.pending -= bytes.Count(positions[seg], []byte{'\n'})
+		if seg.pending < 0 {
+			seg.pending = 0
+		}
+		if err := s.truncate(seg); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ack appends the given lines of positions to the ack file of the
+// segment. The caller must hold s.mu.
+func (s *bulkSpool) ack(seg *bulkSpoolSegment, lines []byte) error {
+	if seg.pending <= bytes.Count(lines, []byte{'\n'}) && seg.sealed {
+		// The segment is about to be removed, no need to record acks
+		return nil
+	}
+	if seg.acks == nil {
+		f, err := os.OpenFile(s.ackPath(seg.id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		seg.acks = f
+	}
+	if _, err := seg.acks.Write(lines); err != nil {
+		return err
+	}
+	if s.sync {
+		return seg.acks.Sync()
+	}
+	return nil
+}
+
+// settleBulkSpool returns the spooled requests that are done, given the
+// response of the bulk request and the spool references of its requests
+// (in the same order). Requests are done if they succeeded or if they
+// failed permanently, e.g. due to a mapping error or a version conflict;
+// the number of the latter is returned as rejected. Requests that failed
+// temporarily, e.g. because Elasticsearch rejected the execution (429) or
+// a shard was unavailable (5xx), stay pending in the spool and are
+// replayed when the bulk processor is started again.
+//
+// If the response does not match the requests, all requests are done
+// if Elasticsearch reported no errors, and none are done otherwise.
+func settleBulkSpool(res *BulkResponse, refs []bulkSpoolRef) (done []bulkSpoolRef, rejected int) {
+	if res == nil {
+		return nil, 0
+	}
+	if len(res.Items) != len(refs) {
+		if res.Errors {
+			return nil, 0
+		}
+		return refs, 0
+	}
+	for i, item := range res.Items {
+		succeeded, retryable := len(item) > 0, len(item) == 0
+		for _, result := range item {
+			if result == nil || result.Status < 200 || result.Status > 299 {
+				succeeded = false
+				if result == nil || bulkStatusRetryable(result.Status) {
+					retryable = true
+				}
+			}
+		}
+		switch {
+		case succeeded:
+			done = append(done, refs[i])
+		case !retryable:
+			done = append(done, refs[i])
+			rejected++
+		}
+	}
+	return done, rejected
+}
+
+// bulkStatusRetryable returns true if a bulk item that failed with the
+// given HTTP status code might succeed when it is sent again.
+func bulkStatusRetryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// Close seals the current segment. Segments with pending requests are
+// kept on disk and will be replayed the next time the spool is opened.
+func (s *bulkSpool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil {
+		return nil
+	}
+	seg := s.current
+	s.current = nil
+	return s.seal(seg)
+}
+
+// bulkSpoolEntry is a request that has been written to a segment.
+type bulkSpoolEntry struct {
+	request BulkableRequest
+	ref     bulkSpoolRef
+	data    []byte // on-wire representation of request (nil if replayed)
+}
+
+// readBulkSpoolAcks reads the positions of the committed requests from
+// the ack file at path. A missing file means that no request has been
+// committed, and a trailing, incomplete line is ignored.
+func readBulkSpoolAcks(path string) (map[int]bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	acked := make(map[int]bool)
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if pos, err := strconv.Atoi(strings.TrimSuffix(line, "\n")); err == nil {
+			acked[pos] = true
+		}
+	}
+	return acked, nil
+}
+
+// readBulkSpoolSegment reads all requests from the segment file at path.
+// A trailing, incomplete line (e.g. due to a crash while writing) is
+// silently dropped, as is a request without its source line.
+func readBulkSpoolSegment(path string) ([]BulkableRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var requests []BulkableRequest
+	r := bufio.NewReader(f)
+	var pending *BulkSpooledRequest
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			// Incomplete (or no) line at the end of the segment
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if pending != nil {
+			// Source line of an index, create, or update request
+			pending.lines = append(pending.lines, line)
+			requests = append(requests, pending)
+			pending = nil
+			continue
+		}
+
+		var command map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &command); err != nil {
+			return nil, fmt.Errorf("elastic: invalid line in bulk spool segment %s: %v", path, err)
+		}
+		req := &BulkSpooledRequest{lines: []string{line}}
+		if _, found := command["delete"]; found {
+			requests = append(requests, req)
+		} else {
+			pending = req
+		}
+	}
+	return requests, nil
+}
+
+// -- Spooled request --
+
+// BulkSpooledRequest is a bulk request that has been restored from the
+// spool of a BulkProcessor. It is passed to the Before and After callbacks
+// of a BulkProcessor for requests that have been replayed on Start.
+type BulkSpooledRequest struct {
+	lines []string
+}
+
+// String returns the on-wire representation of the request,
+// concatenated as a single string.
+func (r *BulkSpooledRequest) String() string {
+	return strings.Join(r.lines, "\n")
+}
+
+// Source returns the on-wire representation of the request as it
+// was written to the spool.
+func (r *BulkSpooledRequest) Source() ([]string, error) {
+	return r.lines, nil
+}
+
+// -- Sort helper --
+
+type int64Slice []int64
+
+func (p int64Slice) Len() int           { return len(p) }
+func (p int64Slice) Less(i, j int) bool { return p[i] < p[j] }
+func (p int64Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,254 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBulkSpoolAppendAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elastic-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, entries, err := openBulkSpool(dir, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no requests to replay; got: %d", len(entries))
+	}
+
+	requests := []BulkableRequest{
+		NewBulkIndexRequest().Index("index1").Type("tweet").Id("1").Doc(tweet{User: "olivere", Message: "Welcome to Golang and Elasticsearch."}),
+		NewBulkDeleteRequest().Index("index1").Type("tweet").Id("2"),
+		NewBulkUpdateRequest().Index("index1").Type("tweet").Id("3").Doc(struct {
+			Retweets int `json:"retweets"`
+		}{Retweets: 42}),
+	}
+	var refs []bulkSpoolRef
+	for _, r := range requests {
+		ref, err := spoolRequest(spool, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+
+	// Commit the second request only, then simulate a crash
+	if err := spool.Commit(refs[1:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the requests that have not been committed must be replayed
+	spool, entries, err = openBulkSpool(dir, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BulkableRequest{requests[0], requests[2]}
+	if got, want := len(entries), len(expected); got != want {
+		t.Fatalf("expected %d requests to replay; got: %d", want, got)
+	}
+	for i, entry := range entries {
+		if got, want := entry.request.String(), expected[i].String(); got != want {
+			t.Errorf("expected request #%d to be %s; got: %s", i, want, got)
+		}
+	}
+
+	// The segment has been compacted, so committing the replayed
+	// requests removes it from disk
+	if err := spool.Commit([]bulkSpoolRef{entries[0].ref, entries[1].ref}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected spool to be empty; got: %d files", len(files))
+	}
+}
+
+func TestBulkSpoolRemovesCommittedSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elastic-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Use a tiny segment size so that every request starts a new segment
+	spool, _, err := openBulkSpool(dir, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refs []bulkSpoolRef
+	for i := 0; i < 3; i++ {
+		ref, err := spoolRequest(spool, NewBulkDeleteRequest().Index("index1").Type("tweet").Id("1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+	ids, err := spool.segmentIds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(ids), 3; got != want {
+		t.Fatalf("expected %d segments; got: %d", want, got)
+	}
+
+	if err := spool.Commit(refs); err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected spool to be empty; got: %d files", len(files))
+	}
+}
+
+func TestBulkSpoolIgnoresIncompleteRequests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elastic-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool, _, err := openBulkSpool(dir, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := `{"delete":{"_id":"1","_index":"index1","_type":"tweet"}}` + "\n" +
+		`{"index":{"_id":"2","_index":"index1","_type":"tweet"}}` + "\n" +
+		`{"user":"olivere","mess`
+	if err := ioutil.WriteFile(spool.segmentPath(0), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, entries, err := openBulkSpool(dir, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(entries), 1; got != want {
+		t.Fatalf("expected %d requests to replay; got: %d", want, got)
+	}
+	if got, want := entries[0].request.String(), `{"delete":{"_id":"1","_index":"index1","_type":"tweet"}}`; got != want {
+		t.Errorf("expected %s; got: %s", want, got)
+	}
+}
+
+func TestBulkSpoolSettle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elastic-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// All requests go into the same segment
+	spool, _, err := openBulkSpool(dir, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refs []bulkSpoolRef
+	for i := 1; i <= 5; i++ {
+		ref, err := spoolRequest(spool, NewBulkDeleteRequest().Index("index1").Type("tweet").Id(fmt.Sprint(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+
+	res := &BulkResponse{
+		Errors: true,
+		Items: []map[string]*BulkResponseItem{
+			{"delete": {Status: 200}},
+			{"delete": {Status: 429}},
+			{"delete": {Status: 404}},
+			{"delete": {Status: 400, Error: "MapperParsingException[failed to parse]"}},
+			{"delete": {Status: 503}},
+		},
+	}
+	done, rejected := settleBulkSpool(res, refs)
+	if got, want := len(done), 3; got != want {
+		t.Fatalf("expected %d done requests; got: %d", want, got)
+	}
+	if got, want := rejected, 2; got != want {
+		t.Errorf("expected %d rejected requests; got: %d", want, got)
+	}
+	if err := spool.Commit(done); err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the requests that failed temporarily are replayed
+	spool, entries, err := openBulkSpool(dir, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.request.String())
+	}
+	expected := []string{
+		`{"delete":{"_id":"2","_index":"index1","_type":"tweet"}}`,
+		`{"delete":{"_id":"5","_index":"index1","_type":"tweet"}}`,
+	}
+	if got, want := strings.Join(ids, "\n"), strings.Join(expected, "\n"); got != want {
+		t.Fatalf("expected requests to replay\n%s\ngot\n%s", want, got)
+	}
+
+	// Once they succeed, the spool is empty
+	res = &BulkResponse{
+		Items: []map[string]*BulkResponseItem{
+			{"delete": {Status: 200}},
+			{"delete": {Status: 200}},
+		},
+	}
+	done, rejected = settleBulkSpool(res, []bulkSpoolRef{entries[0].ref, entries[1].ref})
+	if got, want := len(done), 2; got != want {
+		t.Fatalf("expected %d done requests; got: %d", want, got)
+	}
+	if err := spool.Commit(done); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected spool to be empty; got: %d files", len(files))
+	}
+
+	// Without a matching response, requests are only done without errors
+	if done, _ := settleBulkSpool(&BulkResponse{Errors: true}, refs); len(done) != 0 {
+		t.Errorf("expected no done requests; got: %d", len(done))
+	}
+	if done, _ := settleBulkSpool(&BulkResponse{}, refs); len(done) != len(refs) {
+		t.Errorf("expected %d done requests; got: %d", len(refs), len(done))
+	}
+}
+
+// spoolRequest serializes r and appends it to spool, like BulkProcessor.Add.
+func spoolRequest(spool *bulkSpool, r BulkableRequest) (bulkSpoolRef, error) {
+	var buf bytes.Buffer
+	if err := writeBulkableRequest(&buf, r); err != nil {
+		return bulkSpoolRef{}, err
+	}
+	return spool.Append(buf.Bytes())
+}
@@ -6,6 +6,8 @@ package elastic
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -369,6 +371,115 @@ func TestFailedBulkRequests(t *testing.T) {
 	}
 }
 
+func TestBulkResponseFailures(t *testing.T) {
+	js := `{
+  "took" : 2,
+  "errors" : true,
+  "items" : [ {
+    "index" : {
+      "_index" : "elastic-test",
+      "_type" : "tweet",
+      "_id" : "1",
+      "_version" : 1,
+      "status" : 201
+    }
+  }, {
+    "index" : {
+      "_index" : "elastic-test",
+      "_type" : "tweet",
+      "_id" : "2",
+      "status" : 400,
+      "error" : "MapperParsingException[failed to parse [retweets]]; nested: NumberFormatException[For input string: \"many\"]; "
+    }
+  }, {
+    "index" : {
+      "_index" : "elastic-test2",
+      "_type" : "tweet",
+      "_id" : "3",
+      "status" : 400,
+      "error" : "MapperParsingException[failed to parse [created]]"
+    }
+  }, {
+    "delete" : {
+      "_index" : "elastic-test",
+      "_type" : "tweet",
+      "_id" : "4",
+      "_version" : 2,
+      "status" : 404,
+      "found" : false
+    }
+  } ]
+}`
+
+	var resp BulkResponse
+	err := json.Unmarshal([]byte(js), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.requests = []BulkableRequest{
+		NewBulkIndexRequest().Index("elastic-test").Type("tweet").Id("1"),
+		NewBulkIndexRequest().Index("elastic-test").Type("tweet").Id("2"),
+		NewBulkIndexRequest().Index("elastic-test2").Type("tweet").Id("3"),
+		NewBulkDeleteRequest().Index("elastic-test").Type("tweet").Id("4"),
+	}
+
+	failures := resp.Failures()
+	if got, want := len(failures), 3; got != want {
+		t.Fatalf("expected %d failures; got: %d", want, got)
+	}
+	for i, pos := range []int{1, 2, 3} {
+		if got, want := failures[i].Position, pos; got != want {
+			t.Errorf("expected failure #%d at position %d; got: %d", i, want, got)
+		}
+		if got, want := failures[i].Request, resp.requests[pos]; got != want {
+			t.Errorf("expected failure #%d to have request %v; got: %v", i, want, got)
+		}
+	}
+	if got, want := failures[2].Action, "delete"; got != want {
+		t.Errorf("expected action %q; got: %q", want, got)
+	}
+	if err, ok := failures[0].Item.Err().(*Error); !ok || err.Status != 400 {
+		t.Errorf("expected *Error with status 400; got: %v", failures[0].Item.Err())
+	}
+	if err := resp.Items[0]["index"].Err(); err != nil {
+		t.Errorf("expected no error; got: %v", err)
+	}
+
+	sum := resp.Summary()
+	if got, want := sum.Total, 4; got != want {
+		t.Errorf("expected %d items; got: %d", want, got)
+	}
+	if got, want := sum.Succeeded, 1; got != want {
+		t.Errorf("expected %d succeeded items; got: %d", want, got)
+	}
+	if got, want := sum.Failed, 3; got != want {
+		t.Errorf("expected %d failed items; got: %d", want, got)
+	}
+	if got, want := sum.FailedByType["MapperParsingException"], 2; got != want {
+		t.Errorf("expected %d MapperParsingExceptions; got: %d", want, got)
+	}
+	if got, want := sum.FailedByType["Not Found"], 1; got != want {
+		t.Errorf("expected %d Not Found errors; got: %d", want, got)
+	}
+	if got, want := sum.FailedByStatus[400], 2; got != want {
+		t.Errorf("expected %d failures with status 400; got: %d", want, got)
+	}
+	if got, want := sum.FailedByIndex["elastic-test"], 2; got != want {
+		t.Errorf("expected %d failures in index elastic-test; got: %d", want, got)
+	}
+
+	err = resp.Err()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if got, want := err.Error(), "elastic: 3 of 4 bulk requests failed: MapperParsingException (2), Not Found (1)"; got != want {
+		t.Errorf("expected %q; got: %q", want, got)
+	}
+	if _, ok := err.(*BulkError); !ok {
+		t.Errorf("expected *BulkError; got: %T", err)
+	}
+}
+
 func TestBulkEstimatedSizeInBytes(t *testing.T) {
 	client := setupTestClientAndCreateIndex(t)
 
@@ -425,6 +536,81 @@ func TestBulkEstimateSizeInBytesLength(t *testing.T) {
 	}
 }
 
+func TestBulkBodyMatchesSource(t *testing.T) {
+	s := NewBulkService(nil)
+	requests := []BulkableRequest{
+		NewBulkIndexRequest().Index(testIndexName).Type("tweet").Id("1").Doc(tweet{User: "olivere", Message: "<Welcome> & goodbye"}),
+		NewBulkIndexRequest().OpType("create").Index(testIndexName).Type("tweet").Id("2").Doc(json.RawMessage(`{"user":"sandrae"}`)),
+		NewBulkIndexRequest().Index(testIndexName).Type("tweet").Id("3").Routing("r").Parent("p").Version(3).VersionType("external").Refresh(true),
+		NewBulkDeleteRequest().Index(testIndexName).Type("tweet").Id("1").Version(2),
+		NewBulkUpdateRequest().Index(testIndexName).Type("tweet").Id("2").RetryOnConflict(3).Doc(struct {
+			Retweets int `json:"retweets"`
+		}{
+			Retweets: 42,
+		}),
+		NewBulkUpdateRequest().Index(testIndexName).Type("tweet").Id("2").Script("ctx._source.retweets += n").ScriptParams(map[string]interface{}{"n": 1}),
+	}
+
+	var want string
+	for _, r := range requests {
+		s.Add(r)
+		lines, err := r.Source()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range lines {
+			want += line + "\n"
+		}
+	}
+
+	got, err := s.bodyAsString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("expected body\n%s\ngot:\n%s", want, got)
+	}
+	if got, want := s.EstimatedSizeInBytes(), int64(len(want)); got != want {
+		t.Errorf("expected EstimatedSizeInBytes = %d; got: %d", want, got)
+	}
+	s.reset()
+	if got, want := s.EstimatedSizeInBytes(), int64(0); got != want {
+		t.Errorf("expected EstimatedSizeInBytes = %d; got: %d", want, got)
+	}
+}
+
+func TestBulkTakeSerialized(t *testing.T) {
+	s := NewBulkService(nil)
+	requests := []BulkableRequest{
+		NewBulkIndexRequest().Index(testIndexName).Type("tweet").Id("1").Doc(tweet{User: "olivere"}),
+		NewBulkDeleteRequest().Index(testIndexName).Type("tweet").Id("2"),
+	}
+	s.Add(requests...)
+
+	got, data, err := s.takeSerialized()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(got), len(requests); got != want {
+		t.Fatalf("expected %d requests; got: %d", want, got)
+	}
+	if got, want := s.NumberOfActions(), 0; got != want {
+		t.Errorf("expected NumberOfActions = %d; got: %d", want, got)
+	}
+
+	// Adding to the service must not change the returned data
+	s.Add(NewBulkDeleteRequest().Index(testIndexName).Type("tweet").Id("3"))
+	for i, r := range requests {
+		lines, err := r.Source()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(data[i]), strings.Join(lines, "\n")+"\n"; got != want {
+			t.Errorf("expected request #%d to be\n%s\ngot:\n%s", i, want, got)
+		}
+	}
+}
+
 var benchmarkBulkEstimatedSizeInBytes int64
 
 func BenchmarkBulkEstimatedSizeInBytesWith1Request(b *testing.B) {
@@ -458,3 +644,31 @@ func BenchmarkBulkEstimatedSizeInBytesWith100Requests(b *testing.B) {
 	b.ReportAllocs()
 	benchmarkBulkEstimatedSizeInBytes = result // ensure the compiler doesn't optimize
 }
+
+// benchmarkBulkIngestDocs is the number of documents to serialize
+// in the ingest benchmarks below, committing every 1000 requests.
+const benchmarkBulkIngestDocs = 1000000
+
+var benchmarkBulkIngestResult int64
+
+// BenchmarkBulkIngest serializes documents via BulkService, committing
+// every 1000 requests. It only uses API that predates serializing requests
+// into a buffer, so it can be compared against older revisions.
+func BenchmarkBulkIngest(b *testing.B) {
+	var result int64
+	s := NewBulkService(nil)
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < benchmarkBulkIngestDocs; i++ {
+			r := NewBulkIndexRequest().Index(testIndexName).Type("tweet").Id(strconv.Itoa(i)).
+				Doc(tweet{User: "olivere", Message: "Welcome to Golang and Elasticsearch."})
+			s.Add(r)
+			if s.NumberOfActions() == 1000 {
+				body, _ := s.bodyAsString()
+				result += int64(len(body)) + s.EstimatedSizeInBytes()
+				s.reset()
+			}
+		}
+	}
+	b.ReportAllocs()
+	benchmarkBulkIngestResult = result // ensure the compiler doesn't optimize
+}
@@ -5,8 +5,9 @@
 package elastic
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
+	"io"
 	"strings"
 )
 
@@ -193,25 +194,6 @@ func (r *BulkUpdateRequest) String() string {
 	return strings.Join(lines, "\n")
 }
 
-func (r *BulkUpdateRequest) getSourceAsString(data interface{}) (string, error) {
-	switch t := data.(type) {
-	default:
-		body, err := json.Marshal(data)
-		if err != nil {
-			return "", err
-		}
-		return string(body), nil
-	case json.RawMessage:
-		return string(t), nil
-	case *json.RawMessage:
-		return string(*t), nil
-	case string:
-		return t, nil
-	case *string:
-		return *t, nil
-	}
-}
-
 // Source returns the on-wire representation of the update request,
 // split into an action-and-meta-data line and an (optional) source line.
 // See https://www.elastic.co/guide/en/elasticsearch/reference/1.7/docs-bulk.html
@@ -227,50 +209,50 @@ func (r BulkUpdateRequest) Source() ([]string, error) {
 		return r.source, nil
 	}
 
-	lines := make([]string, 2)
-
-	// "update" ...
-	command := make(map[string]interface{})
-	updateCommand := make(map[string]interface{})
-	if r.index != "" {
-		updateCommand["_index"] = r.index
-	}
-	if r.typ != "" {
-		updateCommand["_type"] = r.typ
-	}
-	if r.id != "" {
-		updateCommand["_id"] = r.id
-	}
-	if r.routing != "" {
-		updateCommand["_routing"] = r.routing
+	var buf bytes.Buffer
+	if _, err := r.writeTo(&buf); err != nil {
+		return nil, err
 	}
-	if r.parent != "" {
-		updateCommand["_parent"] = r.parent
+	lines := strings.SplitN(strings.TrimSuffix(buf.String(), "\n"), "\n", 2)
+
+	r.source = lines
+	return lines, nil
+}
+
+// WriteTo writes the on-wire representation of the update request to w,
+// i.e. the lines returned by Source, each followed by a newline.
+// It implements the io.WriterTo interface.
+func (r *BulkUpdateRequest) WriteTo(w io.Writer) (int64, error) {
+	if r.source != nil {
+		return writeBulkLines(w, r.source)
 	}
-	if r.timestamp != "" {
-		updateCommand["_timestamp"] = r.timestamp
+	return r.writeTo(w)
+}
+
+func (r *BulkUpdateRequest) writeTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	// "update" ...
+	meta := &bulkRequestMetaData{
+		Index:           r.index,
+		Type:            r.typ,
+		Id:              r.id,
+		Routing:         r.routing,
+		Parent:          r.parent,
+		Timestamp:       r.timestamp,
+		VersionType:     r.versionType,
+		Refresh:         r.refresh,
+		RetryOnConflict: r.retryOnConflict,
 	}
 	if r.ttl > 0 {
-		updateCommand["_ttl"] = r.ttl
+		meta.Ttl = r.ttl
 	}
 	if r.version > 0 {
-		updateCommand["_version"] = r.version
+		meta.Version = r.version
 	}
-	if r.versionType != "" {
-		updateCommand["_version_type"] = r.versionType
+	if err := writeBulkCommand(cw, "update", meta); err != nil {
+		return cw.n, err
 	}
-	if r.refresh != nil {
-		updateCommand["refresh"] = *r.refresh
-	}
-	if r.retryOnConflict != nil {
-		updateCommand["_retry_on_conflict"] = *r.retryOnConflict
-	}
-	command["update"] = updateCommand
-	line, err := json.Marshal(command)
-	if err != nil {
-		return nil, err
-	}
-	lines[0] = string(line)
 
 	// 2nd line: {"doc" : { ... }} or {"script": {...}}
 	source := make(map[string]interface{})
@@ -298,11 +280,6 @@ func (r BulkUpdateRequest) Source() ([]string, error) {
 			source["params"] = r.scriptParams
 		}
 	}
-	lines[1], err = r.getSourceAsString(source)
-	if err != nil {
-		return nil, err
-	}
-
-	r.source = lines
-	return lines, nil
+	err := writeBulkDoc(cw, source)
+	return cw.n, err
 }
@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -1129,9 +1130,10 @@ func (c *Client) PerformRequestC(ctx context.Context, method, path string, param
 		// Get response
 		res, err := c.c.Do(((*http.Request)(req)).WithContext(ctx))
 		if err != nil {
-			// Return ctx error if available, so we can compare it
+			// Return ctx error if available, so we can compare it.
+			// The node is not dead just because the caller gave up.
 			if ctx.Err() != nil {
-				err = ctx.Err()
+				return nil, ctx.Err()
 			}
 			n++
 			wait, ok, rerr := c.retrier.Retry(n, (*http.Request)(req), res, err)
@@ -1293,6 +1295,12 @@ func (c *Client) Update() *UpdateService {
 	return builder
 }
 
+// OptimisticUpdate modifies a document in Go with optimistic
+// concurrency control, retrying on version conflicts.
+func (c *Client) OptimisticUpdate() *OptimisticUpdateService {
+	return NewOptimisticUpdateService(c)
+}
+
 // Delete a document.
 func (c *Client) Delete() *DeleteService {
 	builder := NewDeleteService(c)
@@ -1317,6 +1325,12 @@ func (c *Client) MultiGet() *MultiGetService {
 	return builder
 }
 
+// MultiGetLoader returns a loader that coalesces concurrent requests
+// for single documents into multi get requests.
+func (c *Client) MultiGetLoader() *MultiGetLoader {
+	return NewMultiGetLoader(c)
+}
+
 // FieldStats returns statistical information about fields in indices
 func (c *Client) FieldStats(indices ...string) *FieldStatsService {
 	return NewFieldStatsService(c).Index(indices...)
@@ -1547,6 +1561,29 @@ func (c *Client) Reindex(sourceIndex, targetIndex string) *Reindexer {
 	return NewReindexer(c, sourceIndex, CopyToTargetIndex(targetIndex))
 }
 
+// Dump returns a service that writes an index, including its settings,
+// mappings, and aliases, into a gzip-compressed NDJSON archive.
+func (c *Client) Dump(index string) *IndexDumpService {
+	return NewIndexDumpService(c).Index(index)
+}
+
+// Restore returns a service that restores an index from an archive
+// written by Dump.
+func (c *Client) Restore(r io.Reader) *IndexRestoreService {
+	return NewIndexRestoreService(c).Reader(r)
+}
+
+// Diff returns a service that compares the documents of two indices.
+func (c *Client) Diff(sourceIndex, targetIndex string) *IndexDiff {
+	return NewIndexDiff(c, sourceIndex, targetIndex)
+}
+
+// Migrate returns a service that moves an alias to a new target index
+// without downtime, copying all documents of the indices behind the alias.
+func (c *Client) Migrate(alias, targetIndex string) *IndexMigration {
+	return NewIndexMigration(c, alias, targetIndex)
+}
+
 // WaitForStatus waits for the cluster to have the given status.
 // This is a shortcut method for the ClusterHealth service.
 //
@@ -0,0 +1,96 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+// esdump dumps an Elasticsearch index into a gzip-compressed NDJSON
+// archive, and restores an index from such an archive.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	elastic "gopkg.in/olivere/elastic.v2"
+)
+
+var (
+	nodes   = flag.String("nodes", "http://127.0.0.1:9200", "comma-separated list of ES URLs (e.g. 'http://192.168.2.10:9200,http://192.168.2.11:9200')")
+	index   = flag.String("index", "", "name of the index to dump, or to restore into (defaults to the index in the archive)")
+	file    = flag.String("f", "", "archive file (defaults to <index>.ndjson.gz when dumping)")
+	size    = flag.Int("size", 100, "number of documents per shard and scroll request when dumping")
+	workers = flag.Int("workers", 2, "number of bulk workers when restoring")
+	create  = flag.Bool("create", true, "create the index when restoring")
+	sniff   = flag.Bool("sniff", elastic.DefaultSnifferEnabled, "enable or disable sniffer")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] dump|restore\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client, err := elastic.NewClient(
+		elastic.SetURL(strings.Split(*nodes, ",")...),
+		elastic.SetSniff(*sniff),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch flag.Arg(0) {
+	case "dump":
+		dump(client)
+	case "restore":
+		restore(client)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func dump(client *elastic.Client) {
+	if *index == "" {
+		log.Fatal("no index specified")
+	}
+	name := *file
+	if name == "" {
+		name = *index + ".ndjson.gz"
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := client.Dump(*index).Writer(f).Size(*size).Do()
+	if err != nil {
+		f.Close()
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("dumped %d documents of index %s to %s", res.Documents, res.Index, name)
+}
+
+func restore(client *elastic.Client) {
+	if *file == "" {
+		log.Fatal("no archive file specified")
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	res, err := client.Restore(f).Index(*index).CreateIndex(*create).Workers(*workers).Do()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("restored %d of %d documents into index %s (%d failed)", res.Succeeded, res.Documents, res.Index, res.Failed)
+}
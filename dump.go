@@ -0,0 +1,398 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// An index archive, as written by IndexDumpService and read by
+// IndexRestoreService, is a gzip-compressed file of newline-delimited
+// JSON. The first line describes the index:
+//
+//	{"index":{"name":"twitter","settings":{...},"mappings":{...},"aliases":{...}}}
+//
+// Every following line contains a single document:
+//
+//	{"doc":{"_type":"tweet","_id":"1","_routing":"...","_parent":"...","_source":{...}}}
+
+// indexArchiveLine is a single line of an index archive.
+type indexArchiveLine struct {
+	Index *indexArchiveIndex `json:"index,omitempty"`
+	Doc   *indexArchiveDoc   `json:"doc,omitempty"`
+}
+
+// indexArchiveIndex describes the index of an archive.
+type indexArchiveIndex struct {
+	Name     string                 `json:"name"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
+	Mappings map[string]interface{} `json:"mappings,omitempty"`
+	Aliases  map[string]interface{} `json:"aliases,omitempty"`
+}
+
+// indexArchiveDoc is a document of an archive.
+type indexArchiveDoc struct {
+	Type    string           `json:"_type"`
+	Id      string           `json:"_id"`
+	Routing string           `json:"_routing,omitempty"`
+	Parent  string           `json:"_parent,omitempty"`
+	Source  *json.RawMessage `json:"_source"`
+}
+
+// -- Dump --
+
+// IndexDumpService writes the settings, mappings, aliases, and all
+// documents of an index into a gzip-compressed NDJSON archive.
+// Use IndexRestoreService to restore the archive.
+type IndexDumpService struct {
+	client    *Client
+	index     string
+	writer    io.Writer
+	query     Query
+	size      int
+	keepAlive string
+}
+
+// NewIndexDumpService creates a new IndexDumpService.
+func NewIndexDumpService(client *Client) *IndexDumpService {
+	return &IndexDumpService{client: client}
+}
+
+// Index sets the name of the index (or alias) to dump.
+func (s *IndexDumpService) Index(index string) *IndexDumpService {
+	s.index = index
+	return s
+}
+
+// Writer sets the writer to write the archive to.
+func (s *IndexDumpService) Writer(w io.Writer) *IndexDumpService {
+	s.writer = w
+	return s
+}
+
+// Query restricts the documents to dump. By default, all documents are dumped.
+func (s *IndexDumpService) Query(query Query) *IndexDumpService {
+	s.query = query
+	return s
+}
+
+// Size is the number of documents to fetch per shard and scroll request.
+func (s *IndexDumpService) Size(size int) *IndexDumpService {
+	s.size = size
+	return s
+}
+
+// KeepAlive sets the maximum time the scroll will be available
+// before expiration (e.g. "5m" for 5 minutes).
+func (s *IndexDumpService) KeepAlive(keepAlive string) *IndexDumpService {
+	s.keepAlive = keepAlive
+	return s
+}
+
+// Validate checks if the operation is valid.
+func (s *IndexDumpService) Validate() error {
+	if s.index == "" {
+		return ErrMissingIndex
+	}
+	if s.writer == nil {
+		return errors.New("elastic: writer is missing")
+	}
+	return nil
+}
+
+// IndexDumpResponse is the response of IndexDumpService.Do.
+type IndexDumpResponse struct {
+	Index     string // name of the index dumped
+	Documents int64  // number of documents dumped
+}
+
+// Do runs DoC() with default context.
+func (s *IndexDumpService) Do() (*IndexDumpResponse, error) {
+	return s.DoC(nil)
+}
+
+// DoC writes the archive. It does not close the writer.
+func (s *IndexDumpService) DoC(ctx context.Context) (*IndexDumpResponse, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	indices, err := s.client.IndexGet().Index(s.index).DoC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(indices) != 1 {
+		return nil, fmt.Errorf("elastic: expected %q to resolve to a single index; got %d", s.index, len(indices))
+	}
+	ret := new(IndexDumpResponse)
+	header := new(indexArchiveIndex)
+	for name, info := range indices {
+		ret.Index = name
+		header.Name = name
+		header.Settings = info.Settings
+		header.Mappings = info.Mappings
+		header.Aliases = info.Aliases
+	}
+
+	zw := gzip.NewWriter(s.writer)
+	bw := bufio.NewWriter(zw)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(&indexArchiveLine{Index: header}); err != nil {
+		return ret, err
+	}
+
+	scan := s.client.Scan(ret.Index).Fields("_source", "_parent", "_routing")
+	if s.query != nil {
+		scan = scan.Query(s.query)
+	}
+	if s.size > 0 {
+		scan = scan.Size(s.size)
+	}
+	if s.keepAlive != "" {
+		scan = scan.KeepAlive(s.keepAlive)
+	}
+	it := scan.Hits(ctx)
+	defer it.Close()
+	for it.Next() {
+		hit := it.Hit()
+		doc := &indexArchiveDoc{
+			Type:   hit.Type,
+			Id:     hit.Id,
+			Source: hit.Source,
+		}
+		if routing, ok := hit.Fields["_routing"].(string); ok {
+			doc.Routing = routing
+		}
+		if parent, ok := hit.Fields["_parent"].(string); ok {
+			doc.Parent = parent
+		}
+		if err := enc.Encode(&indexArchiveLine{Doc: doc}); err != nil {
+			return ret, err
+		}
+		ret.Documents++
+	}
+	if err := it.Err(); err != nil {
+		return ret, err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return ret, err
+	}
+	if err := zw.Close(); err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// -- Restore --
+
+// IndexRestoreService restores an archive written by IndexDumpService.
+// It creates the index with the settings, mappings, and aliases from the
+// archive, and indexes all documents with a BulkProcessor.
+type IndexRestoreService struct {
+	client      *Client
+	reader      io.Reader
+	index       string
+	createIndex bool
+	aliases     bool
+	workers     int
+	bulkActions int
+}
+
+// NewIndexRestoreService creates a new IndexRestoreService.
+func NewIndexRestoreService(client *Client) *IndexRestoreService {
+	return &IndexRestoreService{
+		client:      client,
+		createIndex: true,
+		aliases:     true,
+		workers:     1,
+		bulkActions: 1000,
+	}
+}
+
+// Reader sets the reader to read the archive from.
+func (s *IndexRestoreService) Reader(r io.Reader) *IndexRestoreService {
+	s.reader = r
+	return s
+}
+
+// Index sets the name of the index to restore into. By default,
+// the name of the index in the archive is used.
+func (s *IndexRestoreService) Index(index string) *IndexRestoreService {
+	s.index = index
+	return s
+}
+
+// CreateIndex specifies whether to create the index (default: true).
+// Set to false to restore the documents into an existing index.
+func (s *IndexRestoreService) CreateIndex(createIndex bool) *IndexRestoreService {
+	s.createIndex = createIndex
+	return s
+}
+
+// Aliases specifies whether to restore the aliases of the index
+// (default: true). It only applies if the index is created.
+func (s *IndexRestoreService) Aliases(aliases bool) *IndexRestoreService {
+	s.aliases = aliases
+	return s
+}
+
+// Workers sets the number of workers of the BulkProcessor (default: 1).
+func (s *IndexRestoreService) Workers(workers int) *IndexRestoreService {
+	s.workers = workers
+	return s
+}
+
+// BulkActions sets the number of documents per bulk request (default: 1000).
+func (s *IndexRestoreService) BulkActions(bulkActions int) *IndexRestoreService {
+	s.bulkActions = bulkActions
+	return s
+}
+
+// Validate checks if the operation is valid.
+func (s *IndexRestoreService) Validate() error {
+	if s.reader == nil {
+		return errors.New("elastic: reader is missing")
+	}
+	return nil
+}
+
+// IndexRestoreResponse is the response of IndexRestoreService.Do.
+type IndexRestoreResponse struct {
+	Index     string // name of the index restored into
+	Documents int64  // number of documents read from the archive
+	Succeeded int64  // number of documents indexed successfully
+	Failed    int64  // number of documents that failed to index
+}
+
+// Do restores the archive.
+func (s *IndexRestoreService) Do() (*IndexRestoreResponse, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(s.reader)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	dec := json.NewDecoder(zr)
+
+	var line indexArchiveLine
+	if err := dec.Decode(&line); err != nil {
+		return nil, fmt.Errorf("elastic: invalid archive: %v", err)
+	}
+	if line.Index == nil {
+		return nil, errors.New("elastic: invalid archive: missing index")
+	}
+	ret := &IndexRestoreResponse{Index: s.index}
+	if ret.Index == "" {
+		ret.Index = line.Index.Name
+	}
+
+	if s.createIndex {
+		if _, err := s.client.CreateIndex(ret.Index).BodyJson(s.createIndexBody(line.Index)).Do(); err != nil {
+			return ret, err
+		}
+	}
+
+	var mu sync.Mutex
+	var firstErr error
+	p, err := s.client.BulkProcessor().
+		Name("restore").
+		Workers(s.workers).
+		BulkActions(s.bulkActions).
+		After(func(executionId int64, requests []BulkableRequest, response *BulkResponse, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if response != nil {
+				ret.Succeeded += int64(len(response.Succeeded()))
+				ret.Failed += int64(len(response.Failed()))
+			}
+		}).
+		Do()
+	if err != nil {
+		return ret, err
+	}
+
+	for {
+		var line indexArchiveLine
+		err := dec.Decode(&line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			p.Close()
+			return ret, fmt.Errorf("elastic: invalid archive: %v", err)
+		}
+		if line.Doc == nil {
+			continue
+		}
+		doc := line.Doc
+		req := NewBulkIndexRequest().Index(ret.Index).Type(doc.Type).Id(doc.Id)
+		if doc.Source != nil {
+			req = req.Doc(*doc.Source)
+		}
+		if doc.Routing != "" {
+			req = req.Routing(doc.Routing)
+		}
+		if doc.Parent != "" {
+			req = req.Parent(doc.Parent)
+		}
+		if err := p.Add(req); err != nil {
+			p.Close()
+			return ret, err
+		}
+		ret.Documents++
+	}
+
+	if err := p.Close(); err != nil {
+		return ret, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return ret, firstErr
+}
+
+// createIndexBody returns the body to create the index of the archive.
+// It removes the settings that Elasticsearch does not accept on creation.
+func (s *IndexRestoreService) createIndexBody(index *indexArchiveIndex) map[string]interface{} {
+	body := make(map[string]interface{})
+	if len(index.Settings) > 0 {
+		settings := make(map[string]interface{})
+		for k, v := range index.Settings {
+			settings[k] = v
+		}
+		if inner, ok := settings["index"].(map[string]interface{}); ok {
+			copied := make(map[string]interface{})
+			for k, v := range inner {
+				switch k {
+				case "uuid", "version", "creation_date":
+				default:
+					copied[k] = v
+				}
+			}
+			settings["index"] = copied
+		}
+		body["settings"] = settings
+	}
+	if len(index.Mappings) > 0 {
+		body["mappings"] = index.Mappings
+	}
+	if s.aliases && len(index.Aliases) > 0 {
+		body["aliases"] = index.Aliases
+	}
+	return body
+}
@@ -0,0 +1,115 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIndexDumpAndRestore(t *testing.T) {
+	var created string
+	var bulks []string
+	ts := newTestServer()
+	defer ts.Close()
+	ts.Search = func(r *http.Request, body []byte) [][]string {
+		return [][]string{nil, {
+			`{"_type":"tweet","_id":"1","_source":{"user":"olivere"},"fields":{"_routing":"r1"}}`,
+			`{"_type":"comment","_id":"2","_source":{"text":"great"},"fields":{"_parent":"1"}}`,
+		}}
+	}
+	ts.Handle = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/"+testIndexName:
+			fmt.Fprintf(w, `{%q:{"aliases":{"tweets":{}},"mappings":{"tweet":{"properties":{"user":{"type":"string","index":"not_analyzed"}}}},"settings":{"index":{"number_of_shards":"1","uuid":"abc","version":{"created":"1070399"},"creation_date":"1447158720000"}}}}`, testIndexName)
+		case r.Method == "PUT" && r.URL.Path == "/"+testIndexName2:
+			created = string(body)
+			fmt.Fprint(w, `{"acknowledged":true}`)
+		case r.URL.Path == "/_bulk":
+			bulks = append(bulks, string(body))
+			fmt.Fprint(w, `{"took":1,"errors":false,"items":[{"index":{"_id":"1","status":201}},{"index":{"_id":"2","status":201}}]}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Dump
+	var buf bytes.Buffer
+	dumped, err := client.Dump(testIndexName).Writer(&buf).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dumped.Documents, int64(2); got != want {
+		t.Errorf("expected %d documents to be dumped; got %d", want, got)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(archive)), "\n")
+	if got, want := len(lines), 3; got != want {
+		t.Fatalf("expected %d lines in archive; got %d", want, got)
+	}
+	if got, want := lines[1], `{"doc":{"_type":"tweet","_id":"1","_routing":"r1","_source":{"user":"olivere"}}}`; got != want {
+		t.Errorf("expected line %s; got %s", want, got)
+	}
+	if got, want := lines[2], `{"doc":{"_type":"comment","_id":"2","_parent":"1","_source":{"text":"great"}}}`; got != want {
+		t.Errorf("expected line %s; got %s", want, got)
+	}
+
+	// Restore into a different index
+	restored, err := client.Restore(bytes.NewReader(buf.Bytes())).Index(testIndexName2).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restored.Documents, int64(2); got != want {
+		t.Errorf("expected %d documents to be restored; got %d", want, got)
+	}
+	if got, want := restored.Succeeded, int64(2); got != want {
+		t.Errorf("expected %d documents to succeed; got %d", want, got)
+	}
+	if got, want := created, `{"aliases":{"tweets":{}},"mappings":{"tweet":{"properties":{"user":{"index":"not_analyzed","type":"string"}}}},"settings":{"index":{"number_of_shards":"1"}}}`; got != want {
+		t.Errorf("expected index to be created with\n%s\ngot\n%s", want, got)
+	}
+	expected := `{"index":{"_id":"1","_index":"` + testIndexName2 + `","_routing":"r1","_type":"tweet"}}` + "\n" +
+		`{"user":"olivere"}` + "\n" +
+		`{"index":{"_id":"2","_index":"` + testIndexName2 + `","_parent":"1","_type":"comment"}}` + "\n" +
+		`{"text":"great"}` + "\n"
+	if got, want := strings.Join(bulks, ""), expected; got != want {
+		t.Errorf("expected bulk requests\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestIndexRestoreInvalidArchive(t *testing.T) {
+	client, err := NewSimpleClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"doc":{"_type":"tweet","_id":"1","_source":{}}}` + "\n"))
+	zw.Close()
+
+	if _, err := client.Restore(&buf).Do(); err == nil {
+		t.Fatal("expected error")
+	}
+}
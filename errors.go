@@ -85,3 +85,16 @@ func (e *Error) Error() string {
 		return fmt.Sprintf("elastic: Error %d (%s)", e.Status, http.StatusText(e.Status))
 	}
 }
+
+// IsConflict returns true if the error indicates a version conflict,
+// i.e. Elasticsearch returned HTTP status 409 or the error is
+// of type *ConflictError.
+func IsConflict(err error) bool {
+	switch e := err.(type) {
+	case *Error:
+		return e.Status == http.StatusConflict
+	case *ConflictError:
+		return true
+	}
+	return false
+}
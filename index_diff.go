@@ -0,0 +1,452 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+// IndexDiff compares the documents of two indices, e.g. after reindexing
+// or restoring an index. The indices may reside in different clusters
+// (see TargetClient).
+//
+// By default, IndexDiff scrolls through both indices sorted by _uid and
+// reports documents that are missing in the target, documents that only
+// exist in the target, and documents with a different _source, including
+// the differing fields.
+//
+// For very large indices, use Sample to only compare a random sample of
+// documents from the source. Extra documents in the target are not
+// detected in that mode.
+type IndexDiff struct {
+	sourceClient, targetClient *Client
+	sourceIndex, targetIndex   string
+	query                      Query
+	size                       int
+	sample                     int
+	seed                       interface{}
+	ignoreFields               map[string]bool
+	maxDifferences             int
+}
+
+// NewIndexDiff returns a new IndexDiff that compares sourceIndex
+// with targetIndex.
+func NewIndexDiff(client *Client, sourceIndex, targetIndex string) *IndexDiff {
+	return &IndexDiff{
+		sourceClient: client,
+		sourceIndex:  sourceIndex,
+		targetIndex:  targetIndex,
+		ignoreFields: make(map[string]bool),
+	}
+}
+
+// TargetClient specifies a different client for the target. This is
+// necessary when the target index is in a different Elasticsearch cluster.
+// By default, the source and target clients are the same.
+func (d *IndexDiff) TargetClient(c *Client) *IndexDiff {
+	d.targetClient = c
+	return d
+}
+
+// Query restricts the documents to compare. It is applied to both indices.
+func (d *IndexDiff) Query(q Query) *IndexDiff {
+	d.query = q
+	return d
+}
+
+// Size is the number of documents to fetch per scroll request (default: 100).
+func (d *IndexDiff) Size(size int) *IndexDiff {
+	d.size = size
+	return d
+}
+
+// Sample only compares n randomly chosen documents from the source.
+func (d *IndexDiff) Sample(n int) *IndexDiff {
+	d.sample = n
+	return d
+}
+
+// Seed sets the seed for choosing the sample, e.g. to compare
+// the same documents again. By default, a random sample is chosen.
+func (d *IndexDiff) Seed(seed interface{}) *IndexDiff {
+	d.seed = seed
+	return d
+}
+
+// IgnoreFields specifies fields of the _source to ignore when comparing
+// documents, e.g. a timestamp of the last update. Use dots to specify
+// fields of inner objects, e.g. "user.updated".
+func (d *IndexDiff) IgnoreFields(fields ...string) *IndexDiff {
+	for _, field := range fields {
+		d.ignoreFields[field] = true
+	}
+	return d
+}
+
+// MaxDifferences stops the comparison after the given number of missing,
+// extra, or differing documents has been found. By default, all documents
+// are compared.
+func (d *IndexDiff) MaxDifferences(n int) *IndexDiff {
+	d.maxDifferences = n
+	return d
+}
+
+// IndexDiffResponse is the result of IndexDiff.Do.
+type IndexDiffResponse struct {
+	Compared  int64           // number of documents compared
+	Equal     int64           // number of documents that are equal
+	Missing   []*IndexDiffDoc // documents that are missing in the target
+	Extra     []*IndexDiffDoc // documents that only exist in the target
+	Different []*IndexDiffDoc // documents that differ
+	Sampled   bool            // true if only a sample has been compared
+	Truncated bool            // true if stopped due to MaxDifferences
+}
+
+// Differences returns the number of missing, extra, and different documents.
+func (r *IndexDiffResponse) Differences() int {
+	return len(r.Missing) + len(r.Extra) + len(r.Different)
+}
+
+// IndexDiffDoc describes a document that differs.
+type IndexDiffDoc struct {
+	Type   string
+	Id     string
+	Fields []*IndexDiffField // differing fields, sorted by path
+}
+
+// IndexDiffField describes a field that differs between the source and
+// target document. Path is the path to the field, e.g. "user.name" or
+// "tags[1]".
+type IndexDiffField struct {
+	Path     string
+	Source   interface{}
+	Target   interface{}
+	InSource bool // false if the field is missing in the source
+	InTarget bool // false if the field is missing in the target
+}
+
+// String returns a string representation of the field difference.
+func (f *IndexDiffField) String() string {
+	switch {
+	case !f.InSource:
+		return fmt.Sprintf("%s: only in target: %v", f.Path, f.Target)
+	case !f.InTarget:
+		return fmt.Sprintf("%s: only in source: %v", f.Path, f.Source)
+	default:
+		return fmt.Sprintf("%s: %v != %v", f.Path, f.Source, f.Target)
+	}
+}
+
+// Do runs DoC() with default context.
+func (d *IndexDiff) Do() (*IndexDiffResponse, error) {
+	return d.DoC(nil)
+}
+
+// DoC compares the indices.
+func (d *IndexDiff) DoC(ctx context.Context) (*IndexDiffResponse, error) {
+	if d.sourceClient == nil {
+		return nil, errors.New("elastic: no source client")
+	}
+	if d.sourceIndex == "" || d.targetIndex == "" {
+		return nil, ErrMissingIndex
+	}
+	if d.targetClient == nil {
+		d.targetClient = d.sourceClient
+	}
+	if d.size <= 0 {
+		d.size = 100
+	}
+	if d.sample > 0 {
+		return d.compareSample(ctx)
+	}
+	return d.compareAll(ctx)
+}
+
+// hits returns an iterator over all documents of the index, sorted by _uid.
+func (d *IndexDiff) hits(ctx context.Context, client *Client, index string) *ScanIterator {
+	scan := client.Scan(index).Sort("_uid", true).Size(d.size)
+	if d.query != nil {
+		scan = scan.Query(d.query)
+	}
+	return scan.Hits(ctx)
+}
+
+// compareAll merges the sorted documents of both indices.
+func (d *IndexDiff) compareAll(ctx context.Context) (*IndexDiffResponse, error) {
+	ret := new(IndexDiffResponse)
+
+	source := d.hits(ctx, d.sourceClient, d.sourceIndex)
+	defer source.Close()
+	target := d.hits(ctx, d.targetClient, d.targetIndex)
+	defer target.Close()
+
+	hasSource, err := nextHit(source)
+	if err != nil {
+		return ret, err
+	}
+	hasTarget, err := nextHit(target)
+	if err != nil {
+		return ret, err
+	}
+	for (hasSource || hasTarget) && !d.done(ret) {
+		var cmp int
+		switch {
+		case !hasTarget:
+			cmp = -1
+		case !hasSource:
+			cmp = 1
+		default:
+			cmp = compareUid(source.Hit(), target.Hit())
+		}
+		switch {
+		case cmp < 0:
+			ret.Missing = append(ret.Missing, &IndexDiffDoc{Type: source.Hit().Type, Id: source.Hit().Id})
+			if hasSource, err = nextHit(source); err != nil {
+				return ret, err
+			}
+		case cmp > 0:
+			ret.Extra = append(ret.Extra, &IndexDiffDoc{Type: target.Hit().Type, Id: target.Hit().Id})
+			if hasTarget, err = nextHit(target); err != nil {
+				return ret, err
+			}
+		default:
+			if err := d.compare(ret, source.Hit().Type, source.Hit().Id, source.Hit().Source, target.Hit().Source); err != nil {
+				return ret, err
+			}
+			if hasSource, err = nextHit(source); err != nil {
+				return ret, err
+			}
+			if hasTarget, err = nextHit(target); err != nil {
+				return ret, err
+			}
+		}
+	}
+	return ret, nil
+}
+
+// nextHit advances the iterator. It returns the error of the iterator as
+// soon as it stops, so that a failed scroll is never mistaken for the
+// end of the index, which would report all remaining documents of the
+// other index as missing or extra.
+func nextHit(it *ScanIterator) (bool, error) {
+	if it.Next() {
+		return true, nil
+	}
+	return false, it.Err()
+}
+
+// compareSample compares a random sample of documents from the source
+// with the documents of the same type and id in the target.
+func (d *IndexDiff) compareSample(ctx context.Context) (*IndexDiffResponse, error) {
+	ret := &IndexDiffResponse{Sampled: true}
+
+	q := d.query
+	if q == nil {
+		q = NewMatchAllQuery()
+	}
+	random := NewRandomFunction()
+	if d.seed != nil {
+		random = random.Seed(d.seed)
+	}
+	res, err := d.sourceClient.Search(d.sourceIndex).
+		Query(NewFunctionScoreQuery().Query(q).AddScoreFunc(random)).
+		Fields("_source", "_routing").
+		Size(d.sample).
+		DoC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hits := searchResultHits(res)
+	if len(hits) == 0 {
+		return ret, nil
+	}
+
+	for start := 0; start < len(hits) && !d.done(ret); start += d.size {
+		end := start + d.size
+		if end > len(hits) {
+			end = len(hits)
+		}
+		mget := d.targetClient.MultiGet()
+		for _, hit := range hits[start:end] {
+			item := NewMultiGetItem().Index(d.targetIndex).Type(hit.Type).Id(hit.Id)
+			if routing, ok := hit.Fields["_routing"].(string); ok {
+				item = item.Routing(routing)
+			}
+			mget = mget.Add(item)
+		}
+		docs, err := mget.DoC(ctx)
+		if err != nil {
+			return ret, err
+		}
+		if len(docs.Docs) != end-start {
+			return ret, fmt.Errorf("elastic: expected %d documents from multi get; got %d", end-start, len(docs.Docs))
+		}
+		for i, hit := range hits[start:end] {
+			if d.done(ret) {
+				break
+			}
+			doc := docs.Docs[i]
+			if doc.Error != "" {
+				return ret, fmt.Errorf("elastic: unable to get document %s/%s: %s", hit.Type, hit.Id, doc.Error)
+			}
+			if !doc.Found {
+				ret.Missing = append(ret.Missing, &IndexDiffDoc{Type: hit.Type, Id: hit.Id})
+				continue
+			}
+			if err := d.compare(ret, hit.Type, hit.Id, hit.Source, doc.Source); err != nil {
+				return ret, err
+			}
+		}
+	}
+	return ret, nil
+}
+
+// done returns true if the maximum number of differences has been found.
+func (d *IndexDiff) done(ret *IndexDiffResponse) bool {
+	if d.maxDifferences > 0 && ret.Differences() >= d.maxDifferences {
+		ret.Truncated = true
+		return true
+	}
+	return false
+}
+
+// compare compares the source of a document in both indices.
+func (d *IndexDiff) compare(ret *IndexDiffResponse, typ, id string, source, target *json.RawMessage) error {
+	ret.Compared++
+	var sv, tv interface{}
+	if source != nil {
+		if err := decodeIndexDiffSource(*source, &sv); err != nil {
+			return fmt.Errorf("elastic: unable to decode source document %s/%s: %v", typ, id, err)
+		}
+	}
+	if target != nil {
+		if err := decodeIndexDiffSource(*target, &tv); err != nil {
+			return fmt.Errorf("elastic: unable to decode target document %s/%s: %v", typ, id, err)
+		}
+	}
+	fields := diffJSON(nil, "", sv, tv, true, true, d.ignoreFields)
+	if len(fields) == 0 {
+		ret.Equal++
+		return nil
+	}
+	ret.Different = append(ret.Different, &IndexDiffDoc{Type: typ, Id: id, Fields: fields})
+	return nil
+}
+
+// decodeIndexDiffSource decodes a _source into v. Numbers are decoded as
+// json.Number, so that large integers like ids are compared exactly.
+func decodeIndexDiffSource(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// compareUid compares two hits by _uid, i.e. by type and id, like
+// Elasticsearch does when sorting by _uid.
+func compareUid(a, b *SearchHit) int {
+	ua, ub := a.Type+"#"+a.Id, b.Type+"#"+b.Id
+	switch {
+	case ua < ub:
+		return -1
+	case ua > ub:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// diffJSON appends the differences between the decoded JSON values
+// a and b at the given path to diffs.
+func diffJSON(diffs []*IndexDiffField, path string, a, b interface{}, inA, inB bool, ignore map[string]bool) []*IndexDiffField {
+	if ignore[path] {
+		return diffs
+	}
+	if inA && inB {
+		switch av := a.(type) {
+		case map[string]interface{}:
+			if bv, ok := b.(map[string]interface{}); ok {
+				keys := make(map[string]bool)
+				for k := range av {
+					keys[k] = true
+				}
+				for k := range bv {
+					keys[k] = true
+				}
+				names := make([]string, 0, len(keys))
+				for k := range keys {
+					names = append(names, k)
+				}
+				sort.Strings(names)
+				for _, k := range names {
+					p := k
+					if path != "" {
+						p = path + "." + k
+					}
+					x, inX := av[k]
+					y, inY := bv[k]
+					diffs = diffJSON(diffs, p, x, y, inX, inY, ignore)
+				}
+				return diffs
+			}
+		case json.Number:
+			if bv, ok := b.(json.Number); ok && jsonNumbersEqual(av, bv) {
+				return diffs
+			}
+		case []interface{}:
+			if bv, ok := b.([]interface{}); ok {
+				n := len(av)
+				if len(bv) > n {
+					n = len(bv)
+				}
+				for i := 0; i < n; i++ {
+					var x, y interface{}
+					inX, inY := i < len(av), i < len(bv)
+					if inX {
+						x = av[i]
+					}
+					if inY {
+						y = bv[i]
+					}
+					diffs = diffJSON(diffs, fmt.Sprintf("%s[%d]", path, i), x, y, inX, inY, ignore)
+				}
+				return diffs
+			}
+		}
+		if reflect.DeepEqual(a, b) {
+			return diffs
+		}
+	}
+	return append(diffs, &IndexDiffField{
+		Path:     path,
+		Source:   a,
+		Target:   b,
+		InSource: inA,
+		InTarget: inB,
+	})
+}
+
+// jsonNumbersEqual returns true if a and b are the same number, e.g.
+// 1 and 1.0. Numbers are compared exactly, not as float64, which cannot
+// tell apart integers beyond 2^53.
+func jsonNumbersEqual(a, b json.Number) bool {
+	if a == b {
+		return true
+	}
+	ai, aerr := a.Int64()
+	bi, berr := b.Int64()
+	if aerr == nil && berr == nil {
+		return ai == bi
+	}
+	ar, aok := new(big.Rat).SetString(string(a))
+	br, bok := new(big.Rat).SetString(string(b))
+	return aok && bok && ar.Cmp(br) == 0
+}
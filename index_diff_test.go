@@ -0,0 +1,268 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newIndexDiffTestServer returns a server that serves the given documents
+// (by index, then by id) for sorted scrolls, searches, and multi gets.
+func newIndexDiffTestServer(indices map[string]map[string]string) *testServer {
+	ts := newTestServer()
+	ts.Search = func(r *http.Request, body []byte) [][]string {
+		index := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[0]
+		var ids []string
+		for id := range indices[index] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		var hits []string
+		for _, id := range ids {
+			hits = append(hits, fmt.Sprintf(`{"_index":%q,"_type":"tweet","_id":%q,"_source":%s}`, index, id, indices[index][id]))
+		}
+		return [][]string{hits}
+	}
+	ts.Handle = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if r.URL.Path != "/_mget" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":"unexpected request %s %s","status":400}`, r.Method, r.URL.Path)
+			return
+		}
+		var req struct {
+			Docs []struct {
+				Index string `json:"_index"`
+				Id    string `json:"_id"`
+			} `json:"docs"`
+		}
+		json.Unmarshal(body, &req)
+		var docs []string
+		for _, doc := range req.Docs {
+			if source, found := indices[doc.Index][doc.Id]; found {
+				docs = append(docs, fmt.Sprintf(`{"_index":%q,"_type":"tweet","_id":%q,"found":true,"_source":%s}`, doc.Index, doc.Id, source))
+			} else {
+				docs = append(docs, fmt.Sprintf(`{"_index":%q,"_type":"tweet","_id":%q,"found":false}`, doc.Index, doc.Id))
+			}
+		}
+		fmt.Fprintf(w, `{"docs":[%s]}`, strings.Join(docs, ","))
+	}
+	return ts
+}
+
+func TestIndexDiff(t *testing.T) {
+	ts := newIndexDiffTestServer(map[string]map[string]string{
+		testIndexName: {
+			"1": `{"user":"olivere","message":"Welcome","tags":["a","b"]}`,
+			"2": `{"user":"sandrae","message":"Hello"}`,
+			"3": `{"user":"olivere","message":"Missing"}`,
+			"4": `{"user":{"name":"olivere","age":40},"updated":"2015-01-01"}`,
+		},
+		testIndexName2: {
+			"1": `{"user":"olivere","message":"Welcome","tags":["a","c"]}`,
+			"2": `{"message":"Hello","user":"sandrae"}`,
+			"4": `{"user":{"name":"oliver","age":40},"updated":"2016-01-01","retweets":1}`,
+			"5": `{"user":"olivere","message":"Extra"}`,
+		},
+	})
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetClient, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.Diff(testIndexName, testIndexName2).
+		TargetClient(targetClient).
+		IgnoreFields("updated").
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.Compared, int64(3); got != want {
+		t.Errorf("expected Compared = %d; got %d", want, got)
+	}
+	if got, want := res.Equal, int64(1); got != want {
+		t.Errorf("expected Equal = %d; got %d", want, got)
+	}
+	if got, want := len(res.Missing), 1; got != want {
+		t.Fatalf("expected %d missing documents; got %d", want, got)
+	}
+	if got, want := res.Missing[0].Id, "3"; got != want {
+		t.Errorf("expected missing document %q; got %q", want, got)
+	}
+	if got, want := len(res.Extra), 1; got != want {
+		t.Fatalf("expected %d extra documents; got %d", want, got)
+	}
+	if got, want := res.Extra[0].Id, "5"; got != want {
+		t.Errorf("expected extra document %q; got %q", want, got)
+	}
+	if got, want := len(res.Different), 2; got != want {
+		t.Fatalf("expected %d different documents; got %d", want, got)
+	}
+
+	tests := []struct {
+		Id     string
+		Fields []string
+	}{
+		// #0
+		{"1", []string{"tags[1]: b != c"}},
+		// #1
+		{"4", []string{"retweets: only in target: 1", "user.name: olivere != oliver"}},
+	}
+	for i, test := range tests {
+		doc := res.Different[i]
+		if doc.Id != test.Id {
+			t.Errorf("#%d: expected document %q; got %q", i, test.Id, doc.Id)
+			continue
+		}
+		var fields []string
+		for _, field := range doc.Fields {
+			fields = append(fields, field.String())
+		}
+		if got, want := strings.Join(fields, "; "), strings.Join(test.Fields, "; "); got != want {
+			t.Errorf("#%d: expected fields %q; got %q", i, want, got)
+		}
+	}
+}
+
+func TestIndexDiffMaxDifferences(t *testing.T) {
+	ts := newIndexDiffTestServer(map[string]map[string]string{
+		testIndexName: {
+			"1": `{"user":"olivere"}`,
+			"2": `{"user":"olivere"}`,
+			"3": `{"user":"olivere"}`,
+		},
+		testIndexName2: {},
+	})
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Diff(testIndexName, testIndexName2).MaxDifferences(2).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.Differences(), 2; got != want {
+		t.Errorf("expected %d differences; got %d", want, got)
+	}
+	if !res.Truncated {
+		t.Errorf("expected Truncated = %v; got %v", true, res.Truncated)
+	}
+}
+
+func TestIndexDiffLargeNumbers(t *testing.T) {
+	ts := newIndexDiffTestServer(map[string]map[string]string{
+		testIndexName: {
+			"1": `{"id":9007199254740993,"retweets":1}`,
+		},
+		testIndexName2: {
+			"1": `{"id":9007199254740992,"retweets":1.0}`,
+		},
+	})
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Diff(testIndexName, testIndexName2).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(res.Different), 1; got != want {
+		t.Fatalf("expected %d different documents; got %d", want, got)
+	}
+	var fields []string
+	for _, field := range res.Different[0].Fields {
+		fields = append(fields, field.String())
+	}
+	if got, want := strings.Join(fields, "; "), "id: 9007199254740993 != 9007199254740992"; got != want {
+		t.Errorf("expected fields %q; got %q", want, got)
+	}
+}
+
+func TestIndexDiffScrollFailure(t *testing.T) {
+	ts := newIndexDiffTestServer(map[string]map[string]string{
+		testIndexName: {
+			"1": `{"user":"olivere"}`,
+			"2": `{"user":"olivere"}`,
+			"3": `{"user":"olivere"}`,
+		},
+		testIndexName2: {
+			"1": `{"user":"olivere"}`,
+		},
+	})
+	defer ts.Close()
+	ts.FailScroll = "2-0" // second page of the target
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Diff(testIndexName, testIndexName2).Do()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if res == nil {
+		t.Fatal("expected response")
+	}
+	if got, want := res.Differences(), 0; got != want {
+		t.Errorf("expected %d differences; got %d", want, got)
+	}
+}
+
+func TestIndexDiffSample(t *testing.T) {
+	ts := newIndexDiffTestServer(map[string]map[string]string{
+		testIndexName: {
+			"1": `{"user":"olivere","message":"Welcome"}`,
+			"2": `{"user":"sandrae","message":"Hello"}`,
+			"3": `{"user":"olivere","message":"Missing"}`,
+		},
+		testIndexName2: {
+			"1": `{"user":"olivere","message":"Welcome"}`,
+			"2": `{"user":"sandrae","message":"Hi"}`,
+			"4": `{"user":"olivere","message":"Extra"}`,
+		},
+	})
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Diff(testIndexName, testIndexName2).Sample(10).Seed(42).Size(2).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Sampled {
+		t.Errorf("expected Sampled = %v; got %v", true, res.Sampled)
+	}
+	if got, want := res.Compared, int64(2); got != want {
+		t.Errorf("expected Compared = %d; got %d", want, got)
+	}
+	if got, want := len(res.Missing), 1; got != want {
+		t.Errorf("expected %d missing documents; got %d", want, got)
+	}
+	if got, want := len(res.Different), 1; got != want {
+		t.Fatalf("expected %d different documents; got %d", want, got)
+	}
+	if got, want := res.Different[0].Fields[0].Path, "message"; got != want {
+		t.Errorf("expected different field %q; got %q", want, got)
+	}
+	if got, want := len(res.Extra), 0; got != want {
+		t.Errorf("expected %d extra documents in sample mode; got %d", want, got)
+	}
+}
@@ -7,8 +7,13 @@ package elastic
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -174,6 +179,87 @@ func setupTestClientAndCreateIndexAndAddDocs(t logger, options ...ClientOptionFu
 	return client
 }
 
+// testServer is a fake Elasticsearch node for tests that cannot run
+// against a cluster, e.g. because they simulate failures. It serves
+// searches and scrolls from the pages of hits returned by Search, and
+// passes all other requests to Handle.
+//
+// Scroll ids have the form "<scroll>-<page>", where scroll numbers the
+// searches (starting at 1) and page is the index of the page returned.
+type testServer struct {
+	*httptest.Server
+
+	// Search returns the pages of hits of a search. Each hit is a JSON
+	// object. The first page is returned by the search itself, the others
+	// by subsequent requests to /_search/scroll.
+	Search func(r *http.Request, body []byte) [][]string
+
+	// Handle handles all other requests. It is called with mu held.
+	Handle func(w http.ResponseWriter, r *http.Request, body []byte)
+
+	// FailScroll is the id of a scroll request that fails.
+	FailScroll string
+
+	mu       sync.Mutex
+	scrolls  [][][]string    // pages by scroll
+	requests []*http.Request // all requests received
+	bodies   []string        // bodies of requests
+	cleared  []string        // scroll ids cleared by clients
+}
+
+func newTestServer() *testServer {
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *testServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, string(body))
+
+	switch {
+	case r.Method == "DELETE" && r.URL.Path == "/_search/scroll":
+		s.cleared = append(s.cleared, strings.Split(string(body), ",")...)
+		fmt.Fprint(w, `{}`)
+	case r.URL.Path == "/_search/scroll":
+		var scroll, page int
+		fmt.Sscanf(string(body), "%d-%d", &scroll, &page)
+		if string(body) == s.FailScroll || scroll < 1 || scroll > len(s.scrolls) {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":"SearchContextMissingException","status":500}`)
+			return
+		}
+		s.writePage(w, scroll, page+1)
+	case s.Search != nil && strings.HasSuffix(r.URL.Path, "/_search"):
+		s.scrolls = append(s.scrolls, s.Search(r, body))
+		s.writePage(w, len(s.scrolls), 0)
+	case s.Handle != nil:
+		s.Handle(w, r, body)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"unexpected request %s %s","status":400}`, r.Method, r.URL.Path)
+	}
+}
+
+// writePage writes the given page of a scroll. Pages beyond the last
+// one are empty.
+func (s *testServer) writePage(w http.ResponseWriter, scroll, page int) {
+	pages := s.scrolls[scroll-1]
+	var total int
+	for _, hits := range pages {
+		total += len(hits)
+	}
+	var hits []string
+	if page < len(pages) {
+		hits = pages[page]
+	}
+	fmt.Fprintf(w, `{"took":1,"_scroll_id":"%d-%d","hits":{"total":%d,"hits":[%s]}}`, scroll, page, total, strings.Join(hits, ","))
+}
+
 func TestIndexLifecycle(t *testing.T) {
 	client := setupTestClient(t)
 
@@ -0,0 +1,282 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// IndexMigration moves an alias to a new index without downtime.
+// It orchestrates the usual steps of a reindex:
+//
+//  1. Create the target index (index templates are applied by Elasticsearch).
+//  2. Copy all documents from the indices behind the alias with a Reindexer.
+//  3. Optionally copy the documents written in the meantime (see CatchUp).
+//  4. Optionally verify that source and target contain the same number
+//     of documents (see Verify).
+//  5. Atomically move the alias from the old indices to the target index.
+//  6. Optionally delete the old indices (see DeleteOld).
+//
+// If one of the steps before the alias swap fails, the migration is rolled
+// back by deleting the target index. Use DryRun to see which steps would
+// be performed without changing anything.
+type IndexMigration struct {
+	client        *Client
+	alias         string
+	targetIndex   string
+	body          interface{}
+	reindexerFunc ReindexerFunc
+	configure     func(*Reindexer)
+	catchUp       Query
+	verify        bool
+	deleteOld     bool
+	dryRun        bool
+}
+
+// NewIndexMigration returns a new IndexMigration that moves the alias
+// to the target index.
+func NewIndexMigration(client *Client, alias, targetIndex string) *IndexMigration {
+	return &IndexMigration{
+		client:      client,
+		alias:       alias,
+		targetIndex: targetIndex,
+	}
+}
+
+// Body specifies the settings and mappings to create the target index with,
+// e.g. as a string or map[string]interface{}. By default, the index is
+// created without a body, i.e. only matching index templates apply.
+func (m *IndexMigration) Body(body interface{}) *IndexMigration {
+	m.body = body
+	return m
+}
+
+// ReindexerFunc specifies how to copy a document to the target index.
+// The default is CopyToTargetIndex.
+func (m *IndexMigration) ReindexerFunc(fn ReindexerFunc) *IndexMigration {
+	m.reindexerFunc = fn
+	return m
+}
+
+// Reindexer allows to configure the Reindexer that copies the documents,
+// e.g. to set the bulk size or the number of workers.
+func (m *IndexMigration) Reindexer(configure func(*Reindexer)) *IndexMigration {
+	m.configure = configure
+	return m
+}
+
+// CatchUp specifies a query for the documents that have been written to
+// the old indices while copying, e.g. a range filter on a timestamp.
+// These documents are copied again right before the alias swap.
+func (m *IndexMigration) CatchUp(query Query) *IndexMigration {
+	m.catchUp = query
+	return m
+}
+
+// Verify compares the number of documents in the old indices and in the
+// target index before swapping the alias. If they differ, the migration
+// is rolled back.
+func (m *IndexMigration) Verify(verify bool) *IndexMigration {
+	m.verify = verify
+	return m
+}
+
+// DeleteOld deletes the old indices after the alias has been swapped.
+func (m *IndexMigration) DeleteOld(deleteOld bool) *IndexMigration {
+	m.deleteOld = deleteOld
+	return m
+}
+
+// DryRun only determines and returns the steps of the migration
+// without changing anything.
+func (m *IndexMigration) DryRun(dryRun bool) *IndexMigration {
+	m.dryRun = dryRun
+	return m
+}
+
+// IndexMigrationResult is returned from IndexMigration.Do.
+type IndexMigrationResult struct {
+	// OldIndices are the indices the alias pointed to before the migration.
+	OldIndices []string
+	// Steps lists the steps performed, or to be performed in a dry run.
+	Steps []string
+	// Reindex is the response of the Reindexer, including the catch-up.
+	Reindex *ReindexerResponse
+	// SourceCount and TargetCount are the number of documents found
+	// during verification.
+	SourceCount int64
+	TargetCount int64
+	// RolledBack is true if the target index has been deleted due to
+	// an error.
+	RolledBack bool
+}
+
+// IndexMigrationVerifyError is returned from IndexMigration.Do if the
+// number of documents in the old indices and the target index differ.
+type IndexMigrationVerifyError struct {
+	SourceCount int64
+	TargetCount int64
+}
+
+// Error returns a string representation of the error.
+func (e *IndexMigrationVerifyError) Error() string {
+	return fmt.Sprintf("elastic: migration verification failed: source has %d documents, target has %d", e.SourceCount, e.TargetCount)
+}
+
+// Do runs the migration.
+func (m *IndexMigration) Do() (*IndexMigrationResult, error) {
+	if m.alias == "" {
+		return nil, errors.New("elastic: alias is missing")
+	}
+	if m.targetIndex == "" {
+		return nil, ErrMissingIndex
+	}
+
+	aliases, err := m.client.Aliases().Do()
+	if err != nil {
+		return nil, err
+	}
+	oldIndices := aliases.IndicesByAlias(m.alias)
+	if len(oldIndices) == 0 {
+		return nil, fmt.Errorf("elastic: alias %q does not exist", m.alias)
+	}
+	sort.Strings(oldIndices)
+	for _, index := range oldIndices {
+		if index == m.targetIndex {
+			return nil, fmt.Errorf("elastic: alias %q already points to index %q", m.alias, m.targetIndex)
+		}
+	}
+	ret := &IndexMigrationResult{OldIndices: oldIndices}
+
+	// Create target
+	ret.Steps = append(ret.Steps, fmt.Sprintf("create index %s", m.targetIndex))
+	if !m.dryRun {
+		create := m.client.CreateIndex(m.targetIndex)
+		if m.body != nil {
+			create = create.BodyJson(m.body)
+		}
+		if _, err := create.Do(); err != nil {
+			return ret, err
+		}
+	}
+
+	// Copy, catch up, and verify
+	if err := m.copy(ret); err != nil {
+		return ret, m.rollback(ret, err)
+	}
+
+	// Swap alias
+	ret.Steps = append(ret.Steps, fmt.Sprintf("move alias %s from %v to %s", m.alias, oldIndices, m.targetIndex))
+	if !m.dryRun {
+		svc := m.client.Alias()
+		for _, index := range oldIndices {
+			svc = svc.Remove(index, m.alias)
+		}
+		svc = svc.Add(m.targetIndex, m.alias)
+		if _, err := svc.Do(); err != nil {
+			return ret, m.rollback(ret, err)
+		}
+	}
+
+	// Delete old indices
+	if m.deleteOld {
+		for _, index := range oldIndices {
+			ret.Steps = append(ret.Steps, fmt.Sprintf("delete index %s", index))
+			if m.dryRun {
+				continue
+			}
+			if _, err := m.client.DeleteIndex(index).Do(); err != nil {
+				return ret, err
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// copy copies the documents from the alias to the target index,
+// catches up, and verifies the result.
+func (m *IndexMigration) copy(ret *IndexMigrationResult) error {
+	ret.Steps = append(ret.Steps, fmt.Sprintf("copy documents from %s to %s", m.alias, m.targetIndex))
+	if !m.dryRun {
+		res, err := m.reindexer(nil).Do()
+		ret.Reindex = res
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.catchUp != nil {
+		ret.Steps = append(ret.Steps, fmt.Sprintf("catch up on documents written to %s", m.alias))
+		if !m.dryRun {
+			res, err := m.reindexer(m.catchUp).Do()
+			if res != nil && ret.Reindex != nil {
+				ret.Reindex.Success += res.Success
+				ret.Reindex.Failed += res.Failed
+				ret.Reindex.Skipped += res.Skipped
+				ret.Reindex.Errors = append(ret.Reindex.Errors, res.Errors...)
+				ret.Reindex.HitErrors = append(ret.Reindex.HitErrors, res.HitErrors...)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.verify {
+		ret.Steps = append(ret.Steps, fmt.Sprintf("verify number of documents in %s", m.targetIndex))
+		if !m.dryRun {
+			if _, err := m.client.Refresh(m.targetIndex).Do(); err != nil {
+				return err
+			}
+			var err error
+			ret.SourceCount, err = m.client.Count(m.alias).Do()
+			if err != nil {
+				return err
+			}
+			ret.TargetCount, err = m.client.Count(m.targetIndex).Do()
+			if err != nil {
+				return err
+			}
+			if ret.SourceCount != ret.TargetCount {
+				return &IndexMigrationVerifyError{SourceCount: ret.SourceCount, TargetCount: ret.TargetCount}
+			}
+		}
+	}
+	return nil
+}
+
+// reindexer returns the Reindexer to copy the documents matching
+// the query (or all documents if query is nil).
+func (m *IndexMigration) reindexer(query Query) *Reindexer {
+	fn := m.reindexerFunc
+	if fn == nil {
+		fn = CopyToTargetIndex(m.targetIndex)
+	}
+	ix := NewReindexer(m.client, m.alias, fn)
+	if m.configure != nil {
+		m.configure(ix)
+	}
+	if query != nil {
+		ix = ix.Query(query)
+	}
+	return ix
+}
+
+// rollback deletes the target index after err occurred. It returns err.
+func (m *IndexMigration) rollback(ret *IndexMigrationResult, err error) error {
+	if m.dryRun {
+		return err
+	}
+	ret.Steps = append(ret.Steps, fmt.Sprintf("roll back: delete index %s", m.targetIndex))
+	if _, derr := m.client.DeleteIndex(m.targetIndex).Do(); derr != nil {
+		m.client.errorf("elastic: unable to roll back migration of alias %q: %v", m.alias, derr)
+		return err
+	}
+	ret.RolledBack = true
+	return err
+}
@@ -0,0 +1,151 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// newMigrationTestServer simulates an alias "tweets" that points to
+// the index testIndexName with the given number of documents, and
+// records the index and alias operations.
+func newMigrationTestServer(docs int, ops *[]string) *reindexerTestServer {
+	ts := newReindexerTestServer(docs)
+	ok := func(op string) func(w http.ResponseWriter, body []byte) {
+		return func(w http.ResponseWriter, body []byte) {
+			*ops = append(*ops, op+" "+string(body))
+			fmt.Fprint(w, `{"acknowledged":true}`)
+		}
+	}
+	// AliasesService requests "//_aliases" if no indices are given
+	ts.routes["GET //_aliases"] = func(w http.ResponseWriter, body []byte) {
+		fmt.Fprintf(w, `{%q:{"aliases":{"tweets":{}}}}`, testIndexName)
+	}
+	ts.routes["PUT /"+testIndexName2] = ok("create")
+	ts.routes["DELETE /"+testIndexName+"/"] = ok("delete " + testIndexName)
+	ts.routes["DELETE /"+testIndexName2+"/"] = ok("delete " + testIndexName2)
+	ts.routes["POST /_aliases"] = ok("aliases")
+	ts.routes["POST /"+testIndexName2+"/_refresh"] = func(w http.ResponseWriter, body []byte) {
+		fmt.Fprint(w, `{}`)
+	}
+	ts.routes["POST /tweets/_count"] = func(w http.ResponseWriter, body []byte) {
+		fmt.Fprintf(w, `{"count":%d}`, ts.docs)
+	}
+	ts.routes["POST /"+testIndexName2+"/_count"] = func(w http.ResponseWriter, body []byte) {
+		fmt.Fprintf(w, `{"count":%d}`, len(ts.indexed))
+	}
+	return ts
+}
+
+func TestIndexMigration(t *testing.T) {
+	var ops []string
+	ts := newMigrationTestServer(5, &ops)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := client.Migrate("tweets", testIndexName2).
+		Body(`{"settings":{"number_of_shards":1}}`).
+		Verify(true).
+		DeleteOld(true).
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(ret.OldIndices, ","), testIndexName; got != want {
+		t.Errorf("expected old indices %s; got %s", want, got)
+	}
+	if got, want := ret.Reindex.Success, int64(5); got != want {
+		t.Errorf("expected success = %d; got %d", want, got)
+	}
+	if got, want := ret.TargetCount, int64(5); got != want {
+		t.Errorf("expected target count = %d; got %d", want, got)
+	}
+	if ret.RolledBack {
+		t.Errorf("expected migration to not be rolled back")
+	}
+
+	expected := []string{
+		`create {"settings":{"number_of_shards":1}}`,
+		`aliases {"actions":[{"remove":{"alias":"tweets","index":"` + testIndexName + `"}},{"add":{"alias":"tweets","index":"` + testIndexName2 + `"}}]}`,
+		`delete ` + testIndexName + ` `,
+	}
+	if got, want := strings.Join(ops, "\n"), strings.Join(expected, "\n"); got != want {
+		t.Errorf("expected operations\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestIndexMigrationDryRun(t *testing.T) {
+	var ops []string
+	ts := newMigrationTestServer(5, &ops)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := client.Migrate("tweets", testIndexName2).
+		CatchUp(NewRangeQuery("created").Gte("now-1h")).
+		Verify(true).
+		DeleteOld(true).
+		DryRun(true).
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 0 {
+		t.Errorf("expected no operations in dry run; got %v", ops)
+	}
+	if len(ts.indexed) != 0 {
+		t.Errorf("expected no documents to be copied in dry run; got %v", ts.indexed)
+	}
+	if got, want := len(ret.Steps), 6; got != want {
+		t.Fatalf("expected %d steps; got %d: %v", want, got, ret.Steps)
+	}
+	if got, want := ret.Steps[4], "move alias tweets from ["+testIndexName+"] to "+testIndexName2; got != want {
+		t.Errorf("expected step %q; got %q", want, got)
+	}
+}
+
+func TestIndexMigrationRollback(t *testing.T) {
+	var ops []string
+	ts := newMigrationTestServer(5, &ops)
+	defer ts.Close()
+
+	// Source has more documents than have been copied
+	ts.routes["POST /tweets/_count"] = func(w http.ResponseWriter, body []byte) {
+		fmt.Fprint(w, `{"count":6}`)
+	}
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := client.Migrate("tweets", testIndexName2).Verify(true).DeleteOld(true).Do()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	verr, ok := err.(*IndexMigrationVerifyError)
+	if !ok {
+		t.Fatalf("expected *IndexMigrationVerifyError; got %T", err)
+	}
+	if got, want := verr.SourceCount, int64(6); got != want {
+		t.Errorf("expected source count = %d; got %d", want, got)
+	}
+	if !ret.RolledBack {
+		t.Errorf("expected migration to be rolled back")
+	}
+	if got, want := strings.Join(ops, "\n"), "create \ndelete "+testIndexName2+" "; got != want {
+		t.Errorf("expected operations\n%s\ngot\n%s", want, got)
+	}
+}
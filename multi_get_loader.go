@@ -0,0 +1,258 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MultiGetLoader coalesces concurrent requests for single documents into
+// multi get requests. Instead of sending one request per document, the
+// loader collects the documents requested within a short time window
+// (or until a maximum number of documents has been requested), fetches
+// them with MultiGetService, and passes each result back to its caller.
+// Concurrent requests for the same document are only fetched once.
+//
+// A MultiGetLoader is safe for concurrent use, e.g.:
+//
+//	loader := client.MultiGetLoader().Wait(2 * time.Millisecond)
+//	defer loader.Close()
+//	...
+//	// In request handlers
+//	res, err := loader.Get("twitter", "tweet", "1")
+//
+// Like GetService, Get returns a GetResult with Found set to false if
+// the document does not exist.
+type MultiGetLoader struct {
+	client     *Client
+	wait       time.Duration
+	maxBatch   int
+	preference string
+	realtime   *bool
+
+	mu     sync.Mutex
+	batch  *multiGetLoaderBatch
+	closed bool
+	wg     sync.WaitGroup // in-flight batches
+	stats  MultiGetLoaderStats
+}
+
+// MultiGetLoaderStats are statistics of a MultiGetLoader.
+type MultiGetLoaderStats struct {
+	Loads        int64 // number of documents requested by callers
+	Deduplicated int64 // number of requests served by a pending request for the same document
+	Requests     int64 // number of multi get requests sent to Elasticsearch
+	Failed       int64 // number of failed multi get requests
+}
+
+// multiGetLoaderBatch is a set of documents that are fetched
+// in a single multi get request.
+type multiGetLoaderBatch struct {
+	items []*MultiGetItem
+	calls map[string]*multiGetLoaderCall
+	keys  []string
+	timer *time.Timer
+}
+
+// multiGetLoaderCall is the pending result for a single document.
+type multiGetLoaderCall struct {
+	done chan struct{}
+	res  *GetResult
+	err  error
+}
+
+// NewMultiGetLoader creates a new MultiGetLoader.
+func NewMultiGetLoader(client *Client) *MultiGetLoader {
+	return &MultiGetLoader{
+		client:   client,
+		wait:     time.Millisecond,
+		maxBatch: 100,
+	}
+}
+
+// Wait is the time to wait for more requests after the first document
+// of a batch has been requested (default: 1ms).
+func (l *MultiGetLoader) Wait(wait time.Duration) *MultiGetLoader {
+	l.wait = wait
+	return l
+}
+
+// MaxBatchSize is the maximum number of documents fetched in a single
+// multi get request (default: 100). A request is sent as soon as this
+// number of documents has been requested.
+func (l *MultiGetLoader) MaxBatchSize(maxBatch int) *MultiGetLoader {
+	l.maxBatch = maxBatch
+	return l
+}
+
+// Preference specifies the node or shard the operation should be
+// performed on (default: random).
+func (l *MultiGetLoader) Preference(preference string) *MultiGetLoader {
+	l.preference = preference
+	return l
+}
+
+// Realtime specifies whether to perform the operation in realtime
+// or search mode.
+func (l *MultiGetLoader) Realtime(realtime bool) *MultiGetLoader {
+	l.realtime = &realtime
+	return l
+}
+
+// Stats returns statistics of the loader.
+func (l *MultiGetLoader) Stats() MultiGetLoaderStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Get runs GetC() with default context.
+func (l *MultiGetLoader) Get(index, typ, id string) (*GetResult, error) {
+	return l.GetC(nil, index, typ, id)
+}
+
+// GetC requests the document with the given index, type, and id.
+func (l *MultiGetLoader) GetC(ctx context.Context, index, typ, id string) (*GetResult, error) {
+	return l.LoadC(ctx, NewMultiGetItem().Index(index).Type(typ).Id(id))
+}
+
+// Load runs LoadC() with default context.
+func (l *MultiGetLoader) Load(item *MultiGetItem) (*GetResult, error) {
+	return l.LoadC(nil, item)
+}
+
+// LoadC requests the document described by item, e.g. with a routing
+// value or specific fields. If the context is cancelled, LoadC returns
+// immediately, but the document is still fetched for other callers.
+func (l *MultiGetLoader) LoadC(ctx context.Context, item *MultiGetItem) (*GetResult, error) {
+	if item.index == "" {
+		return nil, ErrMissingIndex
+	}
+	if item.id == "" {
+		return nil, ErrMissingId
+	}
+	key, err := json.Marshal(item.Source())
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, errors.New("elastic: multi get loader is closed")
+	}
+	l.stats.Loads++
+	if l.batch == nil {
+		l.batch = &multiGetLoaderBatch{calls: make(map[string]*multiGetLoaderCall)}
+		batch := l.batch
+		batch.timer = time.AfterFunc(l.wait, func() {
+			l.mu.Lock()
+			l.dispatchLocked(batch)
+			l.mu.Unlock()
+		})
+	}
+	batch := l.batch
+	call, found := batch.calls[string(key)]
+	if found {
+		l.stats.Deduplicated++
+	} else {
+		call = &multiGetLoaderCall{done: make(chan struct{})}
+		batch.calls[string(key)] = call
+		batch.keys = append(batch.keys, string(key))
+		batch.items = append(batch.items, item)
+		if l.maxBatch > 0 && len(batch.items) >= l.maxBatch {
+			l.dispatchLocked(batch)
+		}
+	}
+	l.mu.Unlock()
+
+	if ctx == nil {
+		<-call.done
+		return call.res, call.err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.res, call.err
+	}
+}
+
+// Flush sends the pending requests immediately.
+func (l *MultiGetLoader) Flush() {
+	l.mu.Lock()
+	if l.batch != nil {
+		l.dispatchLocked(l.batch)
+	}
+	l.mu.Unlock()
+}
+
+// Close sends the pending requests and waits for all requests to complete.
+// Subsequent requests return an error.
+func (l *MultiGetLoader) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	if l.batch != nil {
+		l.dispatchLocked(l.batch)
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+	return nil
+}
+
+// dispatchLocked sends the batch unless it has been sent already.
+// The caller must hold l.mu.
+func (l *MultiGetLoader) dispatchLocked(batch *multiGetLoaderBatch) {
+	if l.batch != batch {
+		return // already dispatched
+	}
+	l.batch = nil
+	batch.timer.Stop()
+	l.stats.Requests++
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		err := l.fetch(batch)
+		if err != nil {
+			l.mu.Lock()
+			l.stats.Failed++
+			l.mu.Unlock()
+		}
+	}()
+}
+
+// fetch runs the multi get request for the batch and passes the results
+// to the callers.
+func (l *MultiGetLoader) fetch(batch *multiGetLoaderBatch) error {
+	mget := l.client.MultiGet().Add(batch.items...)
+	if l.preference != "" {
+		mget = mget.Preference(l.preference)
+	}
+	if l.realtime != nil {
+		mget = mget.Realtime(*l.realtime)
+	}
+	res, err := mget.Do()
+	if err == nil && len(res.Docs) != len(batch.items) {
+		err = fmt.Errorf("elastic: expected %d documents from multi get; got %d", len(batch.items), len(res.Docs))
+	}
+	for i, key := range batch.keys {
+		call := batch.calls[key]
+		switch {
+		case err != nil:
+			call.err = err
+		case res.Docs[i].Error != "":
+			call.err = fmt.Errorf("elastic: unable to get document %s/%s/%s: %s", res.Docs[i].Index, res.Docs[i].Type, res.Docs[i].Id, res.Docs[i].Error)
+		default:
+			call.res = res.Docs[i]
+		}
+		close(call.done)
+	}
+	return err
+}
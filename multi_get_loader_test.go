@@ -0,0 +1,139 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMultiGetLoaderCoalescesRequests(t *testing.T) {
+	ts := newRepositoryTestServer()
+	defer ts.Close()
+	for i := 0; i < 10; i++ {
+		ts.put(fmt.Sprintf("%d", i), fmt.Sprintf(`{"user":"olivere","message":"Message %d"}`, i))
+	}
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader := client.MultiGetLoader().Wait(50 * time.Millisecond)
+	defer loader.Close()
+
+	const callers = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("%d", i%12) // 10 and 11 do not exist
+			res, err := loader.Get(testIndexName, "tweet", id)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if res.Id != id {
+				errs <- fmt.Errorf("expected document %q; got %q", id, res.Id)
+				return
+			}
+			if found := i%12 < 10; res.Found != found {
+				errs <- fmt.Errorf("expected Found = %v for document %q; got %v", found, id, res.Found)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	stats := loader.Stats()
+	if got, want := stats.Loads, int64(callers); got != want {
+		t.Errorf("expected Loads = %d; got %d", want, got)
+	}
+	if got, want := stats.Requests, int64(1); got != want {
+		t.Errorf("expected Requests = %d; got %d", want, got)
+	}
+	if got, want := stats.Deduplicated, int64(callers-12); got != want {
+		t.Errorf("expected Deduplicated = %d; got %d", want, got)
+	}
+	if got, want := len(ts.requests), 1; got != want {
+		t.Errorf("expected %d requests; got %d: %v", want, got, ts.requests)
+	}
+}
+
+func TestMultiGetLoaderMaxBatchSize(t *testing.T) {
+	ts := newRepositoryTestServer()
+	defer ts.Close()
+	for i := 0; i < 10; i++ {
+		ts.put(fmt.Sprintf("%d", i), `{"user":"olivere"}`)
+	}
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader := client.MultiGetLoader().Wait(time.Hour).MaxBatchSize(5)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := loader.Get(testIndexName, "tweet", fmt.Sprintf("%d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got, want := loader.Stats().Requests, int64(2); got != want {
+		t.Errorf("expected Requests = %d; got %d", want, got)
+	}
+
+	// Close flushes pending requests
+	done := make(chan error, 1)
+	go func() {
+		_, err := loader.Get(testIndexName, "tweet", "1")
+		done <- err
+	}()
+	for loader.Stats().Loads < 11 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := loader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loader.Get(testIndexName, "tweet", "1"); err == nil {
+		t.Error("expected error after Close")
+	}
+}
+
+func TestMultiGetLoaderCancel(t *testing.T) {
+	ts := newRepositoryTestServer()
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader := client.MultiGetLoader().Wait(time.Hour)
+	defer loader.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := loader.GetC(ctx, testIndexName, "tweet", "1"); err != context.DeadlineExceeded {
+		t.Errorf("expected %v; got %v", context.DeadlineExceeded, err)
+	}
+	if _, err := loader.Get("", "tweet", "1"); err != ErrMissingIndex {
+		t.Errorf("expected %v; got %v", ErrMissingIndex, err)
+	}
+}
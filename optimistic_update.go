@@ -0,0 +1,314 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// OptimisticUpdateFunc modifies a document in place. The document is
+// a map[string]interface{} by default, or a pointer to a new value of the
+// type passed to OptimisticUpdateService.DocType. Returning an error
+// aborts the update; the error is returned as-is.
+//
+// The func may be called several times if the document has been modified
+// concurrently, so it should not have side effects.
+type OptimisticUpdateFunc func(doc interface{}) error
+
+// OptimisticUpdateService safely modifies a document with optimistic
+// concurrency control: It gets the document along with its version,
+// calls a func to modify it, and indexes it again only if the version
+// in Elasticsearch is still the same. If the document has been modified
+// concurrently, it starts again, up to a maximum number of retries.
+//
+// Unlike UpdateService.RetryOnConflict, which only applies to scripts
+// and partial documents, the modification is done in Go, e.g.:
+//
+//	res, err := client.OptimisticUpdate().
+//		Index("twitter").Type("tweet").Id("1").
+//		DocType(Tweet{}).
+//		Do(func(doc interface{}) error {
+//			doc.(*Tweet).Retweets++
+//			return nil
+//		})
+//
+// If all retries fail, the error is of type *ConflictError.
+type OptimisticUpdateService struct {
+	client     *Client
+	index      string
+	typ        string
+	id         string
+	routing    string
+	parent     string
+	docType    reflect.Type
+	upsert     bool
+	refresh    bool
+	maxRetries int
+	backoff    Backoff
+}
+
+// NewOptimisticUpdateService creates a new OptimisticUpdateService.
+func NewOptimisticUpdateService(client *Client) *OptimisticUpdateService {
+	return &OptimisticUpdateService{
+		client:     client,
+		maxRetries: 5,
+		backoff:    NewExponentialBackoff(10*time.Millisecond, 2*time.Second),
+	}
+}
+
+// Index is the name of the index.
+func (s *OptimisticUpdateService) Index(index string) *OptimisticUpdateService {
+	s.index = index
+	return s
+}
+
+// Type is the document type.
+func (s *OptimisticUpdateService) Type(typ string) *OptimisticUpdateService {
+	s.typ = typ
+	return s
+}
+
+// Id is the identifier of the document.
+func (s *OptimisticUpdateService) Id(id string) *OptimisticUpdateService {
+	s.id = id
+	return s
+}
+
+// Routing is the routing value of the document.
+func (s *OptimisticUpdateService) Routing(routing string) *OptimisticUpdateService {
+	s.routing = routing
+	return s
+}
+
+// Parent is the id of the parent document.
+func (s *OptimisticUpdateService) Parent(parent string) *OptimisticUpdateService {
+	s.parent = parent
+	return s
+}
+
+// DocType specifies the Go type to decode the document into, taken from
+// a struct or a pointer to a struct, e.g. Tweet{}. The func passed to Do
+// then receives a pointer to that type, e.g. *Tweet. Fields tagged with
+// elastic:"_id" and elastic:"_version" are set (see Repository).
+func (s *OptimisticUpdateService) DocType(v interface{}) *OptimisticUpdateService {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	s.docType = t
+	return s
+}
+
+// Upsert indicates whether to create the document if it does not exist
+// (default: false). In that case, the func passed to Do receives an empty
+// document. If Upsert is false, Do returns ErrDocumentNotFound.
+func (s *OptimisticUpdateService) Upsert(upsert bool) *OptimisticUpdateService {
+	s.upsert = upsert
+	return s
+}
+
+// Refresh indicates whether to refresh the index after the document
+// has been saved (default: false).
+func (s *OptimisticUpdateService) Refresh(refresh bool) *OptimisticUpdateService {
+	s.refresh = refresh
+	return s
+}
+
+// MaxRetries is the number of times the update is retried after a
+// version conflict (default: 5).
+func (s *OptimisticUpdateService) MaxRetries(maxRetries int) *OptimisticUpdateService {
+	s.maxRetries = maxRetries
+	return s
+}
+
+// Backoff specifies how long to wait before retrying after a version
+// conflict. The default is an exponential backoff starting at 10ms.
+func (s *OptimisticUpdateService) Backoff(backoff Backoff) *OptimisticUpdateService {
+	s.backoff = backoff
+	return s
+}
+
+// Validate checks if the operation is valid.
+func (s *OptimisticUpdateService) Validate() error {
+	var invalid []string
+	if s.index == "" {
+		invalid = append(invalid, "Index")
+	}
+	if s.typ == "" {
+		invalid = append(invalid, "Type")
+	}
+	if s.id == "" {
+		invalid = append(invalid, "Id")
+	}
+	if s.docType != nil && s.docType.Kind() != reflect.Struct {
+		invalid = append(invalid, "DocType")
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("missing required fields: %v", invalid)
+	}
+	return nil
+}
+
+// OptimisticUpdateResult is the result of OptimisticUpdateService.Do.
+type OptimisticUpdateResult struct {
+	Index    string
+	Type     string
+	Id       string
+	Version  int64       // version of the saved document
+	Created  bool        // true if the document has been created
+	Attempts int         // number of attempts, i.e. 1 if there was no conflict
+	Doc      interface{} // the saved document
+}
+
+// Do runs DoC() with default context.
+func (s *OptimisticUpdateService) Do(fn OptimisticUpdateFunc) (*OptimisticUpdateResult, error) {
+	return s.DoC(nil, fn)
+}
+
+// DoC gets the document, modifies it with fn, and saves it, retrying
+// on version conflicts.
+func (s *OptimisticUpdateService) DoC(ctx context.Context, fn OptimisticUpdateFunc) (*OptimisticUpdateResult, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	var meta *docMetaFields
+	if s.docType != nil {
+		var err error
+		if meta, err = newDocMetaFields(s.docType); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, err := s.attempt(ctx, meta, fn)
+		if err == nil {
+			res.Attempts = attempt
+			return res, nil
+		}
+		if !IsConflict(err) {
+			return nil, err
+		}
+		conflict := &ConflictError{Index: s.index, Type: s.typ, Id: s.id, Attempts: attempt, Err: err}
+		if attempt > s.maxRetries {
+			return nil, conflict
+		}
+		wait, goahead := time.Duration(0), true
+		if s.backoff != nil {
+			wait, goahead = s.backoff.Next(attempt)
+		}
+		if !goahead {
+			return nil, conflict
+		}
+		s.client.errorf("elastic: version conflict updating %s/%s/%s; will retry in %v", s.index, s.typ, s.id, wait)
+		if ctx == nil {
+			time.Sleep(wait)
+			continue
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// attempt runs a single get/modify/put cycle.
+func (s *OptimisticUpdateService) attempt(ctx context.Context, meta *docMetaFields, fn OptimisticUpdateFunc) (*OptimisticUpdateResult, error) {
+	get := s.client.Get().Index(s.index).Type(s.typ).Id(s.id)
+	if s.routing != "" {
+		get = get.Routing(s.routing)
+	}
+	if s.parent != "" {
+		get = get.Parent(s.parent)
+	}
+	current, err := get.DoC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !current.Found && !s.upsert {
+		return nil, ErrDocumentNotFound
+	}
+
+	// Decode
+	var doc interface{}
+	if s.docType != nil {
+		ptr := reflect.New(s.docType)
+		if current.Source != nil {
+			if err := json.Unmarshal(*current.Source, ptr.Interface()); err != nil {
+				return nil, &DecodeError{Index: s.index, Type: s.typ, Id: s.id, Err: err}
+			}
+		}
+		meta.setString(ptr.Elem(), "_id", s.id)
+		meta.setInt(ptr.Elem(), "_version", current.Version)
+		doc = ptr.Interface()
+	} else {
+		m := make(map[string]interface{})
+		if current.Source != nil {
+			if err := json.Unmarshal(*current.Source, &m); err != nil {
+				return nil, &DecodeError{Index: s.index, Type: s.typ, Id: s.id, Err: err}
+			}
+		}
+		doc = m
+	}
+
+	// Modify
+	if err := fn(doc); err != nil {
+		return nil, err
+	}
+
+	// Put
+	index := s.client.Index().Index(s.index).Type(s.typ).Id(s.id).BodyJson(doc)
+	if current.Found {
+		index = index.Version(current.Version)
+	} else {
+		index = index.OpType("create")
+	}
+	if s.routing != "" {
+		index = index.Routing(s.routing)
+	}
+	if s.parent != "" {
+		index = index.Parent(s.parent)
+	}
+	if s.refresh {
+		index = index.Refresh(true)
+	}
+	res, err := index.DoC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.docType != nil {
+		meta.setInt(reflect.ValueOf(doc).Elem(), "_version", int64(res.Version))
+	}
+	return &OptimisticUpdateResult{
+		Index:   res.Index,
+		Type:    res.Type,
+		Id:      res.Id,
+		Version: int64(res.Version),
+		Created: !current.Found,
+		Doc:     doc,
+	}, nil
+}
+
+// ConflictError is returned from OptimisticUpdateService when the
+// document could not be saved due to concurrent modifications, even
+// after retrying.
+type ConflictError struct {
+	Index    string
+	Type     string
+	Id       string
+	Attempts int   // number of attempts
+	Err      error // the last error returned from Elasticsearch
+}
+
+// Error returns a string representation of the error.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("elastic: unable to update document %s/%s/%s after %d attempts due to version conflicts: %v", e.Index, e.Type, e.Id, e.Attempts, e.Err)
+}
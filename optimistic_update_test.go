@@ -0,0 +1,155 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOptimisticUpdateRetriesOnConflict(t *testing.T) {
+	ts := newRepositoryTestServer()
+	defer ts.Close()
+	ts.put("1", `{"user":"olivere","message":"Welcome","retweets":0}`)
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	res, err := client.OptimisticUpdate().
+		Index(testIndexName).Type("tweet").Id("1").
+		DocType(repositoryTweet{}).
+		Backoff(ZeroBackoff{}).
+		Do(func(doc interface{}) error {
+			calls++
+			if calls == 1 {
+				// Concurrent modification
+				ts.put("1", `{"user":"olivere","message":"Welcome","retweets":10}`)
+			}
+			doc.(*repositoryTweet).Retweets++
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := calls, 2; got != want {
+		t.Errorf("expected %d calls; got %d", want, got)
+	}
+	if got, want := res.Attempts, 2; got != want {
+		t.Errorf("expected Attempts = %d; got %d", want, got)
+	}
+	if got, want := res.Version, int64(3); got != want {
+		t.Errorf("expected Version = %d; got %d", want, got)
+	}
+	tweet := res.Doc.(*repositoryTweet)
+	if got, want := tweet.Retweets, 11; got != want {
+		t.Errorf("expected Retweets = %d; got %d", want, got)
+	}
+	if got, want := tweet.Version, int64(3); got != want {
+		t.Errorf("expected tagged Version = %d; got %d", want, got)
+	}
+	if got, want := ts.docs["1"].Source, `{"user":"olivere","message":"Welcome","retweets":11}`; got != want {
+		t.Errorf("expected source %s; got %s", want, got)
+	}
+}
+
+func TestOptimisticUpdateConflictError(t *testing.T) {
+	ts := newRepositoryTestServer()
+	defer ts.Close()
+	ts.put("1", `{"user":"olivere","retweets":0}`)
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	_, err = client.OptimisticUpdate().
+		Index(testIndexName).Type("tweet").Id("1").
+		MaxRetries(2).
+		Backoff(ZeroBackoff{}).
+		Do(func(doc interface{}) error {
+			calls++
+			ts.put("1", `{"user":"sandrae","retweets":0}`)
+			doc.(map[string]interface{})["retweets"] = 1
+			return nil
+		})
+	if err == nil {
+		t.Fatal("expected conflict")
+	}
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatalf("expected *ConflictError; got %T: %v", err, err)
+	}
+	if got, want := conflict.Attempts, 3; got != want {
+		t.Errorf("expected Attempts = %d; got %d", want, got)
+	}
+	if got, want := calls, 3; got != want {
+		t.Errorf("expected %d calls; got %d", want, got)
+	}
+	if !IsConflict(err) || !IsConflict(conflict.Err) {
+		t.Errorf("expected IsConflict to be true for %v and %v", err, conflict.Err)
+	}
+}
+
+func TestOptimisticUpdateNotFoundAndUpsert(t *testing.T) {
+	ts := newRepositoryTestServer()
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewRepository(client, testIndexName, "tweet", repositoryTweet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	incr := func(doc interface{}) error {
+		doc.(*repositoryTweet).Retweets++
+		return nil
+	}
+
+	// Not found
+	if _, err := repo.Modify("1", incr); err != ErrDocumentNotFound {
+		t.Fatalf("expected %v; got %v", ErrDocumentNotFound, err)
+	}
+
+	// Upsert
+	res, err := client.OptimisticUpdate().
+		Index(testIndexName).Type("tweet").Id("1").
+		DocType(&repositoryTweet{}).
+		Upsert(true).
+		Do(incr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Created {
+		t.Errorf("expected Created = %v; got %v", true, res.Created)
+	}
+
+	// Modify via repository
+	res, err = repo.Modify("1", incr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created {
+		t.Errorf("expected Created = %v; got %v", false, res.Created)
+	}
+	if got, want := res.Doc.(*repositoryTweet).Retweets, 2; got != want {
+		t.Errorf("expected Retweets = %d; got %d", want, got)
+	}
+	if got, want := res.Doc.(*repositoryTweet).Id, "1"; got != want {
+		t.Errorf("expected Id = %q; got %q", want, got)
+	}
+
+	// Errors from the func abort the update
+	abort := errors.New("abort")
+	_, err = repo.Modify("1", func(doc interface{}) error { return abort })
+	if err != abort {
+		t.Errorf("expected %v; got %v", abort, err)
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// QueryByExample builds a query from a Go struct that holds the values
+// to search for, e.g. the filter form of an admin search screen.
+//
+// Fields with a zero value are ignored; use pointers to search for
+// zero values like false or 0. All other fields are combined with AND:
+//
+//   - strings become match queries, other values become term filters,
+//   - slices become terms filters,
+//   - fields named MinXxx and MaxXxx become a range filter on field xxx,
+//     e.g. min_age, minAge (both "age") or MinAge ("Age" without a JSON name),
+//   - struct fields are searched as objects, i.e. their fields are
+//     prefixed with the name of the struct field.
+//
+// The names of the fields are taken from the json struct tag. Use the
+// search struct tag to change how a field is searched, e.g.:
+//
+//	type TweetSearch struct {
+//		Message     string    `json:"message" search:"match=phrase"`
+//		User        string    `json:"user" search:"exact"`
+//		Tags        []string  `json:"tags"`
+//		MinRetweets int       `json:"min_retweets"`
+//		After       time.Time `json:"after" search:"field=created,gt"`
+//		Comment     *Comment  `json:"comments" search:"nested"`
+//		Internal    string    `search:"-"`
+//	}
+//
+// The following options are supported:
+//
+//   - field=name searches the field with the given name.
+//   - exact searches strings with a term filter instead of a match query.
+//   - analyzed searches other values with a match query.
+//   - match=phrase, match=phrase_prefix, match=prefix or match=wildcard
+//     change the type of the match query.
+//   - operator=and sets the operator of the match query.
+//   - gt, gte, lt and lte use the field as a bound of a range filter.
+//     MinXxx fields default to gte, MaxXxx fields to lte.
+//   - nested searches the fields of a struct with a nested filter; nested=path
+//     adds a single field to the nested filter for path.
+//   - "-" ignores the field.
+type QueryByExample struct {
+	example interface{}
+	tagName string
+}
+
+// NewQueryByExample creates a new QueryByExample from a struct value
+// (or pointer to a struct).
+func NewQueryByExample(example interface{}) *QueryByExample {
+	return &QueryByExample{
+		example: example,
+		tagName: "search",
+	}
+}
+
+// TagName sets the name of the struct tag with the search options.
+// It defaults to "search".
+func (q *QueryByExample) TagName(tagName string) *QueryByExample {
+	q.tagName = tagName
+	return q
+}
+
+// Query returns the query for the example, e.g. to pass it to
+// SearchService.Query. It returns a MatchAllQuery if all fields
+// of the example are empty.
+func (q *QueryByExample) Query() (Query, error) {
+	v := reflect.ValueOf(q.example)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return NewMatchAllQuery(), nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("elastic: query by example requires a struct; got %v", q.example)
+	}
+	clauses := newExampleClauses()
+	if err := q.collect(clauses, v, "", nil); err != nil {
+		if e, ok := err.(exampleError); ok {
+			return nil, e.error
+		}
+		return nil, err
+	}
+	return clauses.query(), nil
+}
+
+// exampleClauses collects the clauses of a query, or of the query
+// of a nested filter.
+type exampleClauses struct {
+	queries    []Query
+	filters    []Filter
+	rangeNames []string
+	ranges     map[string]*RangeFilter
+	nestedPath []string
+	nested     map[string]*exampleClauses
+}
+
+func newExampleClauses() *exampleClauses {
+	return &exampleClauses{
+		ranges: make(map[string]*RangeFilter),
+		nested: make(map[string]*exampleClauses),
+	}
+}
+
+// rangeFilter returns the range filter for field, creating it if necessary.
+func (c *exampleClauses) rangeFilter(field string) *RangeFilter {
+	if f, found := c.ranges[field]; found {
+		return f
+	}
+	f := NewRangeFilter(field)
+	c.ranges[field] = &f
+	c.rangeNames = append(c.rangeNames, field)
+	return &f
+}
+
+// nestedClauses returns the clauses of the nested filter for path,
+// creating them if necessary.
+func (c *exampleClauses) nestedClauses(path string) *exampleClauses {
+	if n, found := c.nested[path]; found {
+		return n
+	}
+	n := newExampleClauses()
+	c.nested[path] = n
+	c.nestedPath = append(c.nestedPath, path)
+	return n
+}
+
+// filter combines all filters (including range and nested filters)
+// and returns nil if there are none.
+func (c *exampleClauses) filter() Filter {
+	filters := append([]Filter{}, c.filters...)
+	for _, field := range c.rangeNames {
+		filters = append(filters, *c.ranges[field])
+	}
+	for _, path := range c.nestedPath {
+		n := c.nested[path]
+		if len(n.queries) > 0 {
+			filters = append(filters, NewNestedFilter(path).Query(n.query()))
+		} else if f := n.filter(); f != nil {
+			filters = append(filters, NewNestedFilter(path).Filter(f))
+		}
+	}
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0]
+	}
+	return NewBoolFilter().Must(filters...)
+}
+
+func (c *exampleClauses) query() Query {
+	var query Query
+	if len(c.queries) > 0 {
+		query = NewBoolQuery().Must(c.queries...)
+	}
+	filter := c.filter()
+	if filter == nil {
+		if query == nil {
+			return NewMatchAllQuery()
+		}
+		return query
+	}
+	if query == nil {
+		query = NewMatchAllQuery()
+	}
+	return NewFilteredQuery(query).Filter(filter)
+}
+
+// exampleError is an error that already contains the field of the
+// example it refers to, so it is not wrapped again for parent structs.
+type exampleError struct {
+	error
+}
+
+// collect adds the clauses for the fields of the struct v to clauses.
+// Prefix is prepended to the field names of v, parents is used to
+// detect recursive types.
+func (q *QueryByExample) collect(clauses *exampleClauses, v reflect.Value, prefix string, parents []reflect.Type) error {
+	t := v.Type()
+	for _, parent := range parents {
+		if parent == t {
+			return exampleError{fmt.Errorf("elastic: query by example of recursive type %v", t)}
+		}
+	}
+	parents = append(parents, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+		name, ok := structMappingFieldName(field)
+		if !ok {
+			continue
+		}
+		params, err := parseStructMappingTag(field.Tag.Get(q.tagName))
+		if err != nil {
+			return exampleError{fmt.Errorf("elastic: invalid tag of field %s.%s: %v", t.Name(), field.Name, err)}
+		}
+		if params == nil {
+			continue
+		}
+
+		fv := v.Field(i)
+		for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface) && fv.IsNil() {
+			continue
+		}
+
+		// Embedded structs without a json name are inlined
+		if field.Anonymous && field.Tag.Get("json") == "" && fv.Kind() == reflect.Struct {
+			if err := q.collect(clauses, fv, prefix, parents); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue // unexported embedded non-struct
+		}
+
+		if err := q.collectField(clauses, field, fv, prefix, name, params, parents); err != nil {
+			if _, ok := err.(exampleError); ok {
+				return err
+			}
+			return exampleError{fmt.Errorf("elastic: field %s.%s: %v", t.Name(), field.Name, err)}
+		}
+	}
+	return nil
+}
+
+// collectField adds the clause for a single field. A pointer field
+// that is set is always used, even if it points to a zero value.
+func (q *QueryByExample) collectField(clauses *exampleClauses, field reflect.StructField, v reflect.Value, prefix, name string, params map[string]interface{}, parents []reflect.Type) error {
+	isPtr := field.Type.Kind() == reflect.Ptr || field.Type.Kind() == reflect.Interface
+	if !isPtr && isZeroValue(v) {
+		return nil
+	}
+
+	// Range bounds
+	bound := ""
+	for _, op := range []string{"gt", "gte", "lt", "lte"} {
+		if params[op] == true {
+			if bound != "" {
+				return fmt.Errorf("conflicting range options %s and %s", bound, op)
+			}
+			bound = op
+		}
+	}
+	if bound == "" {
+		if isRange, isMin := exampleRangeField(field.Name); isRange {
+			name = exampleRangeName(name)
+			if isMin {
+				bound = "gte"
+			} else {
+				bound = "lte"
+			}
+		}
+	}
+
+	if f, found := params["field"]; found {
+		name = fmt.Sprint(f)
+	}
+	name = prefix + name
+
+	// Nested filter for a single field
+	if path, found := params["nested"].(string); found {
+		clauses = clauses.nestedClauses(path)
+		if !strings.HasPrefix(name, path+".") {
+			name = path + "." + name
+		}
+	}
+
+	if bound != "" {
+		f := clauses.rangeFilter(name)
+		value := v.Interface()
+		switch bound {
+		case "gt":
+			*f = f.Gt(value)
+		case "gte":
+			*f = f.Gte(value)
+		case "lt":
+			*f = f.Lt(value)
+		case "lte":
+			*f = f.Lte(value)
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType || v.Type() == geoPointType {
+			break
+		}
+		if params["nested"] == true {
+			clauses = clauses.nestedClauses(name)
+		}
+		return q.collect(clauses, v, name+".", parents)
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return nil
+		}
+		values := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			values[i] = v.Index(i).Interface()
+		}
+		clauses.filters = append(clauses.filters, NewTermsFilter(name, values...))
+		return nil
+	case reflect.Map, reflect.Chan, reflect.Func:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+
+	value := v.Interface()
+	analyzed := v.Kind() == reflect.String
+	if params["exact"] == true {
+		analyzed = false
+	}
+	if params["analyzed"] == true {
+		analyzed = true
+	}
+	match, _ := params["match"].(string)
+
+	switch match {
+	case "prefix":
+		clauses.queries = append(clauses.queries, NewPrefixQuery(name, fmt.Sprint(value)))
+		return nil
+	case "wildcard":
+		clauses.queries = append(clauses.queries, NewWildcardQuery(name, fmt.Sprint(value)))
+		return nil
+	case "", "boolean", "phrase", "phrase_prefix":
+	default:
+		return fmt.Errorf("unsupported match type %q", match)
+	}
+	if !analyzed && match == "" {
+		clauses.filters = append(clauses.filters, NewTermFilter(name, value))
+		return nil
+	}
+	mq := NewMatchQuery(name, value)
+	if match != "" {
+		mq = mq.Type(match)
+	}
+	if operator, found := params["operator"]; found {
+		mq = mq.Operator(fmt.Sprint(operator))
+	}
+	clauses.queries = append(clauses.queries, mq)
+	return nil
+}
+
+// exampleRangeField returns true if name is of the form MinXxx or
+// MaxXxx, and whether it is the lower bound.
+func exampleRangeField(name string) (isRange bool, isMin bool) {
+	for _, prefix := range []string{"Min", "Max"} {
+		if len(name) > len(prefix) && strings.HasPrefix(name, prefix) {
+			r := rune(name[len(prefix)])
+			if unicode.IsUpper(r) || r == '_' {
+				return true, prefix == "Min"
+			}
+		}
+	}
+	return false, false
+}
+
+// exampleRangeName removes the min or max prefix from the name of a
+// range field, e.g. "min_age" becomes "age", "minAge" becomes "age",
+// and "MaxAge" (i.e. a field without a JSON name) becomes "Age".
+func exampleRangeName(name string) string {
+	if len(name) > 3 {
+		switch strings.ToLower(name[:3]) {
+		case "min", "max":
+			rest := name[3:]
+			if strings.HasPrefix(rest, "_") {
+				return rest[1:]
+			}
+			if unicode.IsLower(rune(name[0])) {
+				// camelCase, e.g. "minAge"
+				r, n := utf8.DecodeRuneInString(rest)
+				return string(unicode.ToLower(r)) + rest[n:]
+			}
+			return rest
+		}
+	}
+	return name
+}
+
+// isZeroValue returns true if v is the zero value of its type, or an
+// empty slice or map.
+func isZeroValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t.IsZero()
+		}
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
@@ -0,0 +1,211 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type queryByExampleComment struct {
+	User    string `json:"user" search:"exact"`
+	Message string `json:"message"`
+	MinLen  int    `json:"min_len"`
+}
+
+type queryByExampleAuthor struct {
+	Name    string `json:"name" search:"exact"`
+	Country string `json:"country" search:"exact"`
+}
+
+type queryByExampleSearch struct {
+	Message      string                 `json:"message" search:"match=phrase"`
+	Title        string                 `json:"title" search:"operator=and"`
+	User         string                 `json:"user" search:"exact"`
+	Prefix       string                 `json:"prefix" search:"field=user,match=prefix"`
+	Retweets     int                    `json:"retweets"`
+	Public       *bool                  `json:"public"`
+	Tags         []string               `json:"tags"`
+	MinRetweets  int                    `json:"min_retweets"`
+	MaxRetweets  *int                   `json:"max_retweets"`
+	After        time.Time              `json:"after" search:"field=created,gt"`
+	Author       queryByExampleAuthor   `json:"author"`
+	Comments     *queryByExampleComment `json:"comments" search:"nested"`
+	ReplyUser    string                 `json:"reply_user" search:"field=user,nested=replies,exact"`
+	Internal     string                 `json:"internal" search:"-"`
+	notExported  string
+	IgnoredByTag string `json:"-"`
+}
+
+func TestQueryByExample(t *testing.T) {
+	yes := true
+	zero := 0
+	tests := []struct {
+		Example  interface{}
+		Expected string
+	}{
+		// #0
+		{
+			queryByExampleSearch{},
+			`{"match_all":{}}`,
+		},
+		// #1
+		{
+			&queryByExampleSearch{Message: "hello world", Internal: "x", notExported: "y", IgnoredByTag: "z"},
+			`{"bool":{"must":{"match":{"message":{"query":"hello world","type":"phrase"}}}}}`,
+		},
+		// #2
+		{
+			queryByExampleSearch{User: "olivere", Public: &yes, Tags: []string{"go", "elasticsearch"}},
+			`{"filtered":{"filter":{"bool":{"must":[{"term":{"user":"olivere"}},{"term":{"public":true}},{"terms":{"tags":["go","elasticsearch"]}}]}},"query":{"match_all":{}}}}`,
+		},
+		// #3
+		{
+			queryByExampleSearch{Title: "golang", Retweets: 5},
+			`{"filtered":{"filter":{"term":{"retweets":5}},"query":{"bool":{"must":{"match":{"title":{"operator":"and","query":"golang"}}}}}}}`,
+		},
+		// #4
+		{
+			queryByExampleSearch{MinRetweets: 10, MaxRetweets: &zero},
+			`{"filtered":{"filter":{"range":{"retweets":{"from":10,"include_lower":true,"include_upper":true,"to":0}}},"query":{"match_all":{}}}}`,
+		},
+		// #5
+		{
+			queryByExampleSearch{After: time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC), Prefix: "oli"},
+			`{"filtered":{"filter":{"range":{"created":{"from":"2015-01-02T03:04:05Z","include_lower":false,"include_upper":true,"to":null}}},"query":{"bool":{"must":{"prefix":{"user":"oli"}}}}}}`,
+		},
+		// #6
+		{
+			queryByExampleSearch{Author: queryByExampleAuthor{Country: "de"}},
+			`{"filtered":{"filter":{"term":{"author.country":"de"}},"query":{"match_all":{}}}}`,
+		},
+		// #7
+		{
+			queryByExampleSearch{Comments: &queryByExampleComment{User: "sandrae", MinLen: 100}, ReplyUser: "olivere"},
+			`{"filtered":{"filter":{"bool":{"must":[{"nested":{"filter":{"bool":{"must":[{"term":{"comments.user":"sandrae"}},{"range":{"comments.len":{"from":100,"include_lower":true,"include_upper":true,"to":null}}}]}},"path":"comments"}},{"nested":{"filter":{"term":{"replies.user":"olivere"}},"path":"replies"}}]}},"query":{"match_all":{}}}}`,
+		},
+		// #8
+		{
+			queryByExampleSearch{Comments: &queryByExampleComment{Message: "great"}},
+			`{"filtered":{"filter":{"nested":{"path":"comments","query":{"bool":{"must":{"match":{"comments.message":{"query":"great"}}}}}}},"query":{"match_all":{}}}}`,
+		},
+	}
+	for i, test := range tests {
+		q, err := NewQueryByExample(test.Example).Query()
+		if err != nil {
+			t.Fatalf("#%d: expected no error; got: %v", i, err)
+		}
+		data, err := json.Marshal(q.Source())
+		if err != nil {
+			t.Fatalf("#%d: marshaling to JSON failed: %v", i, err)
+		}
+		if got := string(data); got != test.Expected {
+			t.Errorf("#%d: expected\n%s\n,got:\n%s", i, test.Expected, got)
+		}
+	}
+}
+
+func TestQueryByExampleRangeNames(t *testing.T) {
+	type example struct {
+		MinAge      int       `json:"minAge"`
+		MaxAge      int       `json:"maxAge"`
+		MinCreated  time.Time `json:"min_created"`
+		MaxRetweets int
+	}
+	q, err := NewQueryByExample(example{
+		MinAge:      18,
+		MaxAge:      65,
+		MinCreated:  time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC),
+		MaxRetweets: 10,
+	}).Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(q.Source())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"filtered":{"filter":{"bool":{"must":[` +
+		`{"range":{"age":{"from":18,"include_lower":true,"include_upper":true,"to":65}}},` +
+		`{"range":{"created":{"from":"2015-01-02T00:00:00Z","include_lower":true,"include_upper":true,"to":null}}},` +
+		`{"range":{"Retweets":{"from":null,"include_lower":true,"include_upper":true,"to":10}}}]}},` +
+		`"query":{"match_all":{}}}}`
+	if got := string(data); got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+}
+
+func TestQueryByExampleTagName(t *testing.T) {
+	type example struct {
+		Name string `json:"name" qbe:"exact"`
+		Kind string `json:"kind" qbe:"-"`
+	}
+	q, err := NewQueryByExample(example{Name: "olivere", Kind: "user"}).TagName("qbe").Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(q.Source())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"filtered":{"filter":{"term":{"name":"olivere"}},"query":{"match_all":{}}}}`
+	if got := string(data); got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+}
+
+func TestQueryByExampleErrors(t *testing.T) {
+	type recursive struct {
+		Name  string     `json:"name"`
+		Child *recursive `json:"child"`
+	}
+	tests := []struct {
+		Example  interface{}
+		Expected string
+	}{
+		// #0
+		{
+			"not a struct",
+			`elastic: query by example requires a struct; got not a struct`,
+		},
+		// #1
+		{
+			struct {
+				Attrs map[string]string `json:"attrs"`
+			}{Attrs: map[string]string{"a": "b"}},
+			`elastic: field .Attrs: unsupported type map[string]string`,
+		},
+		// #2
+		{
+			struct {
+				Name string `search:"match=fuzzy"`
+			}{Name: "x"},
+			`elastic: field .Name: unsupported match type "fuzzy"`,
+		},
+		// #3
+		{
+			struct {
+				Age int `search:"gt,lt"`
+			}{Age: 1},
+			`elastic: field .Age: conflicting range options gt and lt`,
+		},
+		// #4
+		{
+			recursive{Name: "a", Child: &recursive{Name: "b", Child: &recursive{}}},
+			`elastic: query by example of recursive type elastic.recursive`,
+		},
+	}
+	for i, test := range tests {
+		_, err := NewQueryByExample(test.Example).Query()
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+			continue
+		}
+		if got := err.Error(); got != test.Expected {
+			t.Errorf("#%d: expected %q; got %q", i, test.Expected, got)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// QueryLanguage compiles a small text-based query language, e.g. as
+// typed by users in a dashboard, into BoolQuery, TermQuery, RangeQuery
+// and WildcardQuery builders. Unlike QueryStringQuery, the text is parsed
+// on the client side, so syntax errors are reported with their position
+// before anything is sent to Elasticsearch.
+//
+// The language consists of comparisons, combined with AND, OR, NOT
+// and parentheses:
+//
+//	status:error AND duration>500 AND NOT host:db*
+//	(level:warn OR level:error) user="John Doe"
+//
+// The comparisons are:
+//
+//	field:value, field=value   term query, or wildcard query if the value
+//	                           contains an unquoted * or ?
+//	field!=value               negated term or wildcard query
+//	field>value, field>=value  range query
+//	field<value, field<=value  range query
+//
+// Values are words or double-quoted strings with backslash escapes.
+// Unquoted numbers are passed as numbers. Comparisons without an
+// operator in between are combined with AND. AND binds stronger than
+// OR, and the keywords are case-insensitive. Directly after a comparison
+// operator, they are values like any other word, e.g. level:not.
+type QueryLanguage struct {
+	fields               map[string]string
+	allowLeadingWildcard bool
+}
+
+// NewQueryLanguage creates a new QueryLanguage. By default, all fields
+// may be used and leading wildcards are not allowed.
+func NewQueryLanguage() *QueryLanguage {
+	return &QueryLanguage{}
+}
+
+// AllowFields restricts the fields that may be used in a query to the
+// given names. It may be called more than once.
+func (l *QueryLanguage) AllowFields(fields ...string) *QueryLanguage {
+	if l.fields == nil {
+		l.fields = make(map[string]string)
+	}
+	for _, field := range fields {
+		l.fields[field] = field
+	}
+	return l
+}
+
+// FieldAlias allows name to be used in a query for field, e.g. "host"
+// for "host.raw". It implies a whitelist like AllowFields.
+func (l *QueryLanguage) FieldAlias(name, field string) *QueryLanguage {
+	if l.fields == nil {
+		l.fields = make(map[string]string)
+	}
+	l.fields[name] = field
+	return l
+}
+
+// AllowLeadingWildcard allows values that start with * or ?. Such
+// queries have to scan all terms of a field and are disabled by default.
+func (l *QueryLanguage) AllowLeadingWildcard(allow bool) *QueryLanguage {
+	l.allowLeadingWildcard = allow
+	return l
+}
+
+// Compile parses text and returns the query. Blank text returns a
+// MatchAllQuery. Syntax errors are of type *QuerySyntaxError.
+func (l *QueryLanguage) Compile(text string) (Query, error) {
+	p := &queryLanguageParser{l: l, text: text}
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+	if p.peek().kind == qlEOF {
+		return NewMatchAllQuery(), nil
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != qlEOF {
+		return nil, p.unexpected(tok)
+	}
+	return expr.query(), nil
+}
+
+// CompileQuery compiles text with a QueryLanguage with default settings.
+func CompileQuery(text string) (Query, error) {
+	return NewQueryLanguage().Compile(text)
+}
+
+// QuerySyntaxError is returned from QueryLanguage if the text cannot
+// be compiled.
+type QuerySyntaxError struct {
+	Offset int // byte offset of the error in the text
+	Msg    string
+}
+
+// Error returns a string representation of the error.
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("elastic: syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// -- Lexer --
+
+type qlTokenKind int
+
+const (
+	qlEOF qlTokenKind = iota
+	qlWord
+	qlString
+	qlOperator
+	qlAnd
+	qlOr
+	qlNot
+	qlLeftParen
+	qlRightParen
+)
+
+type qlToken struct {
+	kind qlTokenKind
+	text string // value of words and strings, or the operator
+	pos  int
+}
+
+// qlOperators lists the comparison operators, longest first.
+var qlOperators = []string{">=", "<=", "!=", ":", "=", ">", "<"}
+
+func isQueryLanguageDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`():=!<>"`, r)
+}
+
+type queryLanguageParser struct {
+	l      *QueryLanguage
+	text   string
+	tokens []qlToken
+	next   int
+}
+
+// scan splits the text into tokens.
+func (p *queryLanguageParser) scan() error {
+	text := p.text
+	pos := 0
+	for pos < len(text) {
+		r, size := utf8.DecodeRuneInString(text[pos:])
+		switch {
+		case unicode.IsSpace(r):
+			pos += size
+		case r == '(':
+			p.tokens = append(p.tokens, qlToken{kind: qlLeftParen, text: "(", pos: pos})
+			pos++
+		case r == ')':
+			p.tokens = append(p.tokens, qlToken{kind: qlRightParen, text: ")", pos: pos})
+			pos++
+		case r == '"':
+			s, n, err := scanQueryLanguageString(text, pos)
+			if err != nil {
+				return err
+			}
+			p.tokens = append(p.tokens, qlToken{kind: qlString, text: s, pos: pos})
+			pos += n
+		default:
+			found := false
+			for _, op := range qlOperators {
+				if strings.HasPrefix(text[pos:], op) {
+					p.tokens = append(p.tokens, qlToken{kind: qlOperator, text: op, pos: pos})
+					pos += len(op)
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+			if r == '!' {
+				return &QuerySyntaxError{Offset: pos, Msg: `unexpected "!"; use NOT or !=`}
+			}
+			start := pos
+			for pos < len(text) {
+				r, size := utf8.DecodeRuneInString(text[pos:])
+				if isQueryLanguageDelimiter(r) {
+					break
+				}
+				pos += size
+			}
+			word := text[start:pos]
+			tok := qlToken{kind: qlWord, text: word, pos: start}
+			switch strings.ToUpper(word) {
+			case "AND":
+				tok.kind = qlAnd
+			case "OR":
+				tok.kind = qlOr
+			case "NOT":
+				tok.kind = qlNot
+			}
+			p.tokens = append(p.tokens, tok)
+		}
+	}
+	p.tokens = append(p.tokens, qlToken{kind: qlEOF, pos: len(text)})
+	return nil
+}
+
+// scanQueryLanguageString scans the double-quoted string starting at
+// pos and returns its value and length in text.
+func scanQueryLanguageString(text string, pos int) (string, int, error) {
+	var buf []byte
+	for i := pos + 1; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '"':
+			return string(buf), i + 1 - pos, nil
+		case '\\':
+			if i+1 >= len(text) {
+				return "", 0, &QuerySyntaxError{Offset: i, Msg: "unterminated escape sequence"}
+			}
+			i++
+			buf = append(buf, text[i])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return "", 0, &QuerySyntaxError{Offset: pos, Msg: "unterminated string"}
+}
+
+// -- Parser --
+
+// qlExpr is a node of the parsed query. Negated expressions are
+// collected as must_not clauses of the enclosing AND.
+type qlExpr struct {
+	op       qlTokenKind // qlAnd, qlOr, qlNot, or qlEOF for a leaf
+	children []*qlExpr
+	leaf     Query
+}
+
+func (p *queryLanguageParser) peek() qlToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryLanguageParser) consume() qlToken {
+	tok := p.tokens[p.next]
+	if tok.kind != qlEOF {
+		p.next++
+	}
+	return tok
+}
+
+func (p *queryLanguageParser) unexpected(tok qlToken) error {
+	if tok.kind == qlEOF {
+		return &QuerySyntaxError{Offset: tok.pos, Msg: "unexpected end of query"}
+	}
+	return &QuerySyntaxError{Offset: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+}
+
+// parseOr parses: and { OR and }
+func (p *queryLanguageParser) parseOr() (*qlExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []*qlExpr{left}
+	for p.peek().kind == qlOr {
+		p.consume()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	if len(children) == 1 {
+		return left, nil
+	}
+	return &qlExpr{op: qlOr, children: children}, nil
+}
+
+// parseAnd parses: not { [AND] not }
+func (p *queryLanguageParser) parseAnd() (*qlExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	children := []*qlExpr{left}
+	for {
+		switch p.peek().kind {
+		case qlAnd:
+			p.consume()
+		case qlWord, qlNot, qlLeftParen:
+			// Implicit AND
+		default:
+			if len(children) == 1 {
+				return left, nil
+			}
+			return &qlExpr{op: qlAnd, children: children}, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+}
+
+// parseNot parses: NOT not | primary
+func (p *queryLanguageParser) parseNot() (*qlExpr, error) {
+	if p.peek().kind != qlNot {
+		return p.parsePrimary()
+	}
+	p.consume()
+	expr, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return &qlExpr{op: qlNot, children: []*qlExpr{expr}}, nil
+}
+
+// parsePrimary parses: "(" or ")" | comparison
+func (p *queryLanguageParser) parsePrimary() (*qlExpr, error) {
+	tok := p.consume()
+	switch tok.kind {
+	case qlLeftParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != qlRightParen {
+			if p.peek().kind == qlEOF {
+				return nil, &QuerySyntaxError{Offset: tok.pos, Msg: "missing closing parenthesis"}
+			}
+			return nil, p.unexpected(p.peek())
+		}
+		p.consume()
+		return expr, nil
+	case qlWord:
+		return p.parseComparison(tok)
+	case qlString:
+		return nil, &QuerySyntaxError{Offset: tok.pos, Msg: fmt.Sprintf("expected field name; got string %q", tok.text)}
+	}
+	return nil, p.unexpected(tok)
+}
+
+// parseComparison parses: field operator value
+func (p *queryLanguageParser) parseComparison(field qlToken) (*qlExpr, error) {
+	name, err := p.field(field)
+	if err != nil {
+		return nil, err
+	}
+	op := p.consume()
+	if op.kind != qlOperator {
+		if op.kind == qlEOF {
+			return nil, &QuerySyntaxError{Offset: op.pos, Msg: fmt.Sprintf("expected operator after %q", field.text)}
+		}
+		return nil, &QuerySyntaxError{Offset: op.pos, Msg: fmt.Sprintf("expected operator after %q; got %q", field.text, op.text)}
+	}
+	value := p.consume()
+	switch value.kind {
+	case qlAnd, qlOr, qlNot:
+		// A keyword following an operator is a value, e.g. in level:not
+		value.kind = qlWord
+	}
+	if value.kind != qlWord && value.kind != qlString {
+		if value.kind == qlEOF {
+			return nil, &QuerySyntaxError{Offset: value.pos, Msg: fmt.Sprintf("expected value after %q", field.text+op.text)}
+		}
+		return nil, &QuerySyntaxError{Offset: value.pos, Msg: fmt.Sprintf("expected value after %q; got %q", field.text+op.text, value.text)}
+	}
+
+	wildcard := value.kind == qlWord && strings.ContainsAny(value.text, "*?")
+	if wildcard && !p.l.allowLeadingWildcard && strings.IndexAny(value.text, "*?") == 0 {
+		return nil, &QuerySyntaxError{Offset: value.pos, Msg: fmt.Sprintf("leading wildcard in %q is not allowed", value.text)}
+	}
+
+	var q Query
+	switch op.text {
+	case ":", "=", "!=":
+		if wildcard {
+			q = NewWildcardQuery(name, value.text)
+		} else {
+			q = NewTermQuery(name, queryLanguageValue(value))
+		}
+	default:
+		if wildcard {
+			return nil, &QuerySyntaxError{Offset: value.pos, Msg: fmt.Sprintf("wildcard in %q is not allowed with %s", value.text, op.text)}
+		}
+		v := queryLanguageValue(value)
+		switch op.text {
+		case ">":
+			q = NewRangeQuery(name).Gt(v)
+		case ">=":
+			q = NewRangeQuery(name).Gte(v)
+		case "<":
+			q = NewRangeQuery(name).Lt(v)
+		case "<=":
+			q = NewRangeQuery(name).Lte(v)
+		}
+	}
+	expr := &qlExpr{op: qlEOF, leaf: q}
+	if op.text == "!=" {
+		expr = &qlExpr{op: qlNot, children: []*qlExpr{expr}}
+	}
+	return expr, nil
+}
+
+// field returns the name of the field in Elasticsearch, checking the
+// whitelist if there is one.
+func (p *queryLanguageParser) field(tok qlToken) (string, error) {
+	if p.l.fields == nil {
+		return tok.text, nil
+	}
+	name, found := p.l.fields[tok.text]
+	if !found {
+		return "", &QuerySyntaxError{Offset: tok.pos, Msg: fmt.Sprintf("unknown field %q", tok.text)}
+	}
+	return name, nil
+}
+
+// queryLanguageValue returns the value of a token: unquoted integers
+// and floats are returned as numbers, everything else as string.
+func queryLanguageValue(tok qlToken) interface{} {
+	if tok.kind == qlWord && strings.Trim(tok.text, "0123456789+-.eE") == "" {
+		if i, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(tok.text, 64); err == nil {
+			return f
+		}
+	}
+	return tok.text
+}
+
+// query returns the query for the expression. Negated children of AND
+// become must_not clauses of the same bool query.
+func (e *qlExpr) query() Query {
+	switch e.op {
+	case qlAnd:
+		q := NewBoolQuery()
+		for _, child := range e.children {
+			if child.op == qlNot {
+				q = q.MustNot(child.children[0].query())
+			} else {
+				q = q.Must(child.query())
+			}
+		}
+		return q
+	case qlOr:
+		q := NewBoolQuery()
+		for _, child := range e.children {
+			q = q.Should(child.query())
+		}
+		return q
+	case qlNot:
+		return NewBoolQuery().MustNot(e.children[0].query())
+	}
+	return e.leaf
+}
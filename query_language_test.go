@@ -0,0 +1,166 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestQueryLanguageCompile(t *testing.T) {
+	tests := []struct {
+		Text     string
+		Expected string
+	}{
+		// #0
+		{
+			``,
+			`{"match_all":{}}`,
+		},
+		// #1
+		{
+			`status:error`,
+			`{"term":{"status":"error"}}`,
+		},
+		// #2
+		{
+			`status:error AND duration>500 AND NOT host:db*`,
+			`{"bool":{"must":[{"term":{"status":"error"}},{"range":{"duration":{"from":500,"include_lower":false,"include_upper":true,"to":null}}}],"must_not":{"wildcard":{"host":{"wildcard":"db*"}}}}}`,
+		},
+		// #3
+		{
+			`(level:warn OR level:error) user="John \"JD\" Doe"`,
+			`{"bool":{"must":[{"bool":{"should":[{"term":{"level":"warn"}},{"term":{"level":"error"}}]}},{"term":{"user":"John \"JD\" Doe"}}]}}`,
+		},
+		// #4
+		{
+			`a:1 or b:2 and c:3`,
+			`{"bool":{"should":[{"term":{"a":1}},{"bool":{"must":[{"term":{"b":2}},{"term":{"c":3}}]}}]}}`,
+		},
+		// #5
+		{
+			`price>=9.99 price<20 created<="2015-01-01T12:00:00"`,
+			`{"bool":{"must":[{"range":{"price":{"from":9.99,"include_lower":true,"include_upper":true,"to":null}}},{"range":{"price":{"from":null,"include_lower":true,"include_upper":false,"to":20}}},{"range":{"created":{"from":null,"include_lower":true,"include_upper":true,"to":"2015-01-01T12:00:00"}}}]}}`,
+		},
+		// #6
+		{
+			`host!=db1 NOT NOT env:prod`,
+			`{"bool":{"must_not":[{"term":{"host":"db1"}},{"bool":{"must_not":{"term":{"env":"prod"}}}}]}}`,
+		},
+		// #7
+		{
+			`NOT status:ok`,
+			`{"bool":{"must_not":{"term":{"status":"ok"}}}}`,
+		},
+		// #8
+		{
+			`path:"/var/*" name:web?1 code:inf`,
+			`{"bool":{"must":[{"term":{"path":"/var/*"}},{"wildcard":{"name":{"wildcard":"web?1"}}},{"term":{"code":"inf"}}]}}`,
+		},
+		// #9
+		{
+			`level:not AND status:and OR mode!=Or`,
+			`{"bool":{"should":[{"bool":{"must":[{"term":{"level":"not"}},{"term":{"status":"and"}}]}},{"bool":{"must_not":{"term":{"mode":"Or"}}}}]}}`,
+		},
+	}
+	for i, test := range tests {
+		q, err := CompileQuery(test.Text)
+		if err != nil {
+			t.Errorf("#%d: expected no error; got: %v", i, err)
+			continue
+		}
+		data, err := json.Marshal(q.Source())
+		if err != nil {
+			t.Fatalf("#%d: marshaling to JSON failed: %v", i, err)
+		}
+		if got := string(data); got != test.Expected {
+			t.Errorf("#%d: expected\n%s\n,got:\n%s", i, test.Expected, got)
+		}
+	}
+}
+
+func TestQueryLanguageSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		Text   string
+		Offset int
+		Msg    string
+	}{
+		// #0
+		{`status`, 6, `expected operator after "status"`},
+		// #1
+		{`status:`, 7, `expected value after "status:"`},
+		// #2
+		{`status:error AND`, 16, `unexpected end of query`},
+		// #3
+		{`(a:1 OR b:2`, 0, `missing closing parenthesis`},
+		// #4
+		{`a:1)`, 3, `unexpected ")"`},
+		// #5
+		{`a:"open`, 2, `unterminated string`},
+		// #6
+		{`host:*db`, 5, `leading wildcard in "*db" is not allowed`},
+		// #7
+		{`duration>5*`, 9, `wildcard in "5*" is not allowed with >`},
+		// #8
+		{`a:1 OR OR b:2`, 7, `unexpected "OR"`},
+		// #9
+		{`"status":ok`, 0, `expected field name; got string "status"`},
+		// #10
+		{`a:1 !b:2`, 4, `unexpected "!"; use NOT or !=`},
+		// #11
+		{`a b:1`, 2, `expected operator after "a"; got "b"`},
+		// #12
+		{`a::1`, 2, `expected value after "a:"; got ":"`},
+	}
+	for i, test := range tests {
+		_, err := CompileQuery(test.Text)
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+			continue
+		}
+		e, ok := err.(*QuerySyntaxError)
+		if !ok {
+			t.Errorf("#%d: expected *QuerySyntaxError; got: %T", i, err)
+			continue
+		}
+		if got, want := e.Offset, test.Offset; got != want {
+			t.Errorf("#%d: expected offset %d; got: %d", i, want, got)
+		}
+		if got, want := e.Msg, test.Msg; got != want {
+			t.Errorf("#%d: expected message %q; got: %q", i, want, got)
+		}
+	}
+}
+
+func TestQueryLanguageFields(t *testing.T) {
+	l := NewQueryLanguage().AllowFields("status", "duration").FieldAlias("host", "host.raw").AllowLeadingWildcard(true)
+
+	q, err := l.Compile(`status:error host:*db`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(q.Source())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"bool":{"must":[{"term":{"status":"error"}},{"wildcard":{"host.raw":{"wildcard":"*db"}}}]}}`
+	if got := string(data); got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+
+	_, err = l.Compile(`status:error OR password:secret`)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	expectedErr := `elastic: syntax error at offset 16: unknown field "password"`
+	if got := err.Error(); got != expectedErr {
+		t.Errorf("expected %q; got %q", expectedErr, got)
+	}
+
+	// Fields must be used with their alias
+	if _, err := l.Compile(`host.raw:db1`); err == nil {
+		t.Errorf("expected error for host.raw")
+	}
+}
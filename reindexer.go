@@ -7,6 +7,9 @@ package elastic
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
 )
 
 // Reindexer simplifies the process of reindexing an index. You typically
@@ -28,6 +31,16 @@ import (
 // The caller is responsible for setting up and/or clearing the target index
 // before starting the reindex process.
 //
+// Long-running reindex processes can be made resumable by specifying a
+// ReindexerCheckpointStore with Checkpoint. The source index is then
+// scrolled in the order of the checkpoint field, and a checkpoint is saved
+// after every committed bulk. Resume continues from the last checkpoint.
+//
+// To speed up reindexing, the Reindexer can read the source index with
+// several parallel cursors (see Readers) and write to the target with
+// a BulkProcessor (see Workers). Use Throttle to limit the load on the
+// cluster.
+//
 // See http://www.elastic.co/guide/en/elasticsearch/guide/current/reindex.html
 // for more information about reindexing.
 type Reindexer struct {
@@ -41,6 +54,36 @@ type Reindexer struct {
 	reindexerFunc              ReindexerFunc
 	progress                   ReindexerProgressFunc
 	statsOnly                  bool
+	errorPolicy                ReindexerErrorPolicy
+	checkpointStore            ReindexerCheckpointStore
+	checkpointField            string
+	workers                    int
+	readers                    int
+	throttle                   float64
+}
+
+// ReindexerErrorPolicy specifies what a Reindexer does when
+// the ReindexerFunc returns an error for a hit.
+type ReindexerErrorPolicy int
+
+const (
+	// ReindexerAbort stops the Reindexer and returns the error. This is the default.
+	ReindexerAbort ReindexerErrorPolicy = iota
+	// ReindexerSkip skips the hit and only counts it in ReindexerResponse.Skipped.
+	ReindexerSkip
+	// ReindexerCollect skips the hit and adds the error to ReindexerResponse.HitErrors.
+	ReindexerCollect
+)
+
+// ReindexerHitError is an error returned by the ReindexerFunc for a hit.
+type ReindexerHitError struct {
+	Hit *SearchHit
+	Err error
+}
+
+// Error returns a string representation of the error.
+func (e *ReindexerHitError) Error() string {
+	return fmt.Sprintf("elastic: unable to reindex %s/%s/%s: %v", e.Hit.Index, e.Hit.Type, e.Hit.Id, e.Err)
 }
 
 // A ReindexerFunc receives each hit from the sourceIndex.
@@ -76,10 +119,17 @@ type ReindexerProgressFunc func(current, total int64)
 // By default, it returns the number of succeeded and failed bulk operations.
 // To return details about all failed items, set StatsOnly to false in
 // Reindexer.
+//
+// Skipped is the number of hits skipped due to the ReindexerErrorPolicy,
+// and HitErrors contains their errors if the policy is ReindexerCollect.
+// When resuming from a checkpoint, the numbers include the documents
+// processed before the checkpoint, while the errors do not.
 type ReindexerResponse struct {
-	Success int64
-	Failed  int64
-	Errors  []*BulkResponseItem
+	Success   int64
+	Failed    int64
+	Skipped   int64
+	Errors    []*BulkResponseItem
+	HitErrors []*ReindexerHitError
 }
 
 // NewReindexer returns a new Reindexer.
@@ -152,8 +202,85 @@ func (ix *Reindexer) StatsOnly(statsOnly bool) *Reindexer {
 	return ix
 }
 
-// Do starts the reindexing process.
+// ErrorPolicy specifies what to do when the ReindexerFunc returns
+// an error for a hit. The default is ReindexerAbort.
+func (ix *Reindexer) ErrorPolicy(policy ReindexerErrorPolicy) *Reindexer {
+	ix.errorPolicy = policy
+	return ix
+}
+
+// Checkpoint enables checkpointing, saving the progress to the given store
+// after every committed bulk. Use Resume to continue from the last
+// checkpoint. Notice that checkpointing sorts the source documents by the
+// checkpoint field, which is a bit slower than a plain scan.
+func (ix *Reindexer) Checkpoint(store ReindexerCheckpointStore) *Reindexer {
+	ix.checkpointStore = store
+	return ix
+}
+
+// CheckpointField specifies the field to sort by and to record in the
+// checkpoints. Its values must be unique, e.g. a not_analyzed id field
+// or a unique timestamp. The default is _uid.
+func (ix *Reindexer) CheckpointField(field string) *Reindexer {
+	ix.checkpointField = field
+	return ix
+}
+
+// Workers specifies the number of concurrent workers that commit bulk
+// requests to the target, using a BulkProcessor. By default, bulk requests
+// are committed synchronously while reading the source. Requests added by
+// the ReindexerFunc must specify the target index and type.
+func (ix *Reindexer) Workers(workers int) *Reindexer {
+	ix.workers = workers
+	return ix
+}
+
+// Readers specifies the number of cursors that read the source index in
+// parallel, using a ParallelScanService. By default, a single cursor is
+// used. Notice that the ReindexerFunc is still called sequentially.
+func (ix *Reindexer) Readers(readers int) *Reindexer {
+	ix.readers = readers
+	return ix
+}
+
+// Throttle limits the number of documents read from the source per second.
+// By default, the Reindexer runs at full speed.
+func (ix *Reindexer) Throttle(docsPerSecond float64) *Reindexer {
+	ix.throttle = docsPerSecond
+	return ix
+}
+
+// Do starts the reindexing process. If checkpointing is enabled,
+// an existing checkpoint is ignored and overwritten.
 func (ix *Reindexer) Do() (*ReindexerResponse, error) {
+	return ix.run(nil)
+}
+
+// Resume continues the reindexing process from the last checkpoint.
+// If there is no checkpoint yet, it starts from the beginning.
+func (ix *Reindexer) Resume() (*ReindexerResponse, error) {
+	if ix.checkpointStore == nil {
+		return nil, errors.New("no checkpoint store")
+	}
+	checkpoint, err := ix.checkpointStore.Load()
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint == nil {
+		return ix.run(nil)
+	}
+	field := ix.checkpointField
+	if field == "" {
+		field = "_uid"
+	}
+	if checkpoint.Field != field {
+		return nil, fmt.Errorf("checkpoint was saved for field %q, not %q", checkpoint.Field, field)
+	}
+	return ix.run(checkpoint)
+}
+
+// run reindexes all documents after the given checkpoint, if any.
+func (ix *Reindexer) run(checkpoint *ReindexerCheckpoint) (*ReindexerResponse, error) {
 	if ix.sourceClient == nil {
 		return nil, errors.New("no source client")
 	}
@@ -172,10 +299,31 @@ func (ix *Reindexer) Do() (*ReindexerResponse, error) {
 	if ix.scroll == "" {
 		ix.scroll = "5m"
 	}
+	if ix.checkpointField == "" {
+		ix.checkpointField = "_uid"
+	}
+	if ix.checkpointStore != nil && (ix.workers > 0 || ix.readers > 1) {
+		return nil, errors.New("checkpointing is not supported with concurrent workers or readers")
+	}
+
+	ret := &ReindexerResponse{
+		Errors: make([]*BulkResponseItem, 0),
+	}
+	if checkpoint == nil {
+		checkpoint = &ReindexerCheckpoint{Field: ix.checkpointField}
+	} else {
+		ret.Success = checkpoint.Success
+		ret.Failed = checkpoint.Failed
+		ret.Skipped = checkpoint.Skipped
+	}
+	if checkpoint.Completed {
+		return ret, nil
+	}
 
 	// Count total to report progress (if necessary)
 	var err error
-	var current, total int64
+	var total int64
+	current := checkpoint.Processed
 	if ix.progress != nil {
 		total, err = ix.count()
 		if err != nil {
@@ -184,65 +332,146 @@ func (ix *Reindexer) Do() (*ReindexerResponse, error) {
 	}
 
 	// Prepare scan and scroll to iterate through the source index
-	scanner := ix.sourceClient.Scan(ix.sourceIndex).Scroll(ix.scroll).Fields(ix.scanFields...)
-	if ix.query != nil {
-		scanner = scanner.Query(ix.query)
+	it, err := ix.hits(checkpoint)
+	if err != nil {
+		return nil, err
 	}
-	if ix.size > 0 {
-		scanner = scanner.Size(ix.size)
+	defer it.Close()
+
+	// Start bulk processor to write concurrently (if necessary)
+	var proc *reindexerProcessor
+	if ix.workers > 0 {
+		proc, err = ix.startProcessor(ret)
+		if err != nil {
+			return nil, err
+		}
+		defer proc.Close()
 	}
-	cursor, err := scanner.Do()
 
 	bulk := ix.targetClient.Bulk()
-
-	ret := &ReindexerResponse{
-		Errors: make([]*BulkResponseItem, 0),
-	}
+	throttle := &reindexerThrottle{rate: ix.throttle}
 
 	// Main loop iterates through the source index and bulk indexes into target.
-	for {
-		docs, err := cursor.Next()
-		if err == EOS {
-			break
+	for it.Next() {
+		hit := it.Hit()
+		throttle.Wait()
+		if ix.progress != nil {
+			current++
+			ix.progress(current, total)
 		}
-		if err != nil {
-			return ret, err
+
+		if err := ix.reindexerFunc(hit, bulk); err != nil {
+			switch ix.errorPolicy {
+			case ReindexerSkip:
+				ret.Skipped++
+			case ReindexerCollect:
+				ret.Skipped++
+				ret.HitErrors = append(ret.HitErrors, &ReindexerHitError{Hit: hit, Err: err})
+			default:
+				return ret, err
+			}
 		}
+		checkpoint.Key = ix.checkpointKey(hit)
+		checkpoint.Processed++
 
-		if docs.TotalHits() > 0 {
-			for _, hit := range docs.Hits.Hits {
-				if ix.progress != nil {
-					current++
-					ix.progress(current, total)
-				}
-
-				err := ix.reindexerFunc(hit, bulk)
-				if err != nil {
-					return ret, err
-				}
-
-				if bulk.NumberOfActions() >= ix.bulkSize {
-					bulk, err = ix.commit(bulk, ret)
-					if err != nil {
-						return ret, err
-					}
-				}
+		if proc != nil {
+			if err := proc.Add(bulk); err != nil {
+				return ret, err
+			}
+		} else if bulk.NumberOfActions() >= ix.bulkSize {
+			bulk, err = ix.commit(bulk, ret)
+			if err != nil {
+				return ret, err
+			}
+			if err := ix.saveCheckpoint(checkpoint, ret, false); err != nil {
+				return ret, err
 			}
 		}
 	}
+	if err := it.Err(); err != nil {
+		return ret, err
+	}
 
 	// Final flush
-	if bulk.NumberOfActions() > 0 {
+	if proc != nil {
+		if err := proc.Close(); err != nil {
+			return ret, err
+		}
+	} else if bulk.NumberOfActions() > 0 {
 		bulk, err = ix.commit(bulk, ret)
 		if err != nil {
 			return ret, err
 		}
 		bulk = nil
 	}
+	if err := ix.saveCheckpoint(checkpoint, ret, true); err != nil {
+		return ret, err
+	}
 
 	return ret, nil
 }
 
+// hits returns an iterator over the hits of the source index, starting
+// after the checkpoint.
+func (ix *Reindexer) hits(checkpoint *ReindexerCheckpoint) (reindexerHits, error) {
+	scanner := ix.sourceClient.Scan(ix.sourceIndex).Scroll(ix.scroll).Fields(ix.scanFields...)
+	if q := ix.resumeQuery(checkpoint); q != nil {
+		scanner = scanner.Query(q)
+	}
+	if ix.checkpointStore != nil {
+		scanner = scanner.Sort(ix.checkpointField, true)
+	}
+	if ix.size > 0 {
+		scanner = scanner.Size(ix.size)
+	}
+	if ix.readers <= 1 {
+		return scanner.Hits(nil), nil
+	}
+	cursor, err := scanner.Parallel().Concurrency(ix.readers).BufferSize(ix.bulkSize).Do()
+	if err != nil {
+		return nil, err
+	}
+	return &reindexerParallelHits{cursor: cursor}, nil
+}
+
+// resumeQuery returns the query to run on the source index, restricted
+// to the documents after the checkpoint if necessary.
+func (ix *Reindexer) resumeQuery(checkpoint *ReindexerCheckpoint) Query {
+	if checkpoint.Key == nil {
+		return ix.query
+	}
+	q := ix.query
+	if q == nil {
+		q = NewMatchAllQuery()
+	}
+	return NewFilteredQuery(q).Filter(NewRangeFilter(checkpoint.Field).Gt(checkpoint.Key))
+}
+
+// checkpointKey returns the sort key of the hit.
+func (ix *Reindexer) checkpointKey(hit *SearchHit) interface{} {
+	if len(hit.Sort) > 0 {
+		return hit.Sort[0]
+	}
+	if ix.checkpointField == "_uid" {
+		return hit.Type + "#" + hit.Id
+	}
+	return nil
+}
+
+// saveCheckpoint updates the checkpoint with the stats and saves it,
+// if checkpointing is enabled.
+func (ix *Reindexer) saveCheckpoint(checkpoint *ReindexerCheckpoint, ret *ReindexerResponse, completed bool) error {
+	if ix.checkpointStore == nil {
+		return nil
+	}
+	checkpoint.Success = ret.Success
+	checkpoint.Failed = ret.Failed
+	checkpoint.Skipped = ret.Skipped
+	checkpoint.Completed = completed
+	checkpoint.Time = time.Now()
+	return ix.checkpointStore.Save(checkpoint)
+}
+
 // count returns the number of documents in the source index.
 // The query is taken into account, if specified.
 func (ix *Reindexer) count() (int64, error) {
@@ -268,3 +497,130 @@ func (ix *Reindexer) commit(bulk *BulkService, ret *ReindexerResponse) (*BulkSer
 	bulk = ix.targetClient.Bulk()
 	return bulk, nil
 }
+
+// startProcessor starts a BulkProcessor that updates ret after every commit.
+func (ix *Reindexer) startProcessor(ret *ReindexerResponse) (*reindexerProcessor, error) {
+	proc := &reindexerProcessor{ret: ret, statsOnly: ix.statsOnly}
+	p, err := ix.targetClient.BulkProcessor().
+		Name("reindexer").
+		Workers(ix.workers).
+		BulkActions(ix.bulkSize).
+		After(proc.after).
+		Do()
+	if err != nil {
+		return nil, err
+	}
+	proc.p = p
+	return proc, nil
+}
+
+// reindexerHits iterates over the hits of the source index.
+type reindexerHits interface {
+	Next() bool
+	Hit() *SearchHit
+	Err() error
+	Close() error
+}
+
+// reindexerParallelHits adapts a ParallelScanCursor to reindexerHits.
+type reindexerParallelHits struct {
+	cursor *ParallelScanCursor
+	hit    *SearchHit
+}
+
+func (h *reindexerParallelHits) Next() bool {
+	hit, ok := <-h.cursor.Hits()
+	h.hit = hit
+	return ok
+}
+
+func (h *reindexerParallelHits) Hit() *SearchHit { return h.hit }
+func (h *reindexerParallelHits) Err() error      { return h.cursor.Err() }
+func (h *reindexerParallelHits) Close() error    { return h.cursor.Close() }
+
+// reindexerProcessor commits the requests of a Reindexer via a BulkProcessor.
+type reindexerProcessor struct {
+	p         *BulkProcessor
+	statsOnly bool
+
+	mu     sync.Mutex // guards the following block
+	ret    *ReindexerResponse
+	err    error
+	closed bool
+}
+
+// Add moves the requests of bulk to the BulkProcessor, along with their
+// on-wire representation so that they are not serialized again. It returns
+// an error if a request could not be added, or the first error a worker
+// has run into, if any.
+func (proc *reindexerProcessor) Add(bulk *BulkService) error {
+	requests, data, err := bulk.takeSerialized()
+	if err != nil {
+		return err
+	}
+	for i, r := range requests {
+		if err := proc.p.addSerialized(r, data[i]); err != nil {
+			return err
+		}
+	}
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	return proc.err
+}
+
+// Close flushes the outstanding requests and stops the BulkProcessor.
+// It is safe to call Close multiple times.
+func (proc *reindexerProcessor) Close() error {
+	proc.mu.Lock()
+	closed := proc.closed
+	proc.closed = true
+	proc.mu.Unlock()
+	if !closed {
+		if err := proc.p.Close(); err != nil {
+			return err
+		}
+	}
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	return proc.err
+}
+
+// after updates the stats after every commit of the BulkProcessor.
+func (proc *reindexerProcessor) after(executionId int64, requests []BulkableRequest, response *BulkResponse, err error) {
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	if err != nil && proc.err == nil {
+		proc.err = err
+	}
+	if response == nil {
+		return
+	}
+	proc.ret.Success += int64(len(response.Succeeded()))
+	failed := response.Failed()
+	proc.ret.Failed += int64(len(failed))
+	if !proc.statsOnly {
+		proc.ret.Errors = append(proc.ret.Errors, failed...)
+	}
+}
+
+// reindexerThrottle limits the rate of documents per second.
+type reindexerThrottle struct {
+	rate  float64
+	start time.Time
+	n     int64
+}
+
+// Wait blocks until the next document may be processed.
+func (t *reindexerThrottle) Wait() {
+	if t.rate <= 0 {
+		return
+	}
+	if t.n == 0 {
+		t.start = time.Now()
+	}
+	due := t.start.Add(time.Duration(float64(t.n) / t.rate * float64(time.Second)))
+	t.n++
+	if d := due.Sub(time.Now()); d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ReindexerCheckpoint records the progress of a Reindexer. All documents
+// up to and including the document with the sort key Key in the field
+// Field have been committed to the target.
+type ReindexerCheckpoint struct {
+	Field     string      `json:"field"`
+	Key       interface{} `json:"key"`
+	Processed int64       `json:"processed"`
+	Success   int64       `json:"success"`
+	Failed    int64       `json:"failed"`
+	Skipped   int64       `json:"skipped"`
+	Completed bool        `json:"completed"`
+	Time      time.Time   `json:"time"`
+}
+
+// ReindexerCheckpointStore persists the checkpoints of a Reindexer.
+type ReindexerCheckpointStore interface {
+	// Load returns the last checkpoint saved, or nil if there is none.
+	Load() (*ReindexerCheckpoint, error)
+	// Save persists the checkpoint, replacing the previous one.
+	Save(checkpoint *ReindexerCheckpoint) error
+}
+
+// -- File checkpoint store --
+
+// ReindexerFileCheckpointStore stores the checkpoint as a JSON file.
+type ReindexerFileCheckpointStore struct {
+	path string
+}
+
+// NewReindexerFileCheckpointStore returns a checkpoint store that saves
+// the checkpoint in the file at the given path. The file is replaced
+// atomically on every save.
+func NewReindexerFileCheckpointStore(path string) *ReindexerFileCheckpointStore {
+	return &ReindexerFileCheckpointStore{path: path}
+}
+
+// Load reads the checkpoint from the file. It returns nil if the file
+// does not exist.
+func (s *ReindexerFileCheckpointStore) Load() (*ReindexerCheckpoint, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Use json.Number to not lose precision on numeric sort keys
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	checkpoint := new(ReindexerCheckpoint)
+	if err := dec.Decode(checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// Save writes the checkpoint to a temporary file and renames it.
+func (s *ReindexerFileCheckpointStore) Save(checkpoint *ReindexerCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// -- In-memory checkpoint store --
+
+// ReindexerMemoryCheckpointStore keeps the checkpoint in memory. It is
+// useful to resume a Reindexer within the same process, e.g. after
+// a temporary error.
+type ReindexerMemoryCheckpointStore struct {
+	mu         sync.Mutex
+	checkpoint *ReindexerCheckpoint
+}
+
+// NewReindexerMemoryCheckpointStore returns a new in-memory checkpoint store.
+func NewReindexerMemoryCheckpointStore() *ReindexerMemoryCheckpointStore {
+	return &ReindexerMemoryCheckpointStore{}
+}
+
+// Load returns a copy of the last checkpoint saved.
+func (s *ReindexerMemoryCheckpointStore) Load() (*ReindexerCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checkpoint == nil {
+		return nil, nil
+	}
+	checkpoint := *s.checkpoint
+	return &checkpoint, nil
+}
+
+// Save saves a copy of the checkpoint.
+func (s *ReindexerMemoryCheckpointStore) Save(checkpoint *ReindexerCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *checkpoint
+	s.checkpoint = &cp
+	return nil
+}
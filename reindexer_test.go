@@ -2,6 +2,14 @@ package elastic
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -290,3 +298,344 @@ func TestReindexerPreservingTTL(t *testing.T) {
 	}
 
 }
+
+// reindexerTestShards is the number of shards of the source index
+// simulated by reindexerTestServer.
+const reindexerTestShards = 3
+
+// reindexerTestServer simulates a source index with the given number of
+// tweets, sorted by _uid, and a target that accepts bulk requests.
+type reindexerTestServer struct {
+	*testServer
+	docs      int
+	failBulks map[int]bool // bulk requests to fail, by number (starting at 1)
+
+	// routes overrides the handling of requests by "METHOD path"
+	routes map[string]func(w http.ResponseWriter, body []byte)
+
+	bulks   int
+	indexed []string
+}
+
+func newReindexerTestServer(docs int) *reindexerTestServer {
+	s := &reindexerTestServer{
+		testServer: newTestServer(),
+		docs:       docs,
+		failBulks:  make(map[int]bool),
+		routes:     make(map[string]func(w http.ResponseWriter, body []byte)),
+	}
+	s.Search = s.search
+	s.Handle = s.handle
+	return s
+}
+
+// search returns all tweets in a single page, optionally restricted to
+// a shard and by a range filter on _uid.
+func (s *reindexerTestServer) search(r *http.Request, body []byte) [][]string {
+	var req struct {
+		Query struct {
+			Filtered struct {
+				Filter struct {
+					Range map[string]struct {
+						From string `json:"from"`
+					} `json:"range"`
+				} `json:"filter"`
+			} `json:"filtered"`
+		} `json:"query"`
+	}
+	json.Unmarshal(body, &req)
+	after := req.Query.Filtered.Filter.Range["_uid"].From
+	shard := -1
+	fmt.Sscanf(r.URL.Query().Get("preference"), "_shards:%d", &shard)
+	var hits []string
+	for i := 1; i <= s.docs; i++ {
+		uid := fmt.Sprintf("tweet#%d", i)
+		if uid <= after {
+			continue
+		}
+		if shard >= 0 && i%reindexerTestShards != shard {
+			continue
+		}
+		hits = append(hits, fmt.Sprintf(`{"_index":%q,"_type":"tweet","_id":"%d","_source":{"user":"olivere","message":"Message %d"},"sort":[%q]}`, testIndexName, i, i, uid))
+	}
+	return [][]string{hits}
+}
+
+func (s *reindexerTestServer) handle(w http.ResponseWriter, r *http.Request, body []byte) {
+	if route, found := s.routes[r.Method+" "+r.URL.Path]; found {
+		route(w, body)
+		return
+	}
+	switch {
+	case r.URL.Path == "/_bulk":
+		s.bulks++
+		if s.failBulks[s.bulks] {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error":"UnavailableShardsException","status":503}`)
+			return
+		}
+		var items []string
+		for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+			var command map[string]map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &command); err != nil {
+				continue
+			}
+			if meta, found := command["index"]; found {
+				id := meta["_id"].(string)
+				s.indexed = append(s.indexed, id)
+				items = append(items, fmt.Sprintf(`{"index":{"_index":%q,"_type":"tweet","_id":%q,"status":201}}`, testIndexName2, id))
+			}
+		}
+		fmt.Fprintf(w, `{"took":1,"errors":false,"items":[%s]}`, strings.Join(items, ","))
+	case strings.HasPrefix(r.URL.Path, "/_cluster/state/"):
+		fmt.Fprintf(w, `{"metadata":{"indices":{%q:{"settings":{"index.number_of_shards":"%d"}}}}}`, testIndexName, reindexerTestShards)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"unexpected request %s %s","status":400}`, r.Method, r.URL.Path)
+	}
+}
+
+func TestReindexerResume(t *testing.T) {
+	ts := newReindexerTestServer(5)
+	ts.failBulks[2] = true
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewReindexerMemoryCheckpointStore()
+	r := NewReindexer(client, testIndexName, CopyToTargetIndex(testIndexName2)).
+		BulkSize(2).
+		Checkpoint(store)
+
+	// The second bulk fails, so only the first bulk is committed
+	if _, err := r.Do(); err == nil {
+		t.Fatal("expected error")
+	}
+	checkpoint, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint == nil {
+		t.Fatal("expected checkpoint")
+	}
+	if got, want := checkpoint.Key, "tweet#2"; got != want {
+		t.Errorf("expected checkpoint key %v; got %v", want, got)
+	}
+	if got, want := checkpoint.Success, int64(2); got != want {
+		t.Errorf("expected success = %d; got %d", want, got)
+	}
+	if checkpoint.Completed {
+		t.Errorf("expected checkpoint to not be completed")
+	}
+
+	ret, err := r.Resume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ret.Success, int64(5); got != want {
+		t.Errorf("expected success = %d; got %d", want, got)
+	}
+	if got, want := strings.Join(ts.indexed, ","), "1,2,3,4,5"; got != want {
+		t.Errorf("expected documents %s to be indexed; got %s", want, got)
+	}
+	checkpoint, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkpoint.Completed {
+		t.Errorf("expected checkpoint to be completed")
+	}
+	if got, want := checkpoint.Processed, int64(5); got != want {
+		t.Errorf("expected processed = %d; got %d", want, got)
+	}
+
+	// Resuming a completed reindex does nothing
+	bulks := ts.bulks
+	if _, err := r.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ts.bulks, bulks; got != want {
+		t.Errorf("expected %d bulk requests; got %d", want, got)
+	}
+}
+
+func TestReindexerErrorPolicy(t *testing.T) {
+	ts := newReindexerTestServer(5)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyFn := CopyToTargetIndex(testIndexName2)
+	failOn3 := func(hit *SearchHit, bulkService *BulkService) error {
+		if hit.Id == "3" {
+			return errors.New("invalid document")
+		}
+		return copyFn(hit, bulkService)
+	}
+
+	tests := []struct {
+		Policy    ReindexerErrorPolicy
+		Err       bool
+		Success   int64
+		Skipped   int64
+		HitErrors int
+	}{
+		{ReindexerAbort, true, 2, 0, 0},
+		{ReindexerSkip, false, 4, 1, 0},
+		{ReindexerCollect, false, 4, 1, 1},
+	}
+
+	for i, test := range tests {
+		ret, err := NewReindexer(client, testIndexName, failOn3).
+			BulkSize(2).
+			ErrorPolicy(test.Policy).
+			Do()
+		if got := err != nil; got != test.Err {
+			t.Errorf("#%d: expected error = %v; got %v", i, test.Err, err)
+		}
+		if got, want := ret.Success, test.Success; got != want {
+			t.Errorf("#%d: expected success = %d; got %d", i, want, got)
+		}
+		if got, want := ret.Skipped, test.Skipped; got != want {
+			t.Errorf("#%d: expected skipped = %d; got %d", i, want, got)
+		}
+		if got, want := len(ret.HitErrors), test.HitErrors; got != want {
+			t.Errorf("#%d: expected %d hit errors; got %d", i, want, got)
+		}
+		if len(ret.HitErrors) > 0 && ret.HitErrors[0].Hit.Id != "3" {
+			t.Errorf("#%d: expected hit error for document 3; got %v", i, ret.HitErrors[0])
+		}
+	}
+}
+
+func TestReindexerFileCheckpointStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elastic-reindexer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewReindexerFileCheckpointStore(filepath.Join(dir, "checkpoint.json"))
+	checkpoint, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint != nil {
+		t.Fatalf("expected no checkpoint; got %v", checkpoint)
+	}
+
+	in := &ReindexerCheckpoint{Field: "created", Key: int64(1447158720000000001), Processed: 42, Success: 40, Failed: 1, Skipped: 1}
+	if err := store.Save(in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(out.Key), "1447158720000000001"; got != want {
+		t.Errorf("expected key %s; got %s", want, got)
+	}
+	if got, want := out.Processed, in.Processed; got != want {
+		t.Errorf("expected processed = %d; got %d", want, got)
+	}
+	if got, want := out.Field, in.Field; got != want {
+		t.Errorf("expected field %q; got %q", want, got)
+	}
+}
+
+func TestReindexerConcurrent(t *testing.T) {
+	ts := newReindexerTestServer(10)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := NewReindexer(client, testIndexName, CopyToTargetIndex(testIndexName2)).
+		BulkSize(2).
+		Workers(2).
+		Readers(2).
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ret.Success, int64(10); got != want {
+		t.Errorf("expected success = %d; got %d", want, got)
+	}
+	sort.Strings(ts.indexed)
+	if got, want := strings.Join(ts.indexed, ","), "1,10,2,3,4,5,6,7,8,9"; got != want {
+		t.Errorf("expected documents %s to be indexed; got %s", want, got)
+	}
+}
+
+func TestReindexerConcurrentRetriesBulks(t *testing.T) {
+	ts := newReindexerTestServer(10)
+	ts.failBulks[1] = true
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The BulkProcessor retries the failed bulk
+	ret, err := NewReindexer(client, testIndexName, CopyToTargetIndex(testIndexName2)).
+		BulkSize(5).
+		Workers(1).
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ret.Success, int64(10); got != want {
+		t.Errorf("expected success = %d; got %d", want, got)
+	}
+	if got, want := ts.bulks, 3; got != want {
+		t.Errorf("expected %d bulk requests; got %d", want, got)
+	}
+}
+
+func TestReindexerConcurrentWithCheckpoint(t *testing.T) {
+	client, err := NewSimpleClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewReindexer(client, testIndexName, CopyToTargetIndex(testIndexName2)).
+		Checkpoint(NewReindexerMemoryCheckpointStore()).
+		Workers(2).
+		Do()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestReindexerThrottle(t *testing.T) {
+	ts := newReindexerTestServer(5)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	ret, err := NewReindexer(client, testIndexName, CopyToTargetIndex(testIndexName2)).
+		Throttle(50).
+		Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ret.Success, int64(5); got != want {
+		t.Errorf("expected success = %d; got %d", want, got)
+	}
+	// 5 documents at 50 docs/sec take at least 80ms
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("expected reindexer to be throttled; took %v", elapsed)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReindexerDoc is a document on its way from the source index to the
+// target index. It is passed through the ReindexerTransforms of
+// TransformToTargetIndex.
+type ReindexerDoc struct {
+	Hit     *SearchHit             // the original hit from the source index
+	Index   string                 // target index
+	Type    string                 // target type
+	Id      string                 // target id
+	Parent  string                 // parent id, if any
+	Routing string                 // routing value, if any
+	Source  map[string]interface{} // document to index
+	Drop    bool                   // true to not index the document at all
+}
+
+// Field returns the value of the field in the _source. Use dots to
+// specify fields of inner objects, e.g. "user.name".
+func (doc *ReindexerDoc) Field(name string) (interface{}, bool) {
+	var v interface{} = doc.Source
+	for _, part := range strings.Split(name, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// SetField sets the value of the field in the _source, creating inner
+// objects as necessary. Use dots to specify fields of inner objects.
+func (doc *ReindexerDoc) SetField(name string, value interface{}) {
+	if doc.Source == nil {
+		doc.Source = make(map[string]interface{})
+	}
+	m := doc.Source
+	parts := strings.Split(name, ".")
+	for _, part := range parts[:len(parts)-1] {
+		inner, ok := m[part].(map[string]interface{})
+		if !ok {
+			inner = make(map[string]interface{})
+			m[part] = inner
+		}
+		m = inner
+	}
+	m[parts[len(parts)-1]] = value
+}
+
+// RemoveField removes the field from the _source and returns its value.
+// Use dots to specify fields of inner objects.
+func (doc *ReindexerDoc) RemoveField(name string) (interface{}, bool) {
+	m := doc.Source
+	parts := strings.Split(name, ".")
+	for _, part := range parts[:len(parts)-1] {
+		inner, ok := m[part].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = inner
+	}
+	last := parts[len(parts)-1]
+	v, found := m[last]
+	if found {
+		delete(m, last)
+	}
+	return v, found
+}
+
+// ReindexerTransform modifies a document before it is indexed
+// into the target index. It may set Drop to skip the document.
+type ReindexerTransform func(doc *ReindexerDoc) error
+
+// TransformToTargetIndex returns a ReindexerFunc that copies the hit's
+// _source, _parent, and _routing attributes into the targetIndex, like
+// CopyToTargetIndex, but passes each document through the given transforms
+// first. The transforms are applied in the given order, and the remaining
+// transforms are skipped once a document has been dropped.
+//
+// Example:
+//
+//	fn := TransformToTargetIndex("tweets-v2",
+//	  RenameField("user", "author"),
+//	  RemoveFields("retweets"),
+//	  DropIf(func(doc *ReindexerDoc) bool { return doc.Type == "comment" }),
+//	  SplitByDate("created", "tweets-", "2006.01"),
+//	)
+func TransformToTargetIndex(targetIndex string, transforms ...ReindexerTransform) ReindexerFunc {
+	return func(hit *SearchHit, bulkService *BulkService) error {
+		doc := &ReindexerDoc{
+			Hit:   hit,
+			Index: targetIndex,
+			Type:  hit.Type,
+			Id:    hit.Id,
+		}
+		if hit.Source != nil {
+			// Use json.Number to not lose precision on large numbers
+			dec := json.NewDecoder(bytes.NewReader(*hit.Source))
+			dec.UseNumber()
+			if err := dec.Decode(&doc.Source); err != nil {
+				return err
+			}
+		}
+		if parent, ok := hit.Fields["_parent"].(string); ok {
+			doc.Parent = parent
+		}
+		if routing, ok := hit.Fields["_routing"].(string); ok {
+			doc.Routing = routing
+		}
+
+		for _, transform := range transforms {
+			if err := transform(doc); err != nil {
+				return err
+			}
+			if doc.Drop {
+				return nil
+			}
+		}
+
+		req := NewBulkIndexRequest().Index(doc.Index).Type(doc.Type).Id(doc.Id).Doc(doc.Source)
+		if doc.Parent != "" {
+			req.Parent(doc.Parent)
+		}
+		if doc.Routing != "" {
+			req.Routing(doc.Routing)
+		}
+		bulkService.Add(req)
+		return nil
+	}
+}
+
+// ChainTransforms combines several transforms into one.
+func ChainTransforms(transforms ...ReindexerTransform) ReindexerTransform {
+	return func(doc *ReindexerDoc) error {
+		for _, transform := range transforms {
+			if err := transform(doc); err != nil {
+				return err
+			}
+			if doc.Drop {
+				return nil
+			}
+		}
+		return nil
+	}
+}
+
+// RenameField renames a field in the _source. Documents without
+// the field are left unchanged.
+func RenameField(from, to string) ReindexerTransform {
+	return func(doc *ReindexerDoc) error {
+		if v, found := doc.RemoveField(from); found {
+			doc.SetField(to, v)
+		}
+		return nil
+	}
+}
+
+// RemoveFields removes the given fields from the _source.
+func RemoveFields(names ...string) ReindexerTransform {
+	return func(doc *ReindexerDoc) error {
+		for _, name := range names {
+			doc.RemoveField(name)
+		}
+		return nil
+	}
+}
+
+// SetField sets a field in the _source to a fixed value.
+func SetField(name string, value interface{}) ReindexerTransform {
+	return func(doc *ReindexerDoc) error {
+		doc.SetField(name, value)
+		return nil
+	}
+}
+
+// ChangeType changes the type of the documents.
+func ChangeType(typ string) ReindexerTransform {
+	return func(doc *ReindexerDoc) error {
+		doc.Type = typ
+		return nil
+	}
+}
+
+// RewriteId changes the id of the documents to the value returned by fn.
+func RewriteId(fn func(doc *ReindexerDoc) string) ReindexerTransform {
+	return func(doc *ReindexerDoc) error {
+		doc.Id = fn(doc)
+		return nil
+	}
+}
+
+// RouteByField sets the routing of the documents to the value of the
+// given field. It returns an error for documents without the field.
+func RouteByField(name string) ReindexerTransform {
+	return func(doc *ReindexerDoc) error {
+		v, found := doc.Field(name)
+		if !found || v == nil {
+			return fmt.Errorf("elastic: document %q has no field %q to route by", doc.Id, name)
+		}
+		doc.Routing = fmt.Sprint(v)
+		return nil
+	}
+}
+
+// DropIf drops all documents for which the predicate returns true.
+func DropIf(predicate func(doc *ReindexerDoc) bool) ReindexerTransform {
+	return func(doc *ReindexerDoc) error {
+		if predicate(doc) {
+			doc.Drop = true
+		}
+		return nil
+	}
+}
+
+// SplitByField sets the target index of the documents to the given prefix
+// followed by the value of the field, e.g. SplitByField("lang", "tweets-")
+// indexes a document with lang "en" into "tweets-en". The value is
+// lowercased as index names must be lowercase. It returns an error
+// for documents without the field, or if the resulting index name
+// is invalid.
+func SplitByField(name, prefix string) ReindexerTransform {
+	return func(doc *ReindexerDoc) error {
+		v, found := doc.Field(name)
+		if !found || v == nil {
+			return fmt.Errorf("elastic: document %q has no field %q to split by", doc.Id, name)
+		}
+		return doc.setSplitIndex(prefix + strings.ToLower(fmt.Sprint(v)))
+	}
+}
+
+// SplitByDate sets the target index of the documents to the given prefix
+// followed by the date in the given field, formatted with layout using
+// the Go time format, e.g. SplitByDate("created", "tweets-", "2006.01")
+// indexes a document created on 2015-11-10 into "tweets-2015.11".
+// The prefix is used as is, so it may contain text like "2006" or "Mon"
+// that the time format would replace. The date must be given in RFC 3339
+// format, as "2006-01-02", or in milliseconds since the epoch. Dates are
+// converted to UTC. It returns an error if the resulting index name
+// is invalid, e.g. because layout contains uppercase month names.
+func SplitByDate(name, prefix, layout string) ReindexerTransform {
+	return func(doc *ReindexerDoc) error {
+		v, found := doc.Field(name)
+		if !found || v == nil {
+			return fmt.Errorf("elastic: document %q has no field %q to split by", doc.Id, name)
+		}
+		t, err := parseReindexerDate(v)
+		if err != nil {
+			return fmt.Errorf("elastic: document %q has an invalid date in field %q: %v", doc.Id, name, err)
+		}
+		return doc.setSplitIndex(prefix + t.UTC().Format(layout))
+	}
+}
+
+// setSplitIndex sets the target index of the document to the given
+// index name, which has been generated from the document.
+func (doc *ReindexerDoc) setSplitIndex(index string) error {
+	if err := validateIndexName(index); err != nil {
+		return fmt.Errorf("elastic: document %q: %v", doc.Id, err)
+	}
+	doc.Index = index
+	return nil
+}
+
+// validateIndexName returns an error if name is not a valid index name:
+// index names must be lowercase, must not contain any of the characters
+// \ / * ? " < > | , # or a space, and must not start with _, - or +.
+func validateIndexName(name string) error {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return fmt.Errorf("invalid index name %q", name)
+	case name != strings.ToLower(name):
+		return fmt.Errorf("invalid index name %q: must be lowercase", name)
+	case strings.ContainsAny(name, "\\/*?\"<>|,# "):
+		return fmt.Errorf("invalid index name %q: must not contain any of \\ / * ? \" < > | , # or a space", name)
+	case strings.IndexAny(name, "_-+") == 0:
+		return fmt.Errorf("invalid index name %q: must not start with _, - or +", name)
+	}
+	return nil
+}
+
+// parseReindexerDate parses a date as found in a _source.
+func parseReindexerDate(v interface{}) (time.Time, error) {
+	var millis int64
+	switch t := v.(type) {
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+			if d, err := time.Parse(layout, t); err == nil {
+				return d, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unsupported date format %q", t)
+	case json.Number:
+		n, err := t.Int64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		millis = n
+	case float64:
+		millis = int64(t)
+	case int64:
+		millis = t
+	case int:
+		millis = int64(t)
+	default:
+		return time.Time{}, fmt.Errorf("unsupported date %v of type %T", v, v)
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)), nil
+}
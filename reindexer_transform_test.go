@@ -0,0 +1,161 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newReindexerTestHit(id, source string) *SearchHit {
+	raw := json.RawMessage(source)
+	return &SearchHit{
+		Index:  testIndexName,
+		Type:   "tweet",
+		Id:     id,
+		Source: &raw,
+		Fields: map[string]interface{}{"_routing": "r1"},
+	}
+}
+
+func TestTransformToTargetIndex(t *testing.T) {
+	tests := []struct {
+		Transforms []ReindexerTransform
+		Source     string
+		Expected   []string
+	}{
+		// #0 Copy as is
+		{
+			nil,
+			`{"user":"olivere","retweets":12345678901234567}`,
+			[]string{
+				`{"index":{"_id":"1","_index":"tweets","_routing":"r1","_type":"tweet"}}`,
+				`{"retweets":12345678901234567,"user":"olivere"}`,
+			},
+		},
+		// #1 Rename, remove, and set fields
+		{
+			[]ReindexerTransform{
+				RenameField("user", "author.name"),
+				RemoveFields("retweets", "unknown"),
+				SetField("version", 2),
+			},
+			`{"user":"olivere","retweets":1}`,
+			[]string{
+				`{"index":{"_id":"1","_index":"tweets","_routing":"r1","_type":"tweet"}}`,
+				`{"author":{"name":"olivere"},"version":2}`,
+			},
+		},
+		// #2 Change type, rewrite id, and route by field
+		{
+			[]ReindexerTransform{
+				ChangeType("post"),
+				RewriteId(func(doc *ReindexerDoc) string { return doc.Type + "-" + doc.Id }),
+				RouteByField("user"),
+			},
+			`{"user":"olivere"}`,
+			[]string{
+				`{"index":{"_id":"post-1","_index":"tweets","_routing":"olivere","_type":"post"}}`,
+				`{"user":"olivere"}`,
+			},
+		},
+		// #3 Drop documents
+		{
+			[]ReindexerTransform{
+				DropIf(func(doc *ReindexerDoc) bool {
+					user, _ := doc.Field("user")
+					return user == "sandrae"
+				}),
+				SetField("unreachable", true),
+			},
+			`{"user":"sandrae"}`,
+			nil,
+		},
+		// #4 Split by field
+		{
+			[]ReindexerTransform{
+				SplitByField("lang", "tweets-"),
+			},
+			`{"lang":"EN"}`,
+			[]string{
+				`{"index":{"_id":"1","_index":"tweets-en","_routing":"r1","_type":"tweet"}}`,
+				`{"lang":"EN"}`,
+			},
+		},
+		// #5 Split by date
+		{
+			[]ReindexerTransform{
+				ChainTransforms(
+					SplitByDate("created", "tweets-v1-", "2006.01"),
+					RemoveFields("created"),
+				),
+			},
+			`{"created":"2015-11-10T23:00:00-02:00"}`,
+			[]string{
+				`{"index":{"_id":"1","_index":"tweets-v1-2015.11","_routing":"r1","_type":"tweet"}}`,
+				`{}`,
+			},
+		},
+		// #6 Split by date in milliseconds since the epoch
+		{
+			[]ReindexerTransform{
+				SplitByDate("created", "tweets-", "2006.01.02"),
+			},
+			`{"created":1447200000000}`,
+			[]string{
+				`{"index":{"_id":"1","_index":"tweets-2015.11.11","_routing":"r1","_type":"tweet"}}`,
+				`{"created":1447200000000}`,
+			},
+		},
+	}
+
+	for i, test := range tests {
+		bulk := NewBulkService(nil)
+		fn := TransformToTargetIndex("tweets", test.Transforms...)
+		if err := fn(newReindexerTestHit("1", test.Source), bulk); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if test.Expected == nil {
+			if got := bulk.NumberOfActions(); got != 0 {
+				t.Errorf("#%d: expected document to be dropped; got %d actions", i, got)
+			}
+			continue
+		}
+		if got, want := bulk.NumberOfActions(), 1; got != want {
+			t.Fatalf("#%d: expected %d actions; got %d", i, want, got)
+		}
+		lines, err := bulk.requests[0].Source()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got, want := strings.Join(lines, "\n"), strings.Join(test.Expected, "\n"); got != want {
+			t.Errorf("#%d: expected\n%s\ngot\n%s", i, want, got)
+		}
+	}
+}
+
+func TestTransformToTargetIndexErrors(t *testing.T) {
+	tests := []struct {
+		Transform ReindexerTransform
+		Source    string
+	}{
+		{RouteByField("user"), `{}`},
+		{SplitByField("lang", "tweets-"), `{"user":"olivere"}`},
+		{SplitByField("lang", "tweets-"), `{"lang":"en us"}`},
+		{SplitByDate("created", "tweets-", "2006"), `{"created":"yesterday"}`},
+		{SplitByDate("created", "tweets-", "2006"), `{"created":true}`},
+		{SplitByDate("created", "tweets-", "Jan-2006"), `{"created":"2015-11-10"}`},
+		{SplitByDate("created", "_tweets-", "2006"), `{"created":"2015-11-10"}`},
+		{SplitByDate("created", "tweets/", "2006"), `{"created":"2015-11-10"}`},
+	}
+
+	for i, test := range tests {
+		fn := TransformToTargetIndex("tweets", test.Transform)
+		if err := fn(newReindexerTestHit("1", test.Source), NewBulkService(nil)); err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
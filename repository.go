@@ -0,0 +1,498 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrDocumentNotFound is returned e.g. from Repository.Get if the
+// document does not exist.
+var ErrDocumentNotFound = errors.New("elastic: document not found")
+
+// DecodeError is returned when the source of a document cannot be
+// decoded into a Go value.
+type DecodeError struct {
+	Index string
+	Type  string
+	Id    string
+	Err   error
+}
+
+// Error returns a string representation of the error.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("elastic: unable to decode document %s/%s/%s: %v", e.Index, e.Type, e.Id, e.Err)
+}
+
+// DecodeErrors is a list of errors that occurred while decoding
+// several documents, e.g. the hits of a search result.
+type DecodeErrors []*DecodeError
+
+// Error returns a string representation of the errors.
+func (e DecodeErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	var ids []string
+	for _, err := range e {
+		ids = append(ids, err.Id)
+	}
+	return fmt.Sprintf("elastic: unable to decode %d documents (%s); first error: %v", len(e), strings.Join(ids, ", "), e[0].Err)
+}
+
+// Repository reads and writes documents of a given index and type
+// as Go structs.
+//
+// The struct may tag fields with metadata of the document, e.g.:
+//
+//	type Tweet struct {
+//		Id      string `json:"-" elastic:"_id"`
+//		Version int64  `json:"-" elastic:"_version"`
+//		User    string `json:"user"`
+//		Message string `json:"message"`
+//	}
+//
+// The field tagged with _id (a string) is used as the document identifier
+// when saving, and set after loading or saving a document. The field
+// tagged with _version (an integer) enables optimistic concurrency control:
+// If it is non-zero when saving, the document is only saved if the version
+// in Elasticsearch matches, otherwise an error with status 409 (Conflict)
+// is returned. Fields tagged with _routing and _parent (strings) are passed
+// to Elasticsearch when saving.
+//
+// Documents are passed to and returned from the repository as pointers
+// to the struct, e.g. *Tweet.
+type Repository struct {
+	client  *Client
+	index   string
+	typ     string
+	docType reflect.Type
+	meta    *docMetaFields
+	refresh bool
+}
+
+// NewRepository creates a new Repository for the index and type.
+// The Go type of the documents is taken from v, a struct or a pointer
+// to a struct, e.g. Tweet{} or (*Tweet)(nil).
+func NewRepository(client *Client, index, typ string, v interface{}) (*Repository, error) {
+	if index == "" {
+		return nil, ErrMissingIndex
+	}
+	if typ == "" {
+		return nil, ErrMissingType
+	}
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("elastic: repository requires a struct; got %v", reflect.TypeOf(v))
+	}
+	meta, err := newDocMetaFields(t)
+	if err != nil {
+		return nil, err
+	}
+	return &Repository{
+		client:  client,
+		index:   index,
+		typ:     typ,
+		docType: t,
+		meta:    meta,
+	}, nil
+}
+
+// Refresh indicates whether the index should be refreshed after
+// saving or deleting a document (default: false).
+func (r *Repository) Refresh(refresh bool) *Repository {
+	r.refresh = refresh
+	return r
+}
+
+// Index returns the name of the index.
+func (r *Repository) Index() string {
+	return r.index
+}
+
+// Type returns the document type.
+func (r *Repository) Type() string {
+	return r.typ
+}
+
+// Mapping returns the mapping generated from the Go type of the documents.
+func (r *Repository) Mapping() *StructMapping {
+	return NewStructMapping(r.typ, reflect.Zero(r.docType).Interface())
+}
+
+// New returns a pointer to a new, empty document.
+func (r *Repository) New() interface{} {
+	return reflect.New(r.docType).Interface()
+}
+
+// Get runs GetC() with default context.
+func (r *Repository) Get(id string) (interface{}, error) {
+	return r.GetC(nil, id)
+}
+
+// GetC loads the document with the given id. It returns
+// ErrDocumentNotFound if the document does not exist.
+func (r *Repository) GetC(ctx context.Context, id string) (interface{}, error) {
+	res, err := r.client.Get().Index(r.index).Type(r.typ).Id(id).DoC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Found {
+		return nil, ErrDocumentNotFound
+	}
+	return r.decode(res.Index, res.Type, res.Id, res.Version, res.Source)
+}
+
+// MultiGet runs MultiGetC() with default context.
+func (r *Repository) MultiGet(ids ...string) ([]interface{}, error) {
+	return r.MultiGetC(nil, ids...)
+}
+
+// MultiGetC loads the documents with the given ids in a single request.
+// The result has the same length as ids; documents that do not exist or
+// cannot be decoded are nil. If documents cannot be decoded, the error is
+// of type DecodeErrors.
+func (r *Repository) MultiGetC(ctx context.Context, ids ...string) ([]interface{}, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	mget := r.client.MultiGet()
+	for _, id := range ids {
+		mget = mget.Add(NewMultiGetItem().Index(r.index).Type(r.typ).Id(id))
+	}
+	res, err := mget.DoC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Docs) != len(ids) {
+		return nil, fmt.Errorf("elastic: expected %d documents from multi get; got %d", len(ids), len(res.Docs))
+	}
+	docs := make([]interface{}, len(ids))
+	var errs DecodeErrors
+	for i, doc := range res.Docs {
+		if doc.Error != "" {
+			return nil, fmt.Errorf("elastic: unable to get document %s: %s", ids[i], doc.Error)
+		}
+		if !doc.Found {
+			continue
+		}
+		v, err := r.decode(doc.Index, doc.Type, doc.Id, doc.Version, doc.Source)
+		if err != nil {
+			errs = append(errs, err.(*DecodeError))
+			continue
+		}
+		docs[i] = v
+	}
+	if len(errs) > 0 {
+		return docs, errs
+	}
+	return docs, nil
+}
+
+// Search returns a SearchService for the index and type of the repository.
+// Use Hits or Find to decode the results. Version is enabled to fill the
+// field tagged with _version.
+func (r *Repository) Search() *SearchService {
+	return r.client.Search(r.index).Type(r.typ).Version(r.meta.has("_version"))
+}
+
+// Find runs FindC() with default context.
+func (r *Repository) Find(search *SearchService) ([]interface{}, *SearchResult, error) {
+	return r.FindC(nil, search)
+}
+
+// FindC runs the search, e.g. as returned by Search, and returns the
+// decoded documents along with the search result.
+func (r *Repository) FindC(ctx context.Context, search *SearchService) ([]interface{}, *SearchResult, error) {
+	res, err := search.DoC(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	docs, err := r.Hits(res)
+	return docs, res, err
+}
+
+// Hits decodes the hits of a search result. Unlike SearchResult.Each,
+// Hits does not skip documents that cannot be decoded: The error is of
+// type DecodeErrors and lists the ids of the affected hits, and the
+// documents that could be decoded are returned nevertheless.
+func (r *Repository) Hits(res *SearchResult) ([]interface{}, error) {
+	if res == nil || res.Hits == nil {
+		return nil, nil
+	}
+	docs := make([]interface{}, 0, len(res.Hits.Hits))
+	var errs DecodeErrors
+	for _, hit := range res.Hits.Hits {
+		var version int64
+		if hit.Version != nil {
+			version = *hit.Version
+		}
+		v, err := r.decode(hit.Index, hit.Type, hit.Id, version, hit.Source)
+		if err != nil {
+			errs = append(errs, err.(*DecodeError))
+			continue
+		}
+		docs = append(docs, v)
+	}
+	if len(errs) > 0 {
+		return docs, errs
+	}
+	return docs, nil
+}
+
+// Save runs SaveC() with default context.
+func (r *Repository) Save(doc interface{}) (*IndexResult, error) {
+	return r.SaveC(nil, doc)
+}
+
+// SaveC indexes the document. If the document has no id, Elasticsearch
+// generates one. The fields tagged with _id and _version are updated
+// after the document has been saved successfully.
+func (r *Repository) SaveC(ctx context.Context, doc interface{}) (*IndexResult, error) {
+	v, err := r.value(doc)
+	if err != nil {
+		return nil, err
+	}
+	svc := r.client.Index().Index(r.index).Type(r.typ).BodyJson(doc)
+	if id := r.meta.getString(v, "_id"); id != "" {
+		svc = svc.Id(id)
+	}
+	if version := r.meta.getInt(v, "_version"); version > 0 {
+		svc = svc.Version(version)
+	}
+	if routing := r.meta.getString(v, "_routing"); routing != "" {
+		svc = svc.Routing(routing)
+	}
+	if parent := r.meta.getString(v, "_parent"); parent != "" {
+		svc = svc.Parent(parent)
+	}
+	if r.refresh {
+		svc = svc.Refresh(true)
+	}
+	res, err := svc.DoC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.meta.setString(v, "_id", res.Id)
+	r.meta.setInt(v, "_version", int64(res.Version))
+	return res, nil
+}
+
+// Delete runs DeleteC() with default context.
+func (r *Repository) Delete(doc interface{}) (*DeleteResult, error) {
+	return r.DeleteC(nil, doc)
+}
+
+// DeleteC deletes the document. If the field tagged with _version is
+// non-zero, the document is only deleted if the version matches.
+func (r *Repository) DeleteC(ctx context.Context, doc interface{}) (*DeleteResult, error) {
+	v, err := r.value(doc)
+	if err != nil {
+		return nil, err
+	}
+	id := r.meta.getString(v, "_id")
+	if id == "" {
+		return nil, ErrMissingId
+	}
+	svc := r.client.Delete().Index(r.index).Type(r.typ).Id(id)
+	if version := r.meta.getInt(v, "_version"); version > 0 {
+		svc = svc.Version(int(version))
+	}
+	if parent := r.meta.getString(v, "_parent"); parent != "" {
+		svc = svc.Parent(parent)
+	}
+	if r.refresh {
+		svc = svc.Refresh(true)
+	}
+	return svc.DoC(ctx)
+}
+
+// DeleteId runs DeleteIdC() with default context.
+func (r *Repository) DeleteId(id string) (*DeleteResult, error) {
+	return r.DeleteIdC(nil, id)
+}
+
+// DeleteIdC deletes the document with the given id, regardless of its version.
+func (r *Repository) DeleteIdC(ctx context.Context, id string) (*DeleteResult, error) {
+	if id == "" {
+		return nil, ErrMissingId
+	}
+	return r.client.Delete().Index(r.index).Type(r.typ).Id(id).Refresh(r.refresh).DoC(ctx)
+}
+
+// Update returns an UpdateService for the document with the given id,
+// e.g. to apply a partial document or a script.
+func (r *Repository) Update(id string) *UpdateService {
+	return r.client.Update().Index(r.index).Type(r.typ).Id(id)
+}
+
+// Modify runs ModifyC() with default context.
+func (r *Repository) Modify(id string, fn OptimisticUpdateFunc) (*OptimisticUpdateResult, error) {
+	return r.ModifyC(nil, id, fn)
+}
+
+// ModifyC gets the document with the given id, modifies it with fn, and
+// saves it with optimistic concurrency control, retrying on version
+// conflicts (see OptimisticUpdateService). The func receives a pointer
+// to the document, e.g. *Tweet.
+func (r *Repository) ModifyC(ctx context.Context, id string, fn OptimisticUpdateFunc) (*OptimisticUpdateResult, error) {
+	return r.client.OptimisticUpdate().
+		Index(r.index).
+		Type(r.typ).
+		Id(id).
+		DocType(reflect.Zero(r.docType).Interface()).
+		Refresh(r.refresh).
+		DoC(ctx, fn)
+}
+
+// BulkIndexRequest returns a request to index the document in bulk,
+// e.g. with a BulkService or BulkProcessor.
+func (r *Repository) BulkIndexRequest(doc interface{}) (*BulkIndexRequest, error) {
+	v, err := r.value(doc)
+	if err != nil {
+		return nil, err
+	}
+	req := NewBulkIndexRequest().Index(r.index).Type(r.typ).Doc(doc)
+	if id := r.meta.getString(v, "_id"); id != "" {
+		req = req.Id(id)
+	}
+	if version := r.meta.getInt(v, "_version"); version > 0 {
+		req = req.Version(version)
+	}
+	if routing := r.meta.getString(v, "_routing"); routing != "" {
+		req = req.Routing(routing)
+	}
+	if parent := r.meta.getString(v, "_parent"); parent != "" {
+		req = req.Parent(parent)
+	}
+	return req, nil
+}
+
+// SaveAll adds the documents to the BulkProcessor. The documents are
+// saved asynchronously; use the After callback of the BulkProcessor to
+// check the outcome. Unlike Save, SaveAll does not update the fields
+// tagged with _id and _version.
+func (r *Repository) SaveAll(p *BulkProcessor, docs ...interface{}) error {
+	for _, doc := range docs {
+		req, err := r.BulkIndexRequest(doc)
+		if err != nil {
+			return err
+		}
+		if err := p.Add(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value returns the struct value of a pointer to a document.
+func (r *Repository) value(doc interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(doc)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Type() != r.docType {
+		return reflect.Value{}, fmt.Errorf("elastic: repository expects a document of type *%v; got %T", r.docType, doc)
+	}
+	return v.Elem(), nil
+}
+
+// decode decodes the source into a new document and sets its metadata.
+func (r *Repository) decode(index, typ, id string, version int64, source *json.RawMessage) (interface{}, error) {
+	ptr := reflect.New(r.docType)
+	if source != nil {
+		if err := json.Unmarshal(*source, ptr.Interface()); err != nil {
+			return nil, &DecodeError{Index: index, Type: typ, Id: id, Err: err}
+		}
+	}
+	r.meta.setString(ptr.Elem(), "_id", id)
+	if version > 0 {
+		r.meta.setInt(ptr.Elem(), "_version", version)
+	}
+	return ptr.Interface(), nil
+}
+
+// -- Metadata fields --
+
+// docMetaFields are the fields of a struct that are tagged with
+// metadata of a document, e.g. elastic:"_id".
+type docMetaFields struct {
+	fields map[string][]int // metadata name -> field index
+}
+
+// docMetaKinds lists the supported metadata and their kinds.
+var docMetaKinds = map[string][]reflect.Kind{
+	"_id":      {reflect.String},
+	"_routing": {reflect.String},
+	"_parent":  {reflect.String},
+	"_version": {reflect.Int, reflect.Int64},
+}
+
+// newDocMetaFields finds the fields tagged with metadata in struct type t.
+func newDocMetaFields(t reflect.Type) (*docMetaFields, error) {
+	m := &docMetaFields{fields: make(map[string][]int)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		for _, part := range strings.Split(field.Tag.Get("elastic"), ",") {
+			name := strings.TrimSpace(part)
+			kinds, found := docMetaKinds[name]
+			if !found {
+				continue
+			}
+			ok := false
+			for _, kind := range kinds {
+				ok = ok || field.Type.Kind() == kind
+			}
+			if !ok {
+				return nil, fmt.Errorf("elastic: field %s.%s tagged with %s has unsupported type %v", t.Name(), field.Name, name, field.Type)
+			}
+			if _, found := m.fields[name]; found {
+				return nil, fmt.Errorf("elastic: %s tagged more than once in %v", name, t)
+			}
+			m.fields[name] = field.Index
+		}
+	}
+	return m, nil
+}
+
+// has returns true if the struct has a field tagged with name.
+func (m *docMetaFields) has(name string) bool {
+	_, found := m.fields[name]
+	return found
+}
+
+func (m *docMetaFields) getString(v reflect.Value, name string) string {
+	if index, found := m.fields[name]; found {
+		return v.FieldByIndex(index).String()
+	}
+	return ""
+}
+
+func (m *docMetaFields) setString(v reflect.Value, name, value string) {
+	if index, found := m.fields[name]; found {
+		v.FieldByIndex(index).SetString(value)
+	}
+}
+
+func (m *docMetaFields) getInt(v reflect.Value, name string) int64 {
+	if index, found := m.fields[name]; found {
+		return v.FieldByIndex(index).Int()
+	}
+	return 0
+}
+
+func (m *docMetaFields) setInt(v reflect.Value, name string, value int64) {
+	if index, found := m.fields[name]; found {
+		v.FieldByIndex(index).SetInt(value)
+	}
+}
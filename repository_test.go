@@ -0,0 +1,413 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// repositoryTestDoc is a document stored in repositoryTestServer.
+type repositoryTestDoc struct {
+	Source  string
+	Version int64
+}
+
+// repositoryTestServer is an in-memory document store for a single
+// index and type that supports versioned get, index, and delete
+// requests as well as multi get, search, and bulk requests.
+type repositoryTestServer struct {
+	*testServer
+
+	docs   map[string]*repositoryTestDoc
+	nextId int
+}
+
+func newRepositoryTestServer() *repositoryTestServer {
+	s := &repositoryTestServer{
+		testServer: newTestServer(),
+		docs:       make(map[string]*repositoryTestDoc),
+	}
+	s.Search = s.search
+	s.Handle = s.handle
+	return s
+}
+
+// put stores a document.
+func (s *repositoryTestServer) put(id, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, found := s.docs[id]
+	if !found {
+		doc = &repositoryTestDoc{}
+		s.docs[id] = doc
+	}
+	doc.Source = source
+	doc.Version++
+}
+
+// search returns all documents, sorted by id, in a single page.
+func (s *repositoryTestServer) search(r *http.Request, body []byte) [][]string {
+	var ids []string
+	for id := range s.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var hits []string
+	for _, id := range ids {
+		doc := s.docs[id]
+		hits = append(hits, fmt.Sprintf(`{"_index":%q,"_type":"tweet","_id":%q,"_version":%d,"_score":1.0,"_source":%s}`, testIndexName, id, doc.Version, doc.Source))
+	}
+	return [][]string{hits}
+}
+
+func (s *repositoryTestServer) handle(w http.ResponseWriter, r *http.Request, body []byte) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/_mget":
+		var req struct {
+			Docs []struct {
+				Id string `json:"_id"`
+			} `json:"docs"`
+		}
+		json.Unmarshal(body, &req)
+		var docs []string
+		for _, item := range req.Docs {
+			docs = append(docs, s.getResult(item.Id))
+		}
+		fmt.Fprintf(w, `{"docs":[%s]}`, strings.Join(docs, ","))
+	case r.URL.Path == "/_bulk":
+		var items []string
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		for i := 0; i+1 < len(lines); i += 2 {
+			var command map[string]map[string]interface{}
+			if err := json.Unmarshal([]byte(lines[i]), &command); err != nil {
+				continue
+			}
+			id, _ := command["index"]["_id"].(string)
+			doc, found := s.docs[id]
+			if !found {
+				doc = &repositoryTestDoc{}
+				s.docs[id] = doc
+			}
+			doc.Source = lines[i+1]
+			doc.Version++
+			items = append(items, fmt.Sprintf(`{"index":{"_index":%q,"_type":"tweet","_id":%q,"_version":%d,"status":201}}`, testIndexName, id, doc.Version))
+		}
+		fmt.Fprintf(w, `{"took":1,"errors":false,"items":[%s]}`, strings.Join(items, ","))
+	case len(parts) == 3 && r.Method == "GET":
+		fmt.Fprint(w, s.getResult(parts[2]))
+	case len(parts) == 2 && r.Method == "POST":
+		s.nextId++
+		id := fmt.Sprintf("auto-%d", s.nextId)
+		s.docs[id] = &repositoryTestDoc{Source: string(body), Version: 1}
+		fmt.Fprintf(w, `{"_index":%q,"_type":"tweet","_id":%q,"_version":1,"created":true}`, testIndexName, id)
+	case len(parts) == 3 && (r.Method == "PUT" || r.Method == "DELETE"):
+		id := parts[2]
+		doc, found := s.docs[id]
+		if v := r.URL.Query().Get("version"); v != "" {
+			version, _ := strconv.ParseInt(v, 10, 64)
+			if !found || doc.Version != version {
+				var current int64
+				if found {
+					current = doc.Version
+				}
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprintf(w, `{"error":"VersionConflictEngineException[[%s][0] [tweet][%s]: version conflict, current [%d], provided [%d]]","status":409}`, testIndexName, id, current, version)
+				return
+			}
+		}
+		if r.Method == "DELETE" {
+			delete(s.docs, id)
+			var version int64
+			if found {
+				version = doc.Version + 1
+			}
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			fmt.Fprintf(w, `{"found":%v,"_index":%q,"_type":"tweet","_id":%q,"_version":%d}`, found, testIndexName, id, version)
+			return
+		}
+		if !found {
+			doc = &repositoryTestDoc{}
+			s.docs[id] = doc
+		}
+		doc.Source = string(body)
+		doc.Version++
+		fmt.Fprintf(w, `{"_index":%q,"_type":"tweet","_id":%q,"_version":%d,"created":%v}`, testIndexName, id, doc.Version, !found)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"unexpected request %s %s","status":400}`, r.Method, r.URL.Path)
+	}
+}
+
+// getResult returns the response of a get request for the document.
+func (s *repositoryTestServer) getResult(id string) string {
+	doc, found := s.docs[id]
+	if !found {
+		return fmt.Sprintf(`{"_index":%q,"_type":"tweet","_id":%q,"found":false}`, testIndexName, id)
+	}
+	return fmt.Sprintf(`{"_index":%q,"_type":"tweet","_id":%q,"_version":%d,"found":true,"_source":%s}`, testIndexName, id, doc.Version, doc.Source)
+}
+
+type repositoryTweet struct {
+	Id       string `json:"-" elastic:"_id"`
+	Version  int64  `json:"-" elastic:"_version"`
+	User     string `json:"user" elastic:"index=not_analyzed"`
+	Message  string `json:"message"`
+	Retweets int    `json:"retweets"`
+}
+
+func TestRepositorySaveAndGet(t *testing.T) {
+	ts := newRepositoryTestServer()
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewRepository(client, testIndexName, "tweet", repositoryTweet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Save with automatic id
+	tweet := &repositoryTweet{User: "olivere", Message: "Welcome to Golang and Elasticsearch."}
+	if _, err := repo.Save(tweet); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tweet.Id, "auto-1"; got != want {
+		t.Errorf("expected Id = %q; got %q", want, got)
+	}
+	if got, want := tweet.Version, int64(1); got != want {
+		t.Errorf("expected Version = %d; got %d", want, got)
+	}
+
+	// Get
+	doc, err := repo.Get("auto-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, ok := doc.(*repositoryTweet)
+	if !ok {
+		t.Fatalf("expected *repositoryTweet; got %T", doc)
+	}
+	if got, want := *loaded, *tweet; got != want {
+		t.Errorf("expected %+v; got %+v", want, got)
+	}
+
+	// Save again with version
+	loaded.Retweets = 1
+	if _, err := repo.Save(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.Version, int64(2); got != want {
+		t.Errorf("expected Version = %d; got %d", want, got)
+	}
+
+	// Save with an outdated version
+	tweet.Retweets = 2
+	_, err = repo.Save(tweet)
+	if err == nil {
+		t.Fatal("expected conflict")
+	}
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusConflict {
+		t.Fatalf("expected error with status %d; got %v", http.StatusConflict, err)
+	}
+	if got, want := tweet.Version, int64(1); got != want {
+		t.Errorf("expected Version to be unchanged after conflict = %d; got %d", want, got)
+	}
+
+	// Missing document
+	if _, err := repo.Get("no-such-id"); err != ErrDocumentNotFound {
+		t.Errorf("expected %v; got %v", ErrDocumentNotFound, err)
+	}
+
+	// Delete with outdated version, then with current version
+	if _, err := repo.Delete(tweet); err == nil {
+		t.Fatal("expected conflict")
+	}
+	res, err := repo.Delete(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Found {
+		t.Errorf("expected Found = %v; got %v", true, res.Found)
+	}
+}
+
+func TestRepositoryMultiGetAndSearch(t *testing.T) {
+	ts := newRepositoryTestServer()
+	defer ts.Close()
+	ts.put("1", `{"user":"olivere","message":"Welcome","retweets":1}`)
+	ts.put("2", `{"user":"sandrae","message":"Hello","retweets":"many"}`)
+	ts.put("3", `{"user":"olivere","message":"Again","retweets":3}`)
+	ts.put("3", `{"user":"olivere","message":"Again","retweets":4}`)
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewRepository(client, testIndexName, "tweet", (*repositoryTweet)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// MultiGet
+	docs, err := repo.MultiGet("1", "2", "3", "4")
+	if err == nil {
+		t.Fatal("expected decode error")
+	}
+	decodeErrs, ok := err.(DecodeErrors)
+	if !ok {
+		t.Fatalf("expected DecodeErrors; got %T", err)
+	}
+	if got, want := len(decodeErrs), 1; got != want {
+		t.Fatalf("expected %d decode errors; got %d", want, got)
+	}
+	if got, want := decodeErrs[0].Id, "2"; got != want {
+		t.Errorf("expected decode error of document %q; got %q", want, got)
+	}
+	if got, want := len(docs), 4; got != want {
+		t.Fatalf("expected %d documents; got %d", want, got)
+	}
+	if docs[1] != nil || docs[3] != nil {
+		t.Errorf("expected nil for undecodable and missing documents; got %v and %v", docs[1], docs[3])
+	}
+	if got, want := docs[2].(*repositoryTweet).Version, int64(2); got != want {
+		t.Errorf("expected Version = %d; got %d", want, got)
+	}
+
+	// Search
+	docs, res, err := repo.Find(repo.Search().Query(NewMatchAllQuery()))
+	if _, ok := err.(DecodeErrors); !ok {
+		t.Fatalf("expected DecodeErrors; got %v", err)
+	}
+	if got, want := res.TotalHits(), int64(3); got != want {
+		t.Errorf("expected %d hits; got %d", want, got)
+	}
+	if got, want := len(docs), 2; got != want {
+		t.Fatalf("expected %d documents; got %d", want, got)
+	}
+	for i, id := range []string{"1", "3"} {
+		tweet := docs[i].(*repositoryTweet)
+		if tweet.Id != id {
+			t.Errorf("#%d: expected Id = %q; got %q", i, id, tweet.Id)
+		}
+		if tweet.Version == 0 {
+			t.Errorf("#%d: expected Version to be set", i)
+		}
+	}
+}
+
+func TestRepositorySaveAll(t *testing.T) {
+	ts := newRepositoryTestServer()
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewRepository(client, testIndexName, "tweet", repositoryTweet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := client.BulkProcessor().BulkActions(2).FlushInterval(time.Hour).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SaveAll(p,
+		&repositoryTweet{Id: "1", User: "olivere"},
+		&repositoryTweet{Id: "2", User: "sandrae"},
+		&repositoryTweet{Id: "3", User: "olivere"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := repo.Get("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := doc.(*repositoryTweet).User, "sandrae"; got != want {
+		t.Errorf("expected User = %q; got %q", want, got)
+	}
+	if got, want := len(ts.docs), 3; got != want {
+		t.Errorf("expected %d documents; got %d", want, got)
+	}
+
+	// Wrong document type
+	if err := repo.SaveAll(p, repositoryTweet{Id: "4"}); err == nil {
+		t.Error("expected error for non-pointer document")
+	}
+}
+
+func TestRepositoryErrors(t *testing.T) {
+	client, err := NewSimpleClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	type badVersion struct {
+		Version string `json:"-" elastic:"_version"`
+	}
+	type twoIds struct {
+		A string `elastic:"_id"`
+		B string `elastic:"_id"`
+	}
+	tests := []struct {
+		Value    interface{}
+		Expected string
+	}{
+		// #0
+		{"tweet", "requires a struct"},
+		// #1
+		{badVersion{}, "unsupported type"},
+		// #2
+		{twoIds{}, "more than once"},
+	}
+	for i, test := range tests {
+		_, err := NewRepository(client, testIndexName, "tweet", test.Value)
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Expected) {
+			t.Errorf("#%d: expected error containing %q; got %v", i, test.Expected, err)
+		}
+	}
+}
+
+func TestRepositoryMapping(t *testing.T) {
+	client, err := NewSimpleClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewRepository(client, testIndexName, "tweet", repositoryTweet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := repo.Mapping().Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	expected := `{"tweet":{"properties":{"message":{"type":"string"},"retweets":{"type":"long"},"user":{"index":"not_analyzed","type":"string"}}}}`
+	if got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+}
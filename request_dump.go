@@ -0,0 +1,240 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// PrettyJSON renders source as canonical, indented JSON: object keys are
+// sorted and numbers are kept as they are. Source may be a SearchSource,
+// Query, Filter, Aggregation or anything else with a Source method,
+// a PreparedRequest, JSON text, or any other value that can be serialized.
+//
+// PrettyJSON is useful for debugging and snapshot tests of builders.
+func PrettyJSON(source interface{}) (string, error) {
+	v, err := canonicalSource(source)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// canonicalSource decodes the JSON representation of source into
+// generic values, keeping numbers as json.Number.
+func canonicalSource(source interface{}) (interface{}, error) {
+	data, err := marshalSource(source)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("elastic: invalid JSON: %v", err)
+	}
+	return v, nil
+}
+
+// PreparedRequest is a request as it would be sent to Elasticsearch by
+// a service, e.g. as returned by SearchService.PrepareRequest.
+type PreparedRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Params url.Values  `json:"params,omitempty"`
+	Body   interface{} `json:"body,omitempty"`
+}
+
+// MarshalJSON serializes the request. A body that is passed as a string,
+// e.g. with SearchService.Source, is embedded as JSON.
+func (r *PreparedRequest) MarshalJSON() ([]byte, error) {
+	type request PreparedRequest
+	req := request(*r)
+	if s, ok := r.Body.(string); ok && isJSON(s) {
+		req.Body = json.RawMessage(s)
+	}
+	return json.Marshal(req)
+}
+
+// URL returns the path and the query string of the request.
+func (r *PreparedRequest) URL() string {
+	if len(r.Params) == 0 {
+		return r.Path
+	}
+	return r.Path + "?" + r.Params.Encode()
+}
+
+// String renders the request like the trace log, e.g.
+// "POST /twitter/_search?pretty=1" followed by the indented body.
+func (r *PreparedRequest) String() string {
+	s := r.Method + " " + r.URL()
+	if r.Body == nil {
+		return s
+	}
+	if str, ok := r.Body.(string); ok && !isJSON(str) {
+		return s + "\n" + str
+	}
+	pretty, err := PrettyJSON(r.Body)
+	if err != nil {
+		return s + "\n" + err.Error()
+	}
+	return s + "\n" + pretty
+}
+
+// isJSON reports whether s is valid JSON text.
+func isJSON(s string) bool {
+	var v interface{}
+	return json.Unmarshal([]byte(s), &v) == nil
+}
+
+// -- Diff --
+
+// SourceDiffKind specifies how a value differs, see SourceDifference.
+type SourceDiffKind string
+
+const (
+	// SourceDiffAdded is a value that only exists in the right document.
+	SourceDiffAdded SourceDiffKind = "added"
+	// SourceDiffRemoved is a value that only exists in the left document.
+	SourceDiffRemoved SourceDiffKind = "removed"
+	// SourceDiffChanged is a value that exists in both documents,
+	// but differs.
+	SourceDiffChanged SourceDiffKind = "changed"
+)
+
+// SourceDifference is a single difference between two JSON documents
+// as returned by DiffSources.
+type SourceDifference struct {
+	Kind  SourceDiffKind
+	Path  string      // e.g. "query.bool.must[0].term.user"; empty for the document itself
+	Left  interface{} // value in the left document, unless added
+	Right interface{} // value in the right document, unless removed
+}
+
+// String returns a human readable representation of the difference.
+func (d SourceDifference) String() string {
+	path := d.Path
+	if path == "" {
+		path = "(root)"
+	}
+	switch d.Kind {
+	case SourceDiffAdded:
+		return fmt.Sprintf("+ %s: %s", path, compactJSON(d.Right))
+	case SourceDiffRemoved:
+		return fmt.Sprintf("- %s: %s", path, compactJSON(d.Left))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", path, compactJSON(d.Left), compactJSON(d.Right))
+}
+
+// SourceDiff is the list of differences between two JSON documents,
+// as returned by DiffSources.
+type SourceDiff []SourceDifference
+
+// String returns the differences, one per line.
+func (diff SourceDiff) String() string {
+	lines := make([]string, len(diff))
+	for i, d := range diff {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DiffSources compares the JSON representation of left and right
+// structurally and returns their differences, sorted by path. The sources
+// may be anything accepted by PrettyJSON, e.g. two SearchSources, or two
+// PreparedRequests. Numbers are compared by value, so 1 and 1.0 are equal,
+// but large integers that only differ beyond the precision of float64 are not.
+func DiffSources(left, right interface{}) (SourceDiff, error) {
+	l, err := canonicalSource(left)
+	if err != nil {
+		return nil, err
+	}
+	r, err := canonicalSource(right)
+	if err != nil {
+		return nil, err
+	}
+	var diff SourceDiff
+	diffSourceValues(&diff, "", l, r)
+	return diff, nil
+}
+
+func diffSourceValues(diff *SourceDiff, path string, left, right interface{}) {
+	switch l := left.(type) {
+	case map[string]interface{}:
+		if r, ok := right.(map[string]interface{}); ok {
+			keys := make(map[string]bool)
+			for k := range l {
+				keys[k] = true
+			}
+			for k := range r {
+				keys[k] = true
+			}
+			sorted := make([]string, 0, len(keys))
+			for k := range keys {
+				sorted = append(sorted, k)
+			}
+			sort.Strings(sorted)
+			for _, k := range sorted {
+				p := joinDSLPath(path, k)
+				lv, inLeft := l[k]
+				rv, inRight := r[k]
+				switch {
+				case !inLeft:
+					*diff = append(*diff, SourceDifference{Kind: SourceDiffAdded, Path: p, Right: rv})
+				case !inRight:
+					*diff = append(*diff, SourceDifference{Kind: SourceDiffRemoved, Path: p, Left: lv})
+				default:
+					diffSourceValues(diff, p, lv, rv)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if r, ok := right.([]interface{}); ok {
+			for i := 0; i < len(l) || i < len(r); i++ {
+				p := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(l):
+					*diff = append(*diff, SourceDifference{Kind: SourceDiffAdded, Path: p, Right: r[i]})
+				case i >= len(r):
+					*diff = append(*diff, SourceDifference{Kind: SourceDiffRemoved, Path: p, Left: l[i]})
+				default:
+					diffSourceValues(diff, p, l[i], r[i])
+				}
+			}
+			return
+		}
+	case json.Number:
+		if r, ok := right.(json.Number); ok && jsonNumbersEqual(l, r) {
+			return
+		}
+	default:
+		if left == right {
+			return
+		}
+	}
+	*diff = append(*diff, SourceDifference{Kind: SourceDiffChanged, Path: path, Left: left, Right: right})
+}
+
+// compactJSON returns the JSON representation of v for messages.
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,154 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrettyJSON(t *testing.T) {
+	tests := []struct {
+		Source   interface{}
+		Expected string
+	}{
+		// #0
+		{
+			NewTermQuery("user", "olivere"),
+			"{\n  \"term\": {\n    \"user\": \"olivere\"\n  }\n}",
+		},
+		// #1
+		{
+			NewSearchSource().Query(NewMatchAllQuery()).From(10).Size(5),
+			"{\n  \"from\": 10,\n  \"query\": {\n    \"match_all\": {}\n  },\n  \"size\": 5\n}",
+		},
+		// #2
+		{
+			NewTermsAggregation().Field("user").Size(3),
+			"{\n  \"terms\": {\n    \"field\": \"user\",\n    \"size\": 3\n  }\n}",
+		},
+		// #3
+		{
+			`{"size":10, "query":{"match":{"message":"<b>a & b</b>"}}, "min_score":1.50}`,
+			"{\n  \"min_score\": 1.50,\n  \"query\": {\n    \"match\": {\n      \"message\": \"<b>a & b</b>\"\n    }\n  },\n  \"size\": 10\n}",
+		},
+	}
+	for i, test := range tests {
+		got, err := PrettyJSON(test.Source)
+		if err != nil {
+			t.Errorf("#%d: expected no error; got: %v", i, err)
+			continue
+		}
+		if got != test.Expected {
+			t.Errorf("#%d: expected\n%s\n,got:\n%s", i, test.Expected, got)
+		}
+	}
+
+	if _, err := PrettyJSON(`{"query":`); err == nil {
+		t.Errorf("expected error for invalid JSON")
+	}
+}
+
+func TestPrepareRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected no request; got %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := client.Search("twitter").Type("tweet").Query(NewTermQuery("user", "olivere")).Size(1).Pretty(true).PrepareRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := req.Method, "POST"; got != want {
+		t.Errorf("expected Method = %q; got %q", want, got)
+	}
+	if got, want := req.URL(), "/twitter/tweet/_search?pretty=true"; got != want {
+		t.Errorf("expected URL = %q; got %q", want, got)
+	}
+	expected := "POST /twitter/tweet/_search?pretty=true\n{\n  \"query\": {\n    \"term\": {\n      \"user\": \"olivere\"\n    }\n  },\n  \"size\": 1\n}"
+	if got := req.String(); got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+
+	// Raw sources are embedded as JSON
+	req, err = client.Search().Source(`{"query":{"match_all":{}}}`).PrepareRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"method":"POST","path":"/_search","body":{"query":{"match_all":{}}}}`
+	if got := string(data); got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+
+	// Validation errors are returned
+	_, err = client.Search().Linter(NewLinter()).Query(NewRangeQuery("age")).PrepareRequest()
+	if err == nil {
+		t.Errorf("expected validation error")
+	}
+}
+
+func TestDiffSources(t *testing.T) {
+	left := NewSearchSource().
+		Query(NewBoolQuery().Must(NewTermQuery("user", "olivere"), NewTermQuery("lang", "go"))).
+		From(0).Size(10)
+	right := NewSearchSource().
+		Query(NewBoolQuery().Must(NewTermQuery("user", "sandrae"), NewTermQuery("lang", "go"), NewTermQuery("retweets", 1))).
+		Size(10).
+		Timeout("1s")
+
+	diff, err := DiffSources(left, right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `- from: 0
+~ query.bool.must[0].term.user: "olivere" -> "sandrae"
++ query.bool.must[2]: {"term":{"retweets":1}}
++ timeout: "1s"`
+	if got := diff.String(); got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+	if got, want := diff[1].Kind, SourceDiffChanged; got != want {
+		t.Errorf("expected Kind = %q; got %q", want, got)
+	}
+
+	// Equal documents, written differently
+	diff, err = DiffSources(left, `{"size":10.0,"from":0,"query":{"bool":{"must":[{"term":{"user":"olivere"}},{"term":{"lang":"go"}}]}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 0 {
+		t.Errorf("expected no differences; got:\n%s", diff)
+	}
+
+	// Large integers are compared exactly
+	diff, err = DiffSources(`{"term":{"id":9007199254740993}}`, `{"term":{"id":9007199254740992}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := diff.String(), `~ term.id: 9007199254740993 -> 9007199254740992`; got != want {
+		t.Errorf("expected %q; got %q", want, got)
+	}
+
+	// Different types
+	diff, err = DiffSources(`{"a":[1]}`, `[1]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := diff.String(), `~ (root): {"a":[1]} -> [1]`; got != want {
+		t.Errorf("expected %q; got %q", want, got)
+	}
+}
@@ -276,6 +276,9 @@ func (s *ScanService) DoC(ctx context.Context) (*ScanCursor, error) {
 	if s.routing != "" {
 		params.Set("routing", s.routing)
 	}
+	if s.preference != "" {
+		params.Set("preference", s.preference)
+	}
 
 	// Get response
 	var body interface{}
@@ -310,6 +313,7 @@ type ScanCursor struct {
 	pretty      bool
 	currentPage int
 	ctx         context.Context
+	closed      bool
 }
 
 // NewScanCursor returns new scanCursor without context.
@@ -339,10 +343,12 @@ func (c *ScanCursor) TotalHits() int64 {
 }
 
 // Next returns the next search result or nil when all
-// documents have been scanned.
+// documents have been scanned. The scroll is cleared automatically
+// when Next returns EOS or when the context of the cursor is cancelled.
 //
 // Usage:
 //
+//   defer cursor.Close()
 //   for {
 //     res, err := cursor.Next()
 //     if err == elastic.EOS {
@@ -356,12 +362,17 @@ func (c *ScanCursor) TotalHits() int64 {
 //   }
 //
 func (c *ScanCursor) Next() (*SearchResult, error) {
+	if c.closed {
+		return nil, EOS
+	}
 	if c.currentPage > 0 {
 		if c.Results.Hits == nil || len(c.Results.Hits.Hits) == 0 || c.Results.Hits.TotalHits == 0 {
+			c.closeQuietly()
 			return nil, EOS
 		}
 	}
 	if c.Results.ScrollId == "" {
+		c.closed = true
 		return nil, EOS
 	}
 
@@ -385,6 +396,10 @@ func (c *ScanCursor) Next() (*SearchResult, error) {
 	// Get response
 	res, err := c.client.PerformRequestC(c.ctx, "POST", path, params, body)
 	if err != nil {
+		if c.ctx != nil && c.ctx.Err() != nil {
+			// The caller gave up, so nobody is going to close the cursor
+			c.closeQuietly()
+		}
 		return nil, err
 	}
 
@@ -398,3 +413,36 @@ func (c *ScanCursor) Next() (*SearchResult, error) {
 
 	return c.Results, nil
 }
+
+// Close clears the scroll on the server, releasing the resources
+// associated with the search context. It is safe to call Close multiple
+// times, e.g. in a defer statement after Next has returned EOS.
+// After Close, Next returns EOS.
+func (c *ScanCursor) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.Results == nil {
+		return nil
+	}
+	return clearScroll(c.client, c.Results.ScrollId)
+}
+
+// closeQuietly closes the cursor and logs any error.
+func (c *ScanCursor) closeQuietly() {
+	if err := c.Close(); err != nil {
+		c.client.errorf("elastic: unable to clear scroll: %v", err)
+	}
+}
+
+// clearScroll clears the search context of the given scroll id, if any.
+// It does not use the context of the scan or scroll, as the scroll must
+// also be cleared when that context has been cancelled.
+func clearScroll(client *Client, scrollId string) error {
+	if scrollId == "" {
+		return nil
+	}
+	_, err := client.ClearScroll().ScrollId(scrollId).Do()
+	return err
+}
@@ -0,0 +1,287 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// ParallelScanService scans all shards of the given indices concurrently,
+// using one cursor per shard (via preference=_shards:N), and merges the
+// hits of all cursors onto a single channel.
+//
+// Use ScanService.Parallel to create a ParallelScanService. Notice that
+// hits are returned in no particular order, even if a sort order is given.
+//
+// Usage:
+//
+//	cursor, err := client.Scan("twitter").Size(100).Parallel().DoC(ctx)
+//	if err != nil {
+//	  // Handle error
+//	}
+//	defer cursor.Close()
+//	for hit := range cursor.Hits() {
+//	  // Work with hit
+//	}
+//	if err := cursor.Err(); err != nil {
+//	  // Handle error
+//	}
+type ParallelScanService struct {
+	scan        *ScanService
+	shards      int
+	concurrency int
+	bufferSize  int
+}
+
+// Parallel returns a ParallelScanService that runs the scan concurrently
+// on all shards of the indices.
+func (s *ScanService) Parallel() *ParallelScanService {
+	return &ParallelScanService{scan: s}
+}
+
+// Shards sets the number of shards to scan. By default, the number of
+// shards is determined from the cluster state. If the indices have a
+// different number of shards, the maximum is used.
+func (s *ParallelScanService) Shards(shards int) *ParallelScanService {
+	s.shards = shards
+	return s
+}
+
+// Concurrency sets the maximum number of cursors that are open at the
+// same time. By default, all shards are scanned at once.
+func (s *ParallelScanService) Concurrency(concurrency int) *ParallelScanService {
+	s.concurrency = concurrency
+	return s
+}
+
+// BufferSize sets the capacity of the channel of hits (default: 0).
+func (s *ParallelScanService) BufferSize(bufferSize int) *ParallelScanService {
+	s.bufferSize = bufferSize
+	return s
+}
+
+// Do runs DoC() with default context.
+func (s *ParallelScanService) Do() (*ParallelScanCursor, error) {
+	return s.DoC(nil)
+}
+
+// DoC starts the cursors and returns a ParallelScanCursor to read
+// the hits from. Cancelling ctx stops all cursors and clears their scrolls.
+func (s *ParallelScanService) DoC(ctx context.Context) (*ParallelScanCursor, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	shards := s.shards
+	if shards <= 0 {
+		var err error
+		shards, err = s.numberOfShards(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	concurrency := s.concurrency
+	if concurrency <= 0 || concurrency > shards {
+		concurrency = shards
+	}
+
+	c := &ParallelScanCursor{
+		parent: ctx,
+		hits:   make(chan *SearchHit, s.bufferSize),
+		done:   make(chan struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	shardc := make(chan int, shards)
+	for shard := 0; shard < shards; shard++ {
+		shardc <- shard
+	}
+	close(shardc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for shard := range shardc {
+				if err := c.scanShard(s.shardService(shard)); err != nil {
+					c.fail(err)
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(c.hits)
+		close(c.done)
+	}()
+
+	return c, nil
+}
+
+// shardService returns a copy of the ScanService restricted to the
+// given shard.
+func (s *ParallelScanService) shardService(shard int) *ScanService {
+	svc := *s.scan
+	svc.preference = fmt.Sprintf("_shards:%d", shard)
+	if s.scan.preference != "" {
+		svc.preference += ";" + s.scan.preference
+	}
+	return &svc
+}
+
+// numberOfShards returns the maximum number of shards of the indices
+// to scan, as found in the cluster state.
+func (s *ParallelScanService) numberOfShards(ctx context.Context) (int, error) {
+	state, err := s.scan.client.ClusterState().
+		Indices(s.scan.indices...).
+		Metric("metadata").
+		FlatSettings(true).
+		DoC(ctx)
+	if err != nil {
+		return 0, err
+	}
+	shards := 0
+	if state.Metadata != nil {
+		for index, v := range state.Metadata.Indices {
+			n, err := indexNumberOfShards(v)
+			if err != nil {
+				return 0, fmt.Errorf("elastic: unable to determine number of shards of index %q: %v", index, err)
+			}
+			if n > shards {
+				shards = n
+			}
+		}
+	}
+	if shards == 0 {
+		return 0, fmt.Errorf("elastic: no shards found to scan")
+	}
+	return shards, nil
+}
+
+// indexNumberOfShards returns the number of shards from the metadata
+// of an index in the cluster state, retrieved with flat settings.
+func indexNumberOfShards(metadata interface{}) (int, error) {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return 0, err
+	}
+	var md struct {
+		Settings map[string]interface{} `json:"settings"`
+	}
+	if err := json.Unmarshal(data, &md); err != nil {
+		return 0, err
+	}
+	v, found := md.Settings["index.number_of_shards"]
+	if !found {
+		return 0, fmt.Errorf("missing setting index.number_of_shards")
+	}
+	return strconv.Atoi(fmt.Sprint(v))
+}
+
+// ParallelScanCursor returns the hits of a ParallelScanService.
+type ParallelScanCursor struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	hits   chan *SearchHit
+	done   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// Hits returns the channel of hits. The channel is closed when all shards
+// have been scanned, when an error occurs, or when the cursor is closed.
+// Use Err to find out why the channel has been closed.
+func (c *ParallelScanCursor) Hits() <-chan *SearchHit {
+	return c.hits
+}
+
+// Err returns the first error that occurred while scanning, or the error
+// of the context passed to DoC if it has been cancelled. It returns nil
+// if all shards have been scanned or if the cursor has been closed.
+// Err must only be called after the channel returned by Hits is closed.
+func (c *ParallelScanCursor) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close stops all cursors, clears their scrolls, and waits for them to
+// finish. It is safe to call Close multiple times.
+func (c *ParallelScanCursor) Close() error {
+	c.cancel()
+	<-c.done
+	return nil
+}
+
+// fail records err and stops all other cursors. Errors that are caused
+// by stopping the cursors are ignored.
+func (c *ParallelScanCursor) fail(err error) {
+	if c.ctx.Err() != nil {
+		// Stopped by Close, by another cursor, or by the caller
+		err = c.parent.Err()
+	}
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	c.cancel()
+}
+
+// scanShard runs the scan and sends all hits to the channel of hits.
+func (c *ParallelScanCursor) scanShard(svc *ScanService) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	// The initial request is not cancelled: if the cursor was stopped
+	// while it is in flight, Elasticsearch would open a scroll anyway,
+	// and we would never learn its id to clear it.
+	cursor, err := svc.DoC(nil)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	cursor.ctx = c.ctx
+
+	// The first page only contains hits if the scan is sorted
+	if err := c.send(cursor.Results); err != nil {
+		return err
+	}
+	for {
+		res, err := cursor.Next()
+		if err == EOS {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.send(res); err != nil {
+			return err
+		}
+	}
+}
+
+// send sends the hits of res to the channel of hits.
+func (c *ParallelScanCursor) send(res *SearchResult) error {
+	for _, hit := range searchResultHits(res) {
+		select {
+		case c.hits <- hit:
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newParallelScanTestServer returns a server that simulates an index with
+// the given number of shards and pages (of one hit each) per shard.
+func newParallelScanTestServer(shards, pages int) *testServer {
+	ts := newTestServer()
+	ts.Search = func(r *http.Request, body []byte) [][]string {
+		var shard int
+		fmt.Sscanf(r.URL.Query().Get("preference"), "_shards:%d", &shard)
+		result := [][]string{nil}
+		for page := 1; page <= pages; page++ {
+			result = append(result, []string{fmt.Sprintf(`{"_id":"%d-%d"}`, shard, page)})
+		}
+		return result
+	}
+	ts.Handle = func(w http.ResponseWriter, r *http.Request, body []byte) {
+		// Cluster state with the number of shards of the index
+		fmt.Fprintf(w, `{"metadata":{"indices":{%q:{"settings":{"index.number_of_shards":"%d"}}}}}`, testIndexName, shards)
+	}
+	return ts
+}
+
+func TestParallelScan(t *testing.T) {
+	ts := newParallelScanTestServer(3, 2)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := client.Scan(testIndexName).Parallel().Concurrency(2).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	var ids []string
+	for hit := range cursor.Hits() {
+		ids = append(ids, hit.Id)
+	}
+	if err := cursor.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	if got, want := strings.Join(ids, ","), "0-1,0-2,1-1,1-2,2-1,2-2"; got != want {
+		t.Errorf("expected hits %s; got %s", want, got)
+	}
+	if got, want := len(ts.cleared), len(ts.scrolls); got != want {
+		t.Errorf("expected %d scrolls to be cleared; got %d", want, got)
+	}
+}
+
+func TestParallelScanPreference(t *testing.T) {
+	client, err := NewSimpleClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Preference string
+		Expected   string
+	}{
+		{
+			"",
+			"_shards:2",
+		},
+		{
+			"_local",
+			"_shards:2;_local",
+		},
+	}
+
+	for i, test := range tests {
+		svc := client.Scan(testIndexName).Preference(test.Preference).Parallel().shardService(2)
+		if got := svc.preference; got != test.Expected {
+			t.Errorf("#%d: expected preference %q; got %q", i, test.Expected, got)
+		}
+	}
+}
+
+func TestParallelScanFailure(t *testing.T) {
+	ts := newParallelScanTestServer(3, 100)
+	ts.FailScroll = "2-5"
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := client.Scan(testIndexName).Parallel().Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	for range cursor.Hits() {
+	}
+	err = cursor.Err()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusInternalServerError {
+		t.Errorf("expected error with status %d; got %v", http.StatusInternalServerError, err)
+	}
+	// All cursors must have been stopped and cleared
+	if got, want := len(ts.cleared), len(ts.scrolls); got != want {
+		t.Errorf("expected %d scrolls to be cleared; got %d", want, got)
+	}
+}
+
+func TestParallelScanCancel(t *testing.T) {
+	ts := newParallelScanTestServer(3, 100)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cursor, err := client.Scan(testIndexName).Parallel().DoC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	n := 0
+	for range cursor.Hits() {
+		n++
+		if n == 10 {
+			cancel()
+		}
+	}
+	if got, want := cursor.Err(), context.Canceled; got != want {
+		t.Errorf("expected %v; got %v", want, got)
+	}
+	if got, want := len(ts.cleared), len(ts.scrolls); got != want {
+		t.Errorf("expected %d scrolls to be cleared; got %d", want, got)
+	}
+}
+
+func TestParallelScanClose(t *testing.T) {
+	ts := newParallelScanTestServer(3, 100)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := client.Scan(testIndexName).Parallel().Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-cursor.Hits()
+	if err := cursor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cursor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cursor.Err(); err != nil {
+		t.Errorf("expected no error; got %v", err)
+	}
+	if got, want := len(ts.cleared), len(ts.scrolls); got != want {
+		t.Errorf("expected %d scrolls to be cleared; got %d", want, got)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Hits returns an iterator over all hits of the scan. It takes care of
+// paging and of clearing the scroll. The scan starts with the first call
+// to Next.
+//
+// Usage:
+//
+//	it := client.Scan("twitter").Hits(ctx)
+//	defer it.Close()
+//	for it.Next() {
+//	  var t Tweet
+//	  if err := it.Decode(&t); err != nil {
+//	    // Handle error
+//	  }
+//	  // Work with t
+//	}
+//	if err := it.Err(); err != nil {
+//	  // Handle error
+//	}
+func (s *ScanService) Hits(ctx context.Context) *ScanIterator {
+	return &ScanIterator{service: s, ctx: ctx}
+}
+
+// Stream runs the scan in a separate goroutine and sends all hits to the
+// returned channel. The channel is closed when all hits have been sent,
+// when an error occurs, or when ctx is cancelled. If the scan fails, the
+// error is sent to the error channel before both channels are closed.
+//
+// Usage:
+//
+//	hits, errc := client.Scan("twitter").Stream(ctx)
+//	for hit := range hits {
+//	  // Work with hit
+//	}
+//	if err := <-errc; err != nil {
+//	  // Handle error
+//	}
+func (s *ScanService) Stream(ctx context.Context) (<-chan *SearchHit, <-chan error) {
+	hits := make(chan *SearchHit)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(hits)
+		it := s.Hits(ctx)
+		defer it.Close()
+		for it.Next() {
+			select {
+			case hits <- it.Hit():
+			case <-it.done():
+				errc <- it.ctx.Err()
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			errc <- err
+		}
+	}()
+	return hits, errc
+}
+
+// StreamOf is like Stream, but decodes the _source of each hit into a new
+// value of the given type, e.g. reflect.TypeOf(Tweet{}). If a hit cannot
+// be decoded, the scan stops with an error.
+func (s *ScanService) StreamOf(ctx context.Context, typ reflect.Type) (<-chan interface{}, <-chan error) {
+	docs := make(chan interface{})
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(docs)
+		it := s.Hits(ctx)
+		defer it.Close()
+		for it.Next() {
+			v := reflect.New(typ)
+			if err := it.Decode(v.Interface()); err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case docs <- v.Elem().Interface():
+			case <-it.done():
+				errc <- it.ctx.Err()
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			errc <- err
+		}
+	}()
+	return docs, errc
+}
+
+// ScanIterator iterates over the hits of a ScanService.
+// Use ScanService.Hits to create a ScanIterator.
+type ScanIterator struct {
+	service *ScanService
+	ctx     context.Context
+	cursor  *ScanCursor
+	hits    []*SearchHit
+	hit     *SearchHit
+	err     error
+	closed  bool
+}
+
+// Next advances to the next hit, which is then available via Hit.
+// It returns false when there are no more hits or an error occurred.
+// Use Err to distinguish the two cases.
+func (it *ScanIterator) Next() bool {
+	it.hit = nil
+	if it.closed || it.err != nil {
+		return false
+	}
+	if it.cursor == nil {
+		cursor, err := it.service.DoC(it.ctx)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.cursor = cursor
+		// The first page only contains hits if the scan is sorted
+		it.hits = searchResultHits(cursor.Results)
+	}
+	for len(it.hits) == 0 {
+		res, err := it.cursor.Next()
+		if err == EOS {
+			it.closed = true
+			return false
+		}
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.hits = searchResultHits(res)
+	}
+	it.hit = it.hits[0]
+	it.hits = it.hits[1:]
+	return true
+}
+
+// Hit returns the current hit.
+func (it *ScanIterator) Hit() *SearchHit {
+	return it.hit
+}
+
+// Decode decodes the _source of the current hit into v.
+func (it *ScanIterator) Decode(v interface{}) error {
+	if it.hit == nil {
+		return fmt.Errorf("elastic: no current hit to decode")
+	}
+	if it.hit.Source == nil {
+		return fmt.Errorf("elastic: hit %q has no _source", it.hit.Id)
+	}
+	if err := json.Unmarshal(*it.hit.Source, v); err != nil {
+		return fmt.Errorf("elastic: unable to decode hit %q: %v", it.hit.Id, err)
+	}
+	return nil
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iteration and clears the scroll. It is safe to call
+// Close multiple times, e.g. in a defer statement.
+func (it *ScanIterator) Close() error {
+	it.closed = true
+	it.hit = nil
+	if it.cursor == nil {
+		return nil
+	}
+	return it.cursor.Close()
+}
+
+// done returns the Done channel of the context of the iterator,
+// or nil if there is no context.
+func (it *ScanIterator) done() <-chan struct{} {
+	if it.ctx == nil {
+		return nil
+	}
+	return it.ctx.Done()
+}
+
+// searchResultHits returns the hits of res, if any.
+func searchResultHits(res *SearchResult) []*SearchHit {
+	if res == nil || res.Hits == nil {
+		return nil
+	}
+	return res.Hits.Hits
+}
@@ -0,0 +1,148 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestScanIterator(t *testing.T) {
+	ts := newScrollTestServer(3)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it := client.Scan(testIndexName).Hits(context.Background())
+	defer it.Close()
+
+	var messages []string
+	for it.Next() {
+		var tw tweet
+		if err := it.Decode(&tw); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := it.Hit().Id, fmt.Sprintf("%d", len(messages)+1); got != want {
+			t.Errorf("expected hit %q; got %q", want, got)
+		}
+		messages = append(messages, tw.Message)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(messages), 3; got != want {
+		t.Fatalf("expected %d hits; got %d", want, got)
+	}
+	if got, want := messages[2], "Message 3"; got != want {
+		t.Errorf("expected message %q; got %q", want, got)
+	}
+	if it.Next() {
+		t.Errorf("expected no more hits")
+	}
+	if got, want := len(ts.cleared), 1; got != want {
+		t.Errorf("expected %d scroll to be cleared; got %d", want, got)
+	}
+}
+
+func TestScanStream(t *testing.T) {
+	ts := newScrollTestServer(3)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hits, errc := client.Scan(testIndexName).Stream(context.Background())
+	n := 0
+	for range hits {
+		n++
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 3; got != want {
+		t.Errorf("expected %d hits; got %d", want, got)
+	}
+}
+
+func TestScanStreamOf(t *testing.T) {
+	ts := newScrollTestServer(3)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs, errc := client.Scan(testIndexName).StreamOf(context.Background(), reflect.TypeOf(tweet{}))
+	var tweets []tweet
+	for doc := range docs {
+		tw, ok := doc.(tweet)
+		if !ok {
+			t.Fatalf("expected tweet; got %T", doc)
+		}
+		tweets = append(tweets, tw)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(tweets), 3; got != want {
+		t.Fatalf("expected %d tweets; got %d", want, got)
+	}
+	if got, want := tweets[0].User, "olivere"; got != want {
+		t.Errorf("expected user %q; got %q", want, got)
+	}
+}
+
+func TestScanStreamOfDecodeError(t *testing.T) {
+	ts := newScrollTestServer(3)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs, errc := client.Scan(testIndexName).StreamOf(context.Background(), reflect.TypeOf(0))
+	for range docs {
+		t.Fatal("expected no documents")
+	}
+	if err := <-errc; err == nil {
+		t.Fatal("expected decode error")
+	}
+	if got, want := len(ts.cleared), 1; got != want {
+		t.Errorf("expected %d scroll to be cleared; got %d", want, got)
+	}
+}
+
+func TestScanStreamCancel(t *testing.T) {
+	ts := newScrollTestServer(100)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hits, errc := client.Scan(testIndexName).Stream(ctx)
+	<-hits
+	cancel()
+	for range hits {
+	}
+	if got, want := <-errc, context.Canceled; got != want {
+		t.Errorf("expected %v; got %v", want, got)
+	}
+	if got, want := len(ts.cleared), 1; got != want {
+		t.Errorf("expected %d scroll to be cleared; got %d", want, got)
+	}
+}
@@ -5,6 +5,7 @@
 package elastic
 
 import (
+	"context"
 	"encoding/json"
 	_ "net/http"
 	"testing"
@@ -688,3 +689,79 @@ func TestScanWithRawBody(t *testing.T) {
 		t.Errorf("expected to retrieve %d hits; got %d", 2, numDocs)
 	}
 }
+
+func TestScanCursorClearsScrollOnEOS(t *testing.T) {
+	ts := newScrollTestServer(2)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := client.Scan(testIndexName).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+
+	pages := 0
+	for {
+		_, err := cursor.Next()
+		if err == EOS {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+	}
+	if got, want := pages, 3; got != want {
+		t.Errorf("expected %d pages; got %d", want, got)
+	}
+	if got, want := len(ts.cleared), 1; got != want {
+		t.Fatalf("expected %d scroll to be cleared; got %d", want, got)
+	}
+	if got, want := ts.cleared[0], "1-3"; got != want {
+		t.Errorf("expected scroll %q to be cleared; got %q", want, got)
+	}
+
+	if err := cursor.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cursor.Next(); err != EOS {
+		t.Errorf("expected EOS; got %v", err)
+	}
+	if got, want := len(ts.cleared), 1; got != want {
+		t.Errorf("expected %d scroll to be cleared; got %d", want, got)
+	}
+}
+
+func TestScanCursorClearsScrollOnCancel(t *testing.T) {
+	ts := newScrollTestServer(5)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cursor, err := client.Scan(testIndexName).DoC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cursor.Next(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := cursor.Next(); err == nil {
+		t.Fatal("expected error")
+	}
+	if got, want := len(ts.cleared), 1; got != want {
+		t.Fatalf("expected %d scroll to be cleared; got %d", want, got)
+	}
+	if got, want := ts.cleared[0], "1-1"; got != want {
+		t.Errorf("expected scroll %q to be cleared; got %q", want, got)
+	}
+}
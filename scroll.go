@@ -14,21 +14,37 @@ import (
 )
 
 // ScrollService manages a cursor through documents in Elasticsearch.
+//
+// By default, ScrollService uses the "scan" search type, which is the most
+// efficient way to iterate through documents, but does not support sorting
+// or aggregations and returns no hits on the first page. If a sort order or
+// aggregations are specified, ScrollService uses a regular scroll instead.
+//
+// ScrollService remembers the scroll id returned by Elasticsearch, so
+// callers can simply call Do repeatedly until it returns EOS. The scroll
+// is cleared automatically on EOS and when the context passed to DoC is
+// cancelled. Use Close to clear it when stopping early.
 type ScrollService struct {
-	client    *Client
-	indices   []string
-	types     []string
-	keepAlive string
-	query     Query
-	size      *int
-	pretty    bool
-	scrollId  string
+	client       *Client
+	indices      []string
+	types        []string
+	keepAlive    string
+	searchSource *SearchSource
+	body         interface{}
+	searchType   string
+	routing      string
+	preference   string
+	size         *int
+	pretty       bool
+	scrollId     string
+	closed       bool
 }
 
+// NewScrollService creates a new ScrollService.
 func NewScrollService(client *Client) *ScrollService {
 	builder := &ScrollService{
-		client: client,
-		query:  NewMatchAllQuery(),
+		client:       client,
+		searchSource: NewSearchSource().Query(NewMatchAllQuery()),
 	}
 	return builder
 }
@@ -79,32 +95,159 @@ func (s *ScrollService) KeepAlive(keepAlive string) *ScrollService {
 	return s
 }
 
+// Query sets the query to perform, e.g. MatchAllQuery.
 func (s *ScrollService) Query(query Query) *ScrollService {
-	s.query = query
+	s.searchSource = s.searchSource.Query(query)
 	return s
 }
 
+// SearchSource sets the search source builder to use with this service,
+// e.g. the one also used with SearchService. It allows to specify sorting,
+// fields, source filtering, post filters, aggregations etc.
+func (s *ScrollService) SearchSource(searchSource *SearchSource) *ScrollService {
+	s.searchSource = searchSource
+	if s.searchSource == nil {
+		s.searchSource = NewSearchSource().Query(NewMatchAllQuery())
+	}
+	return s
+}
+
+// Body sets the raw body to send to Elasticsearch. This can be e.g. a string,
+// a map[string]interface{} or anything that can be serialized into JSON.
+// Notice that setting the body disables the use of SearchSource and many
+// other properties of the ScrollService.
+func (s *ScrollService) Body(body interface{}) *ScrollService {
+	s.body = body
+	return s
+}
+
+// PostFilter is executed as the last filter. It only affects the
+// search hits but not facets or aggregations.
+func (s *ScrollService) PostFilter(postFilter Filter) *ScrollService {
+	s.searchSource = s.searchSource.PostFilter(postFilter)
+	return s
+}
+
+// Aggregation adds an aggregation to perform as part of the search.
+// Aggregations are returned with the first page only. Specifying an
+// aggregation disables the "scan" search type.
+func (s *ScrollService) Aggregation(name string, aggregation Aggregation) *ScrollService {
+	s.searchSource = s.searchSource.Aggregation(name, aggregation)
+	return s
+}
+
+// Fields tells Elasticsearch to only load specific fields from a search hit.
+func (s *ScrollService) Fields(fields ...string) *ScrollService {
+	s.searchSource = s.searchSource.Fields(fields...)
+	return s
+}
+
+// FetchSource indicates whether the response should contain the stored
+// _source for every hit.
+func (s *ScrollService) FetchSource(fetchSource bool) *ScrollService {
+	s.searchSource = s.searchSource.FetchSource(fetchSource)
+	return s
+}
+
+// FetchSourceContext indicates how the _source should be fetched.
+func (s *ScrollService) FetchSourceContext(fetchSourceContext *FetchSourceContext) *ScrollService {
+	s.searchSource = s.searchSource.FetchSourceContext(fetchSourceContext)
+	return s
+}
+
+// Version can be set to true to return a version for each search hit.
+func (s *ScrollService) Version(version bool) *ScrollService {
+	s.searchSource = s.searchSource.Version(version)
+	return s
+}
+
+// Sort the results by the given field, in the given order.
+// Specifying a sort order disables the "scan" search type.
+func (s *ScrollService) Sort(field string, ascending bool) *ScrollService {
+	s.searchSource = s.searchSource.Sort(field, ascending)
+	return s
+}
+
+// SortWithInfo defines how to sort results.
+// Specifying a sort order disables the "scan" search type.
+func (s *ScrollService) SortWithInfo(info SortInfo) *ScrollService {
+	s.searchSource = s.searchSource.SortWithInfo(info)
+	return s
+}
+
+// SortBy defines how to sort results.
+// Specifying a sort order disables the "scan" search type.
+func (s *ScrollService) SortBy(sorter ...Sorter) *ScrollService {
+	s.searchSource = s.searchSource.SortBy(sorter...)
+	return s
+}
+
+// SearchType sets the search type explicitly, e.g. "scan" or
+// "query_then_fetch". By default, "scan" is used unless a sort order
+// or aggregations are specified.
+func (s *ScrollService) SearchType(searchType string) *ScrollService {
+	s.searchType = searchType
+	return s
+}
+
+// Routing allows for (a comma-separated) list of specific routing values.
+func (s *ScrollService) Routing(routings ...string) *ScrollService {
+	s.routing = strings.Join(routings, ",")
+	return s
+}
+
+// Preference specifies the node or shard the operation should be
+// performed on (default: "random").
+func (s *ScrollService) Preference(preference string) *ScrollService {
+	s.preference = preference
+	return s
+}
+
+// Pretty enables the caller to indent the JSON output.
 func (s *ScrollService) Pretty(pretty bool) *ScrollService {
 	s.pretty = pretty
 	return s
 }
 
+// Size is the number of results to return per page. Notice that with
+// the "scan" search type, size is the number of results per shard, not
+// per page.
 func (s *ScrollService) Size(size int) *ScrollService {
 	s.size = &size
 	return s
 }
 
+// ScrollId specifies the scroll id to continue with. ScrollService keeps
+// track of the scroll id returned by Elasticsearch, so you only need to set
+// it when continuing a scroll started elsewhere.
 func (s *ScrollService) ScrollId(scrollId string) *ScrollService {
 	s.scrollId = scrollId
 	return s
 }
 
+// isScan returns true if the "scan" search type is used.
+func (s *ScrollService) isScan() bool {
+	if s.searchType != "" {
+		return s.searchType == "scan"
+	}
+	if s.body != nil {
+		return true
+	}
+	return !s.searchSource.hasSort() && len(s.searchSource.aggregations) == 0
+}
+
 // Do runs DoC() with default context.
 func (s *ScrollService) Do() (*SearchResult, error) {
 	return s.DoC(nil)
 }
 
+// DoC returns the first page of results when called for the first time,
+// and the next page on subsequent calls. It returns EOS when there are
+// no more results.
 func (s *ScrollService) DoC(ctx context.Context) (*SearchResult, error) {
+	if s.closed {
+		return nil, EOS
+	}
 	if s.scrollId == "" {
 		return s.GetFirstPageC(ctx)
 	}
@@ -115,6 +258,8 @@ func (s *ScrollService) GetFirstPage() (*SearchResult, error) {
 	return s.GetFirstPageC(nil)
 }
 
+// GetFirstPageC starts a new scroll and returns the first page of results.
+// Notice that with the "scan" search type, the first page contains no hits.
 func (s *ScrollService) GetFirstPageC(ctx context.Context) (*SearchResult, error) {
 	// Build url
 	path := "/"
@@ -154,7 +299,11 @@ func (s *ScrollService) GetFirstPageC(ctx context.Context) (*SearchResult, error
 
 	// Parameters
 	params := make(url.Values)
-	params.Set("search_type", "scan")
+	if s.searchType != "" {
+		params.Set("search_type", s.searchType)
+	} else if s.isScan() {
+		params.Set("search_type", "scan")
+	}
 	if s.pretty {
 		params.Set("pretty", fmt.Sprintf("%v", s.pretty))
 	}
@@ -166,11 +315,19 @@ func (s *ScrollService) GetFirstPageC(ctx context.Context) (*SearchResult, error
 	if s.size != nil && *s.size > 0 {
 		params.Set("size", fmt.Sprintf("%d", *s.size))
 	}
+	if s.routing != "" {
+		params.Set("routing", s.routing)
+	}
+	if s.preference != "" {
+		params.Set("preference", s.preference)
+	}
 
 	// Set body
-	body := make(map[string]interface{})
-	if s.query != nil {
-		body["query"] = s.query.Source()
+	var body interface{}
+	if s.body != nil {
+		body = s.body
+	} else {
+		body = s.searchSource.Source()
 	}
 
 	// Get response
@@ -178,12 +335,14 @@ func (s *ScrollService) GetFirstPageC(ctx context.Context) (*SearchResult, error
 	if err != nil {
 		return nil, err
 	}
+	s.closed = false
 
 	// Return result
 	searchResult := new(SearchResult)
 	if err := s.client.decoder.Decode(res.Body, searchResult); err != nil {
 		return nil, err
 	}
+	s.scrollId = searchResult.ScrollId
 
 	return searchResult, nil
 }
@@ -192,8 +351,10 @@ func (s *ScrollService) GetNextPage() (*SearchResult, error) {
 	return s.GetNextPageC(nil)
 }
 
+// GetNextPageC returns the next page of results, or EOS if there are
+// no more results.
 func (s *ScrollService) GetNextPageC(ctx context.Context) (*SearchResult, error) {
-	if s.scrollId == "" {
+	if s.closed || s.scrollId == "" {
 		return nil, EOS
 	}
 
@@ -214,6 +375,10 @@ func (s *ScrollService) GetNextPageC(ctx context.Context) (*SearchResult, error)
 	// Get response
 	res, err := s.client.PerformRequestC(ctx, "POST", path, params, s.scrollId)
 	if err != nil {
+		if ctx != nil && ctx.Err() != nil {
+			// The caller gave up, so nobody is going to close the scroll
+			s.closeQuietly()
+		}
 		return nil, err
 	}
 
@@ -222,11 +387,36 @@ func (s *ScrollService) GetNextPageC(ctx context.Context) (*SearchResult, error)
 	if err := s.client.decoder.Decode(res.Body, searchResult); err != nil {
 		return nil, err
 	}
+	if searchResult.ScrollId != "" {
+		s.scrollId = searchResult.ScrollId
+	}
 
 	// Determine last page
 	if searchResult == nil || searchResult.Hits == nil || len(searchResult.Hits.Hits) == 0 || searchResult.Hits.TotalHits == 0 {
-        	return searchResult, EOS
-    	}
+		s.closeQuietly()
+		return searchResult, EOS
+	}
 
 	return searchResult, nil
 }
+
+// Close clears the scroll on the server, releasing the resources
+// associated with the search context. It is safe to call Close multiple
+// times, e.g. in a defer statement after Do has returned EOS.
+// After Close, Do returns EOS.
+func (s *ScrollService) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	scrollId := s.scrollId
+	s.scrollId = ""
+	return clearScroll(s.client, scrollId)
+}
+
+// closeQuietly closes the scroll and logs any error.
+func (s *ScrollService) closeQuietly() {
+	if err := s.Close(); err != nil {
+		s.client.errorf("elastic: unable to clear scroll: %v", err)
+	}
+}
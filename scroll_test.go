@@ -5,8 +5,10 @@
 package elastic
 
 import (
+	"context"
 	"encoding/json"
-	_ "net/http"
+	"fmt"
+	"net/http"
 	"testing"
 )
 
@@ -104,3 +106,217 @@ func TestScroll(t *testing.T) {
 		t.Errorf("expected to retrieve %d hits; got %d", 3, numDocs)
 	}
 }
+
+func TestScrollWithSortAndSearchSource(t *testing.T) {
+	client := setupTestClientAndCreateIndexAndAddDocs(t)
+
+	src := NewSearchSource().
+		Query(NewMatchAllQuery()).
+		FetchSourceContext(NewFetchSourceContext(true).Include("message")).
+		Sort("message", true)
+	svc := client.Scroll(testIndexName).SearchSource(src).Size(1)
+
+	var messages []string
+	for {
+		res, err := svc.Do()
+		if err == EOS {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.ScrollId == "" {
+			t.Errorf("expected scrollId in results; got %q", res.ScrollId)
+		}
+		for _, hit := range res.Hits.Hits {
+			item := make(map[string]interface{})
+			if err := json.Unmarshal(*hit.Source, &item); err != nil {
+				t.Fatal(err)
+			}
+			if _, found := item["user"]; found {
+				t.Errorf("expected _source to not contain user; got %v", item)
+			}
+			messages = append(messages, item["message"].(string))
+		}
+	}
+
+	if got, want := len(messages), 3; got != want {
+		t.Fatalf("expected to retrieve %d hits; got %d", want, got)
+	}
+	for i := 1; i < len(messages); i++ {
+		if messages[i-1] > messages[i] {
+			t.Errorf("expected messages to be sorted; got %v", messages)
+		}
+	}
+}
+
+func TestScrollRequests(t *testing.T) {
+	ts := newTestServer()
+	ts.Search = func(r *http.Request, body []byte) [][]string {
+		return [][]string{
+			{`{"_index":"elastic-test","_type":"tweet","_id":"1"}`},
+			{`{"_index":"elastic-test","_type":"tweet","_id":"2"}`},
+		}
+	}
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := client.Scroll(testIndexName).
+		Query(NewTermQuery("user", "olivere")).
+		Sort("message", true).
+		Aggregation("users", NewTermsAggregation().Field("user")).
+		Size(1)
+	for {
+		_, err := svc.Do()
+		if err == EOS {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The last request clears the scroll
+	if got, want := len(ts.requests), 4; got != want {
+		t.Fatalf("expected %d requests; got %d", want, got)
+	}
+	if got, want := ts.requests[3].Method, "DELETE"; got != want {
+		t.Errorf("expected method %q; got %q", want, got)
+	}
+	if got, want := ts.requests[0].URL.Path, "/"+testIndexName+"/_search"; got != want {
+		t.Errorf("expected path %q; got %q", want, got)
+	}
+	if got := ts.requests[0].URL.Query().Get("search_type"); got != "" {
+		t.Errorf("expected no search_type for sorted scroll; got %q", got)
+	}
+	if got, want := ts.bodies[0], `{"aggregations":{"users":{"terms":{"field":"user"}}},"query":{"term":{"user":"olivere"}},"sort":[{"message":{"order":"asc"}}]}`; got != want {
+		t.Errorf("expected body %s; got %s", want, got)
+	}
+	if got, want := ts.bodies[1], "1-0"; got != want {
+		t.Errorf("expected scroll id %q; got %q", want, got)
+	}
+	if got, want := ts.bodies[2], "1-1"; got != want {
+		t.Errorf("expected scroll id %q; got %q", want, got)
+	}
+}
+
+// newScrollTestServer returns a server that simulates a scan with the
+// given number of pages of one hit each, after an initial empty page.
+func newScrollTestServer(pages int) *testServer {
+	ts := newTestServer()
+	ts.Search = func(r *http.Request, body []byte) [][]string {
+		result := [][]string{nil}
+		for i := 1; i <= pages; i++ {
+			result = append(result, []string{fmt.Sprintf(`{"_id":"%d","_source":{"user":"olivere","message":"Message %d"}}`, i, i)})
+		}
+		return result
+	}
+	return ts
+}
+
+func TestScrollClearsScrollOnEOS(t *testing.T) {
+	ts := newScrollTestServer(2)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := client.Scroll(testIndexName)
+	defer svc.Close()
+	pages := 0
+	for {
+		_, err := svc.Do()
+		if err == EOS {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+	}
+	if got, want := pages, 3; got != want {
+		t.Errorf("expected %d pages; got %d", want, got)
+	}
+	if got, want := len(ts.cleared), 1; got != want {
+		t.Fatalf("expected %d scroll to be cleared; got %d", want, got)
+	}
+	if got, want := ts.cleared[0], "1-3"; got != want {
+		t.Errorf("expected scroll %q to be cleared; got %q", want, got)
+	}
+
+	// Close is idempotent, and Do keeps returning EOS
+	if err := svc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Do(); err != EOS {
+		t.Errorf("expected EOS; got %v", err)
+	}
+	if got, want := len(ts.cleared), 1; got != want {
+		t.Errorf("expected %d scroll to be cleared; got %d", want, got)
+	}
+}
+
+func TestScrollClose(t *testing.T) {
+	ts := newScrollTestServer(5)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := client.Scroll(testIndexName)
+	if _, err := svc.Do(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Do(); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(ts.cleared), 1; got != want {
+		t.Fatalf("expected %d scroll to be cleared; got %d", want, got)
+	}
+	if got, want := ts.cleared[0], "1-1"; got != want {
+		t.Errorf("expected scroll %q to be cleared; got %q", want, got)
+	}
+	if _, err := svc.Do(); err != EOS {
+		t.Errorf("expected EOS; got %v", err)
+	}
+}
+
+func TestScrollClearsScrollOnCancel(t *testing.T) {
+	ts := newScrollTestServer(5)
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	svc := client.Scroll(testIndexName)
+	if _, err := svc.DoC(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := svc.DoC(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+	if got, want := len(ts.cleared), 1; got != want {
+		t.Fatalf("expected %d scroll to be cleared; got %d", want, got)
+	}
+	if got, want := ts.cleared[0], "1-0"; got != want {
+		t.Errorf("expected scroll %q to be cleared; got %q", want, got)
+	}
+}
@@ -30,6 +30,7 @@ type SearchService struct {
 	ignoreUnavailable *bool
 	allowNoIndices    *bool
 	expandWildcards   string
+	linter            *Linter
 }
 
 // NewSearchService creates a new service for searching in Elasticsearch.
@@ -307,6 +308,13 @@ func (s *SearchService) ExpandWildcards(expandWildcards string) *SearchService {
 	return s
 }
 
+// Linter sets a linter that Validate runs over the search request,
+// so that requests with errors fail before they are sent to Elasticsearch.
+func (s *SearchService) Linter(linter *Linter) *SearchService {
+	s.linter = linter
+	return s
+}
+
 // buildURL builds the URL for the operation.
 func (s *SearchService) buildURL() (string, url.Values, error) {
 	var err error
@@ -360,9 +368,41 @@ func (s *SearchService) buildURL() (string, url.Values, error) {
 
 // Validate checks if the operation is valid.
 func (s *SearchService) Validate() error {
+	if s.linter != nil {
+		if err := s.linter.Validate(s.body()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// body returns the body of the search request.
+func (s *SearchService) body() interface{} {
+	if s.source != nil {
+		return s.source
+	}
+	return s.searchSource.Source()
+}
+
+// PrepareRequest returns the request that Do would send to Elasticsearch,
+// without executing it. Use it e.g. with PrettyJSON or DiffSources
+// to test search requests.
+func (s *SearchService) PrepareRequest() (*PreparedRequest, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	path, params, err := s.buildURL()
+	if err != nil {
+		return nil, err
+	}
+	return &PreparedRequest{
+		Method: "POST",
+		Path:   path,
+		Params: params,
+		Body:   s.body(),
+	}, nil
+}
+
 // Do runs DoC() with default context.
 func (s *SearchService) Do() (*SearchResult, error) {
 	return s.DoC(nil)
@@ -382,13 +422,7 @@ func (s *SearchService) DoC(ctx context.Context) (*SearchResult, error) {
 	}
 
 	// Perform request
-	var body interface{}
-	if s.source != nil {
-		body = s.source
-	} else {
-		body = s.searchSource.Source()
-	}
-	res, err := s.client.PerformRequestC(ctx, "POST", path, params, body)
+	res, err := s.client.PerformRequestC(ctx, "POST", path, params, s.body())
 	if err != nil {
 		return nil, err
 	}
@@ -432,7 +466,7 @@ func (r *SearchResult) TotalHits() int64 {
 
 // Each is a utility function to iterate over all hits. It saves you from
 // checking for nil values. Notice that Each will ignore errors in
-// serializing JSON.
+// serializing JSON. Use Decode to get those errors.
 func (r *SearchResult) Each(typ reflect.Type) []interface{} {
 	if r.Hits == nil || r.Hits.Hits == nil || len(r.Hits.Hits) == 0 {
 		return nil
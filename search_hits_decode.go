@@ -0,0 +1,370 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// HitDecoder decodes search hits into a slice of Go values. Unlike
+// SearchResult.Each, it does not skip hits that cannot be decoded:
+// the error is of type DecodeErrors and lists the ids of the affected
+// hits, and the hits that could be decoded are returned nevertheless.
+//
+// The values may be structs, pointers to structs, maps, or interface{}.
+// Structs may tag fields with metadata of the hit, e.g.:
+//
+//	type Tweet struct {
+//		Id        string              `json:"-" elastic:"_id"`
+//		Score     float64             `json:"-" elastic:"_score"`
+//		Version   int64               `json:"-" elastic:"_version"`
+//		Highlight map[string][]string `json:"-" elastic:"_highlight"`
+//		Comments  []Comment           `json:"-" elastic:"_inner_hits=comments"`
+//		User      string              `json:"user"`
+//		Message   string              `json:"message"`
+//	}
+//
+// Supported metadata are _id, _index, _type, _version, _score, _sort,
+// _highlight, _matched_queries, and _inner_hits=name, which decodes the
+// inner hits with the given name into a slice (or a *SearchHitInnerHits).
+//
+// Stored fields, as returned when using SearchService.Fields, are
+// merged into the value after the source. Single values are unwrapped
+// from their array if the struct field is not a slice.
+type HitDecoder struct {
+	decoder  Decoder
+	metadata bool
+	fields   bool
+}
+
+// NewHitDecoder creates a new HitDecoder.
+func NewHitDecoder() *HitDecoder {
+	return &HitDecoder{
+		decoder:  &DefaultDecoder{},
+		metadata: true,
+		fields:   true,
+	}
+}
+
+// Decoder sets the decoder for the source and fields of the hits.
+// It defaults to DefaultDecoder.
+func (d *HitDecoder) Decoder(decoder Decoder) *HitDecoder {
+	d.decoder = decoder
+	return d
+}
+
+// Metadata specifies whether to set the fields tagged with metadata
+// like _id or _score. It is enabled by default.
+func (d *HitDecoder) Metadata(metadata bool) *HitDecoder {
+	d.metadata = metadata
+	return d
+}
+
+// Fields specifies whether to merge stored fields into the values.
+// It is enabled by default.
+func (d *HitDecoder) Fields(fields bool) *HitDecoder {
+	d.fields = fields
+	return d
+}
+
+// DecodeHits decodes hits into dst, which must be a pointer to a slice.
+// The slice is replaced by the decoded hits.
+func (d *HitDecoder) DecodeHits(hits *SearchHits, dst interface{}) error {
+	slice := reflect.ValueOf(dst)
+	if slice.Kind() != reflect.Ptr || slice.IsNil() || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("elastic: decoding hits requires a pointer to a slice; got %T", dst)
+	}
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+	meta, err := d.metaFields(elemType)
+	if err != nil {
+		return err
+	}
+
+	var list []*SearchHit
+	if hits != nil {
+		list = hits.Hits
+	}
+	result := reflect.MakeSlice(slice.Type(), 0, len(list))
+	var errs DecodeErrors
+	for _, hit := range list {
+		ptr := reflect.New(elemType)
+		if err := d.decodeHit(hit, ptr, meta); err != nil {
+			errs = append(errs, &DecodeError{Index: hit.Index, Type: hit.Type, Id: hit.Id, Err: err})
+			continue
+		}
+		result = reflect.Append(result, ptr.Elem())
+	}
+	slice.Set(result)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// DecodeHit decodes a single hit into dst, which must be a pointer.
+// The error is of type *DecodeError if the hit cannot be decoded.
+func (d *HitDecoder) DecodeHit(hit *SearchHit, dst interface{}) error {
+	ptr := reflect.ValueOf(dst)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return fmt.Errorf("elastic: decoding a hit requires a pointer; got %T", dst)
+	}
+	if hit == nil {
+		return nil
+	}
+	meta, err := d.metaFields(ptr.Type().Elem())
+	if err != nil {
+		return err
+	}
+	if err := d.decodeHit(hit, ptr, meta); err != nil {
+		return &DecodeError{Index: hit.Index, Type: hit.Type, Id: hit.Id, Err: err}
+	}
+	return nil
+}
+
+// metaFields returns the metadata fields of values of type t, or nil
+// if metadata is disabled or t is not a struct.
+func (d *HitDecoder) metaFields(t reflect.Type) (*hitMetaFields, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if !d.metadata || t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	return newHitMetaFields(t)
+}
+
+// decodeHit decodes hit into the value ptr points to. Pointers in
+// between, e.g. for a []*Tweet, are allocated as needed.
+func (d *HitDecoder) decodeHit(hit *SearchHit, ptr reflect.Value, meta *hitMetaFields) error {
+	for ptr.Elem().Kind() == reflect.Ptr {
+		if ptr.Elem().IsNil() {
+			ptr.Elem().Set(reflect.New(ptr.Elem().Type().Elem()))
+		}
+		ptr = ptr.Elem()
+	}
+	if hit.Source != nil {
+		if err := d.decoder.Decode(*hit.Source, ptr.Interface()); err != nil {
+			return err
+		}
+	}
+	// Decoding into an interface{} would replace the source
+	if d.fields && len(hit.Fields) > 0 && (hit.Source == nil || ptr.Elem().Kind() != reflect.Interface) {
+		data, err := json.Marshal(hitFieldValues(hit.Fields, ptr.Elem().Type()))
+		if err != nil {
+			return err
+		}
+		if err := d.decoder.Decode(data, ptr.Interface()); err != nil {
+			return err
+		}
+	}
+	if meta != nil {
+		return meta.set(d, ptr.Elem(), hit)
+	}
+	return nil
+}
+
+// hitFieldValues returns the stored fields of a hit to be decoded
+// into a value of type t. Fields are returned as arrays by
+// Elasticsearch; single values are unwrapped if the field of t
+// is not a slice.
+func hitFieldValues(fields map[string]interface{}, t reflect.Type) map[string]interface{} {
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	values := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		values[name] = value
+		list, ok := value.([]interface{})
+		if !ok || len(list) != 1 {
+			continue
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if jsonName, ok := structMappingFieldName(field); !ok || jsonName != name || field.PkgPath != "" {
+				continue
+			}
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() != reflect.Slice && ft.Kind() != reflect.Array {
+				values[name] = list[0]
+			}
+			break
+		}
+	}
+	return values
+}
+
+// -- Decoding helpers --
+
+// Decode decodes the hits of the search result into dst, which must be
+// a pointer to a slice. See HitDecoder for details.
+func (r *SearchResult) Decode(dst interface{}) error {
+	return NewHitDecoder().DecodeHits(r.Hits, dst)
+}
+
+// Decode decodes the hits into dst, which must be a pointer to a slice.
+// See HitDecoder for details.
+func (hits *SearchHits) Decode(dst interface{}) error {
+	return NewHitDecoder().DecodeHits(hits, dst)
+}
+
+// Decode decodes the hit into dst, which must be a pointer.
+// See HitDecoder for details.
+func (hit *SearchHit) Decode(dst interface{}) error {
+	return NewHitDecoder().DecodeHit(hit, dst)
+}
+
+// Decode decodes the inner hits into dst, which must be a pointer
+// to a slice. See HitDecoder for details.
+func (h *SearchHitInnerHits) Decode(dst interface{}) error {
+	return NewHitDecoder().DecodeHits(h.Hits, dst)
+}
+
+// Decode decodes the hits of a top-hits aggregation into dst, which
+// must be a pointer to a slice. See HitDecoder for details.
+func (a *AggregationTopHitsMetric) Decode(dst interface{}) error {
+	return NewHitDecoder().DecodeHits(a.Hits, dst)
+}
+
+// -- Metadata fields --
+
+var (
+	searchHitHighlightType = reflect.TypeOf(SearchHitHighlight{})
+	searchHitInnerHitsType = reflect.TypeOf(&SearchHitInnerHits{})
+	interfaceSliceType     = reflect.TypeOf([]interface{}{})
+	stringSliceType        = reflect.TypeOf([]string{})
+)
+
+// hitMetaFields are the fields of a struct that are tagged with
+// metadata of a search hit, e.g. elastic:"_score".
+type hitMetaFields struct {
+	fields    map[string][]int // metadata name -> field index
+	innerHits map[string][]int // name of inner hits -> field index
+}
+
+// hitMetaSupported returns true if a field of type t can hold the
+// metadata with the given name.
+func hitMetaSupported(name string, t reflect.Type) (bool, bool) {
+	switch name {
+	case "_id", "_index", "_type":
+		return t.Kind() == reflect.String, true
+	case "_version":
+		switch t.Kind() {
+		case reflect.Int, reflect.Int64:
+			return true, true
+		}
+		return false, true
+	case "_score":
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		return t.Kind() == reflect.Float64 || t.Kind() == reflect.Float32, true
+	case "_sort":
+		return interfaceSliceType.AssignableTo(t), true
+	case "_highlight":
+		return searchHitHighlightType.ConvertibleTo(t), true
+	case "_matched_queries":
+		return stringSliceType.ConvertibleTo(t), true
+	}
+	return false, false
+}
+
+// newHitMetaFields finds the fields tagged with metadata in struct type t.
+func newHitMetaFields(t reflect.Type) (*hitMetaFields, error) {
+	m := &hitMetaFields{
+		fields:    make(map[string][]int),
+		innerHits: make(map[string][]int),
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		for _, part := range strings.Split(field.Tag.Get("elastic"), ",") {
+			part = strings.TrimSpace(part)
+			if strings.HasPrefix(part, "_inner_hits=") {
+				name := strings.TrimPrefix(part, "_inner_hits=")
+				if field.Type != searchHitInnerHitsType && field.Type.Kind() != reflect.Slice {
+					return nil, fmt.Errorf("elastic: field %s.%s tagged with _inner_hits has unsupported type %v", t.Name(), field.Name, field.Type)
+				}
+				m.innerHits[name] = field.Index
+				continue
+			}
+			ok, known := hitMetaSupported(part, field.Type)
+			if !known {
+				continue
+			}
+			if !ok {
+				return nil, fmt.Errorf("elastic: field %s.%s tagged with %s has unsupported type %v", t.Name(), field.Name, part, field.Type)
+			}
+			if _, found := m.fields[part]; found {
+				return nil, fmt.Errorf("elastic: %s tagged more than once in %v", part, t)
+			}
+			m.fields[part] = field.Index
+		}
+	}
+	return m, nil
+}
+
+// set sets the metadata fields of the struct v from hit.
+func (m *hitMetaFields) set(d *HitDecoder, v reflect.Value, hit *SearchHit) error {
+	for name, index := range m.fields {
+		field := v.FieldByIndex(index)
+		switch name {
+		case "_id":
+			field.SetString(hit.Id)
+		case "_index":
+			field.SetString(hit.Index)
+		case "_type":
+			field.SetString(hit.Type)
+		case "_version":
+			if hit.Version != nil {
+				field.SetInt(*hit.Version)
+			}
+		case "_score":
+			if hit.Score == nil {
+				continue
+			}
+			if field.Kind() == reflect.Ptr {
+				score := reflect.New(field.Type().Elem())
+				score.Elem().SetFloat(*hit.Score)
+				field.Set(score)
+			} else {
+				field.SetFloat(*hit.Score)
+			}
+		case "_sort":
+			field.Set(reflect.ValueOf(hit.Sort))
+		case "_highlight":
+			if hit.Highlight != nil {
+				field.Set(reflect.ValueOf(hit.Highlight).Convert(field.Type()))
+			}
+		case "_matched_queries":
+			if hit.MatchedQueries != nil {
+				field.Set(reflect.ValueOf(hit.MatchedQueries).Convert(field.Type()))
+			}
+		}
+	}
+	for name, index := range m.innerHits {
+		inner, found := hit.InnerHits[name]
+		if !found || inner == nil {
+			continue
+		}
+		field := v.FieldByIndex(index)
+		if field.Type() == searchHitInnerHitsType {
+			field.Set(reflect.ValueOf(inner))
+			continue
+		}
+		if err := d.DecodeHits(inner.Hits, field.Addr().Interface()); err != nil {
+			return fmt.Errorf("inner hits %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type hitDecodeComment struct {
+	Id    string   `json:"-" elastic:"_id"`
+	Score *float64 `json:"-" elastic:"_score"`
+	User  string   `json:"user"`
+}
+
+type hitDecodeTweet struct {
+	Id             string              `json:"-" elastic:"_id"`
+	Index          string              `json:"-" elastic:"_index"`
+	Type           string              `json:"-" elastic:"_type"`
+	Version        int64               `json:"-" elastic:"_version"`
+	Score          float64             `json:"-" elastic:"_score"`
+	Sort           []interface{}       `json:"-" elastic:"_sort"`
+	Highlight      map[string][]string `json:"-" elastic:"_highlight"`
+	MatchedQueries []string            `json:"-" elastic:"_matched_queries"`
+	Comments       []hitDecodeComment  `json:"-" elastic:"_inner_hits=comments"`
+	User           string              `json:"user"`
+	Message        string              `json:"message"`
+	Retweets       int                 `json:"retweets"`
+	Tags           []string            `json:"tags"`
+}
+
+const hitDecodeResponse = `{
+	"took": 3,
+	"hits": {
+		"total": 3,
+		"max_score": 1.5,
+		"hits": [
+			{
+				"_index": "twitter", "_type": "tweet", "_id": "1", "_version": 2, "_score": 1.5,
+				"sort": ["olivere", 1],
+				"highlight": {"message": ["Welcome to <em>Golang</em>"]},
+				"matched_queries": ["golang"],
+				"_source": {"user": "olivere", "message": "Welcome to Golang"},
+				"fields": {"retweets": [108], "tags": ["go"]},
+				"inner_hits": {
+					"comments": {"hits": {"total": 1, "hits": [
+						{"_index": "twitter", "_type": "comment", "_id": "c1", "_score": 0.5, "_source": {"user": "sandrae"}}
+					]}}
+				}
+			},
+			{"_index": "twitter", "_type": "tweet", "_id": "2", "_source": {"user": 42}},
+			{"_index": "twitter", "_type": "tweet", "_id": "3", "_source": {"user": "sandrae", "message": "Cycling is fun."}}
+		]
+	},
+	"aggregations": {
+		"users": {"buckets": [{"key": "olivere", "doc_count": 1, "latest": {"hits": {"total": 1, "hits": [
+			{"_index": "twitter", "_type": "tweet", "_id": "1", "_source": {"user": "olivere", "message": "Welcome to Golang"}}
+		]}}}]}
+	}
+}`
+
+func TestSearchResultDecode(t *testing.T) {
+	var res SearchResult
+	if err := json.Unmarshal([]byte(hitDecodeResponse), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	var tweets []hitDecodeTweet
+	err := res.Decode(&tweets)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	errs, ok := err.(DecodeErrors)
+	if !ok {
+		t.Fatalf("expected DecodeErrors; got: %T", err)
+	}
+	if got, want := len(errs), 1; got != want {
+		t.Fatalf("expected %d errors; got %d", want, got)
+	}
+	if got, want := errs[0].Id, "2"; got != want {
+		t.Errorf("expected error for hit %q; got %q", want, got)
+	}
+
+	if got, want := len(tweets), 2; got != want {
+		t.Fatalf("expected %d tweets; got %d", want, got)
+	}
+	score := 0.5
+	expected := hitDecodeTweet{
+		Id:             "1",
+		Index:          "twitter",
+		Type:           "tweet",
+		Version:        2,
+		Score:          1.5,
+		Sort:           []interface{}{"olivere", float64(1)},
+		Highlight:      map[string][]string{"message": {"Welcome to <em>Golang</em>"}},
+		MatchedQueries: []string{"golang"},
+		Comments:       []hitDecodeComment{{Id: "c1", Score: &score, User: "sandrae"}},
+		User:           "olivere",
+		Message:        "Welcome to Golang",
+		Retweets:       108,
+		Tags:           []string{"go"},
+	}
+	if !reflect.DeepEqual(tweets[0], expected) {
+		t.Errorf("expected\n%+v\n,got:\n%+v", expected, tweets[0])
+	}
+	if got, want := tweets[1].Id, "3"; got != want {
+		t.Errorf("expected Id = %q; got %q", want, got)
+	}
+}
+
+func TestSearchResultDecodeValues(t *testing.T) {
+	var res SearchResult
+	if err := json.Unmarshal([]byte(hitDecodeResponse), &res); err != nil {
+		t.Fatal(err)
+	}
+	res.Hits.Hits = append(res.Hits.Hits[:1], res.Hits.Hits[2:]...)
+
+	// Pointers
+	var tweets []*hitDecodeTweet
+	if err := res.Decode(&tweets); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(tweets), 2; got != want {
+		t.Fatalf("expected %d tweets; got %d", want, got)
+	}
+	if got, want := tweets[0].Id, "1"; got != want {
+		t.Errorf("expected Id = %q; got %q", want, got)
+	}
+
+	// Maps
+	var docs []map[string]interface{}
+	if err := res.Decode(&docs); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(docs), 2; got != want {
+		t.Fatalf("expected %d documents; got %d", want, got)
+	}
+	if got, want := docs[0]["user"], "olivere"; got != want {
+		t.Errorf("expected user = %v; got %v", want, got)
+	}
+	if got, want := docs[0]["tags"], []interface{}{"go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected tags = %v; got %v", want, got)
+	}
+
+	// Without metadata and fields
+	tweets = nil
+	if err := NewHitDecoder().Metadata(false).Fields(false).DecodeHits(res.Hits, &tweets); err != nil {
+		t.Fatal(err)
+	}
+	if got := tweets[0].Id; got != "" {
+		t.Errorf("expected no Id; got %q", got)
+	}
+	if got := tweets[0].Retweets; got != 0 {
+		t.Errorf("expected no Retweets; got %d", got)
+	}
+
+	// Single hit
+	var tweet hitDecodeTweet
+	if err := res.Hits.Hits[1].Decode(&tweet); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tweet.Message, "Cycling is fun."; got != want {
+		t.Errorf("expected Message = %q; got %q", want, got)
+	}
+}
+
+func TestSearchResultDecodeInnerAndTopHits(t *testing.T) {
+	var res SearchResult
+	if err := json.Unmarshal([]byte(hitDecodeResponse), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	var comments []hitDecodeComment
+	if err := res.Hits.Hits[0].InnerHits["comments"].Decode(&comments); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(comments), 1; got != want {
+		t.Fatalf("expected %d comments; got %d", want, got)
+	}
+	if got, want := comments[0].Id, "c1"; got != want {
+		t.Errorf("expected Id = %q; got %q", want, got)
+	}
+
+	users, found := res.Aggregations.Terms("users")
+	if !found {
+		t.Fatal("expected users aggregation")
+	}
+	latest, found := users.Buckets[0].TopHits("latest")
+	if !found {
+		t.Fatal("expected latest aggregation")
+	}
+	var tweets []hitDecodeTweet
+	if err := latest.Decode(&tweets); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(tweets), 1; got != want {
+		t.Fatalf("expected %d tweets; got %d", want, got)
+	}
+	if got, want := tweets[0].User, "olivere"; got != want {
+		t.Errorf("expected User = %q; got %q", want, got)
+	}
+}
+
+func TestHitDecoderErrors(t *testing.T) {
+	hits := &SearchHits{}
+
+	var notSlice hitDecodeTweet
+	if err := hits.Decode(&notSlice); err == nil {
+		t.Errorf("expected error for non-slice")
+	}
+	var tweets []hitDecodeTweet
+	if err := hits.Decode(tweets); err == nil {
+		t.Errorf("expected error for non-pointer")
+	}
+
+	type badScore struct {
+		Score string `elastic:"_score"`
+	}
+	var bad []badScore
+	err := hits.Decode(&bad)
+	if err == nil {
+		t.Fatal("expected error for unsupported type")
+	}
+	expected := "elastic: field badScore.Score tagged with _score has unsupported type string"
+	if got := err.Error(); got != expected {
+		t.Errorf("expected %q; got %q", expected, got)
+	}
+}
@@ -0,0 +1,618 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rules reported by Linter. Use them with Linter.Disable and
+// Linter.Severity.
+const (
+	// LintRuleEmptyBool reports bool queries and filters without any clause.
+	// Elasticsearch accepts them and matches all documents.
+	LintRuleEmptyBool = "empty_bool"
+	// LintRuleRangeWithoutBounds reports range queries and filters without
+	// a lower or upper bound.
+	LintRuleRangeWithoutBounds = "range_without_bounds"
+	// LintRuleEmptyTerms reports terms queries and filters without terms.
+	LintRuleEmptyTerms = "empty_terms"
+	// LintRuleMissingField reports aggregations without a field or script.
+	LintRuleMissingField = "missing_field"
+	// LintRuleMissingInterval reports histogram and date histogram
+	// aggregations without an interval.
+	LintRuleMissingInterval = "missing_interval"
+	// LintRuleLeadingWildcard reports wildcard and regexp queries that
+	// start with a wildcard and therefore need to scan all terms.
+	LintRuleLeadingWildcard = "leading_wildcard"
+	// LintRuleUnboundedTermsSize reports terms aggregations with size 0,
+	// i.e. that return all terms of a field.
+	LintRuleUnboundedTermsSize = "unbounded_terms_size"
+	// LintRuleDeepPaging reports requests where from + size exceeds
+	// the result window (see Linter.MaxResultWindow).
+	LintRuleDeepPaging = "deep_paging"
+)
+
+// LintSeverity is the severity of a LintIssue.
+type LintSeverity int
+
+const (
+	// LintSeverityWarning marks requests that are valid but probably
+	// slow or not what the caller intended.
+	LintSeverityWarning LintSeverity = iota
+	// LintSeverityError marks requests that are invalid or almost
+	// certainly a bug in the code that built them.
+	LintSeverityError
+)
+
+// String returns "warning" or "error".
+func (s LintSeverity) String() string {
+	if s == LintSeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+var lintDefaultSeverities = map[string]LintSeverity{
+	LintRuleRangeWithoutBounds: LintSeverityError,
+	LintRuleEmptyTerms:         LintSeverityError,
+	LintRuleMissingField:       LintSeverityError,
+	LintRuleMissingInterval:    LintSeverityError,
+	LintRuleEmptyBool:          LintSeverityWarning,
+	LintRuleLeadingWildcard:    LintSeverityWarning,
+	LintRuleUnboundedTermsSize: LintSeverityWarning,
+	LintRuleDeepPaging:         LintSeverityWarning,
+}
+
+// LintIssue is a single problem found by Linter.
+type LintIssue struct {
+	Severity LintSeverity
+	Rule     string // e.g. "empty_bool"
+	Path     string // location in the request, e.g. "query.bool.must[1].wildcard.user"
+	Message  string
+}
+
+// String returns a human readable representation of the issue.
+func (i LintIssue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("%v: %s (%s)", i.Severity, i.Message, i.Rule)
+	}
+	return fmt.Sprintf("%v: %s: %s (%s)", i.Severity, i.Path, i.Message, i.Rule)
+}
+
+// LintIssues is a list of issues found by Linter.
+type LintIssues []LintIssue
+
+// Errors returns the issues with severity LintSeverityError.
+func (issues LintIssues) Errors() LintIssues {
+	return issues.filter(LintSeverityError)
+}
+
+// Warnings returns the issues with severity LintSeverityWarning.
+func (issues LintIssues) Warnings() LintIssues {
+	return issues.filter(LintSeverityWarning)
+}
+
+func (issues LintIssues) filter(severity LintSeverity) LintIssues {
+	var list LintIssues
+	for _, issue := range issues {
+		if issue.Severity == severity {
+			list = append(list, issue)
+		}
+	}
+	return list
+}
+
+// LintError is returned from Linter.Validate and SearchService.Validate
+// if the request did not pass the linter.
+type LintError struct {
+	Issues LintIssues
+}
+
+// Error returns a string representation of the error.
+func (e *LintError) Error() string {
+	if len(e.Issues) == 0 {
+		return "elastic: search request failed validation"
+	}
+	msg := fmt.Sprintf("elastic: search request failed validation: %v", e.Issues[0])
+	if n := len(e.Issues) - 1; n > 0 {
+		msg += fmt.Sprintf(" (and %d more)", n)
+	}
+	return msg
+}
+
+// Linter checks search requests on the client side, before they are
+// sent to Elasticsearch. It reports structural errors, e.g. range
+// queries without bounds or terms queries without terms, as well as
+// warnings for requests that are valid but probably unintended or
+// expensive, e.g. empty bool queries, leading wildcards or deep paging.
+//
+// Linter works on the JSON representation of the request, so it also
+// checks requests built from raw JSON or with RawStringQuery.
+// Use it with SearchService.Linter to make SearchService.Validate fail
+// for bad requests.
+type Linter struct {
+	severities      map[string]LintSeverity
+	disabled        map[string]bool
+	maxResultWindow int
+	strict          bool
+}
+
+// NewLinter creates a new Linter with all rules enabled.
+func NewLinter() *Linter {
+	l := &Linter{
+		severities:      make(map[string]LintSeverity),
+		disabled:        make(map[string]bool),
+		maxResultWindow: 10000,
+	}
+	for rule, severity := range lintDefaultSeverities {
+		l.severities[rule] = severity
+	}
+	return l
+}
+
+// Disable turns off the given rules.
+func (l *Linter) Disable(rules ...string) *Linter {
+	for _, rule := range rules {
+		l.disabled[rule] = true
+	}
+	return l
+}
+
+// Enable turns the given rules back on.
+func (l *Linter) Enable(rules ...string) *Linter {
+	for _, rule := range rules {
+		delete(l.disabled, rule)
+	}
+	return l
+}
+
+// Severity changes the severity reported for rule, e.g. to make
+// leading wildcards fail validation.
+func (l *Linter) Severity(rule string, severity LintSeverity) *Linter {
+	l.severities[rule] = severity
+	return l
+}
+
+// MaxResultWindow sets the maximum of from + size before a
+// deep_paging warning is reported. It defaults to 10000.
+func (l *Linter) MaxResultWindow(maxResultWindow int) *Linter {
+	l.maxResultWindow = maxResultWindow
+	return l
+}
+
+// Strict makes Validate fail on warnings, too.
+func (l *Linter) Strict(strict bool) *Linter {
+	l.strict = strict
+	return l
+}
+
+// Lint checks the body of a search request. The body may be
+// a *SearchSource, a JSON string, []byte or json.RawMessage,
+// or any value that serializes to a search request body.
+func (l *Linter) Lint(body interface{}) (LintIssues, error) {
+	v, err := decodeDSL(body)
+	if err != nil {
+		return nil, err
+	}
+	w := &lintWalker{l: l}
+	w.searchSource("", v)
+	return w.issues, nil
+}
+
+// LintQuery checks a query.
+func (l *Linter) LintQuery(query Query) (LintIssues, error) {
+	v, err := decodeDSL(query)
+	if err != nil {
+		return nil, err
+	}
+	w := &lintWalker{l: l}
+	w.query("", v)
+	return w.issues, nil
+}
+
+// LintFilter checks a filter.
+func (l *Linter) LintFilter(filter Filter) (LintIssues, error) {
+	v, err := decodeDSL(filter)
+	if err != nil {
+		return nil, err
+	}
+	w := &lintWalker{l: l}
+	w.filter("", v)
+	return w.issues, nil
+}
+
+// LintAggregation checks an aggregation and its sub-aggregations.
+func (l *Linter) LintAggregation(aggregation Aggregation) (LintIssues, error) {
+	v, err := decodeDSL(aggregation)
+	if err != nil {
+		return nil, err
+	}
+	w := &lintWalker{l: l}
+	w.aggregation("", v)
+	return w.issues, nil
+}
+
+// Validate checks the body of a search request like Lint, and returns
+// a *LintError if it finds errors (or warnings, in strict mode).
+func (l *Linter) Validate(body interface{}) error {
+	issues, err := l.Lint(body)
+	if err != nil {
+		return err
+	}
+	failed := issues.Errors()
+	if l.strict {
+		failed = issues
+	}
+	if len(failed) > 0 {
+		return &LintError{Issues: failed}
+	}
+	return nil
+}
+
+// -- Walker --
+
+// lintWalker walks the generic JSON representation of a request
+// (see decodeDSL) and collects issues.
+type lintWalker struct {
+	l      *Linter
+	issues LintIssues
+}
+
+func (w *lintWalker) report(path, rule, format string, args ...interface{}) {
+	if w.l.disabled[rule] {
+		return
+	}
+	severity, found := w.l.severities[rule]
+	if !found {
+		severity = LintSeverityWarning
+	}
+	w.issues = append(w.issues, LintIssue{
+		Severity: severity,
+		Rule:     rule,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// each calls fn for every element of v if v is an array,
+// or for v otherwise.
+func (w *lintWalker) each(path string, v interface{}, fn func(path string, v interface{})) {
+	list, ok := v.([]interface{})
+	if !ok {
+		fn(path, v)
+		return
+	}
+	for i, item := range list {
+		fn(fmt.Sprintf("%s[%d]", path, i), item)
+	}
+}
+
+// children calls fn for the given keys of v that are set.
+func (w *lintWalker) children(path string, v interface{}, fn func(path string, v interface{}), keys ...string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, key := range keys {
+		if child, found := m[key]; found && child != nil {
+			w.each(joinDSLPath(path, key), child, fn)
+		}
+	}
+}
+
+func (w *lintWalker) searchSource(path string, v interface{}) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	w.children(path, m, w.query, "query")
+	w.children(path, m, w.filter, "post_filter", "filter")
+	for _, key := range []string{"aggregations", "aggs"} {
+		if aggs, found := m[key]; found {
+			w.aggregations(joinDSLPath(path, key), aggs)
+		}
+	}
+
+	from, size := int64(0), int64(10)
+	if v, found := m["from"]; found {
+		from, _ = dslInt64(v)
+	}
+	if v, found := m["size"]; found {
+		size, _ = dslInt64(v)
+	}
+	if w.l.maxResultWindow > 0 && from+size > int64(w.l.maxResultWindow) {
+		w.report(path, LintRuleDeepPaging, "from + size is %d and exceeds the result window of %d; use scrolling instead", from+size, w.l.maxResultWindow)
+	}
+}
+
+func (w *lintWalker) query(path string, v interface{}) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, name := range sortedDSLKeys(m) {
+		body := m[name]
+		p := joinDSLPath(path, name)
+		switch name {
+		case "bool":
+			w.bool(p, body, w.query)
+		case "filtered", "constant_score", "nested", "has_child", "has_parent", "top_children":
+			w.children(p, body, w.query, "query")
+			w.children(p, body, w.filter, "filter")
+		case "boosting":
+			w.children(p, body, w.query, "positive", "negative")
+		case "dis_max":
+			w.children(p, body, w.query, "queries")
+		case "indices":
+			w.children(p, body, w.query, "query", "no_match_query")
+		case "custom_score", "custom_boost_factor":
+			w.children(p, body, w.query, "query")
+		case "custom_filters_score":
+			w.children(p, body, w.query, "query")
+			w.children(p, body, func(path string, v interface{}) {
+				w.children(path, v, w.filter, "filter")
+			}, "filters")
+		case "function_score":
+			w.children(p, body, w.query, "query")
+			w.children(p, body, w.filter, "filter")
+			w.children(p, body, func(path string, v interface{}) {
+				w.children(path, v, w.filter, "filter")
+			}, "functions")
+		case "range":
+			w.rangeClause(p, body)
+		case "terms", "in":
+			w.terms(p, body)
+		case "wildcard":
+			w.leadingWildcard(p, body, []string{"wildcard", "value"}, func(s string) bool {
+				return strings.HasPrefix(s, "*") || strings.HasPrefix(s, "?")
+			})
+		case "regexp":
+			w.leadingWildcard(p, body, []string{"value"}, func(s string) bool {
+				return strings.HasPrefix(s, ".*") || strings.HasPrefix(s, ".+")
+			})
+		}
+	}
+}
+
+func (w *lintWalker) filter(path string, v interface{}) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, name := range sortedDSLKeys(m) {
+		body := m[name]
+		p := joinDSLPath(path, name)
+		switch name {
+		case "bool":
+			w.bool(p, body, w.filter)
+		case "and", "or":
+			if _, isArray := body.([]interface{}); isArray {
+				w.each(p, body, w.filter)
+			} else {
+				w.children(p, body, w.filter, "filters")
+			}
+		case "not":
+			if params, _ := body.(map[string]interface{}); params != nil && params["filter"] != nil {
+				w.children(p, body, w.filter, "filter")
+			} else {
+				w.filter(p, body)
+			}
+		case "query":
+			w.query(p, body)
+		case "fquery":
+			w.children(p, body, w.query, "query")
+		case "nested", "has_child", "has_parent":
+			w.children(p, body, w.query, "query")
+			w.children(p, body, w.filter, "filter")
+		case "range":
+			w.rangeClause(p, body)
+		case "terms", "in":
+			w.terms(p, body)
+		case "regexp":
+			w.leadingWildcard(p, body, []string{"value"}, func(s string) bool {
+				return strings.HasPrefix(s, ".*") || strings.HasPrefix(s, ".+")
+			})
+		}
+	}
+}
+
+// bool checks a bool query or filter. clause is used to check its clauses.
+func (w *lintWalker) bool(path string, v interface{}, clause func(path string, v interface{})) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	n := 0
+	for _, key := range []string{"must", "must_not", "should"} {
+		switch child := m[key].(type) {
+		case nil:
+		case []interface{}:
+			n += len(child)
+		default:
+			n++
+		}
+	}
+	if n == 0 {
+		w.report(path, LintRuleEmptyBool, "bool has no must, must_not or should clauses")
+		return
+	}
+	w.children(path, m, clause, "must", "must_not", "should")
+}
+
+// lintClauseParams are parameters of term-level clauses that are
+// specified next to the field name, e.g. {"terms":{"user":[...],"_name":"q"}}.
+var lintClauseParams = map[string]bool{
+	"boost":                true,
+	"disable_coord":        true,
+	"execution":            true,
+	"minimum_should_match": true,
+	"minimum_match":        true,
+}
+
+// clauseFields returns the field names of a term-level clause.
+func (w *lintWalker) clauseFields(v interface{}) (map[string]interface{}, []string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	var fields []string
+	for _, key := range sortedDSLKeys(m) {
+		if !strings.HasPrefix(key, "_") && !lintClauseParams[key] {
+			fields = append(fields, key)
+		}
+	}
+	return m, fields
+}
+
+func (w *lintWalker) rangeClause(path string, v interface{}) {
+	m, fields := w.clauseFields(v)
+	for _, field := range fields {
+		params, ok := m[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		bounded := false
+		for _, key := range []string{"from", "to", "gt", "gte", "lt", "lte"} {
+			if params[key] != nil {
+				bounded = true
+			}
+		}
+		if !bounded {
+			w.report(joinDSLPath(path, field), LintRuleRangeWithoutBounds, "range on %q has neither a lower nor an upper bound", field)
+		}
+	}
+}
+
+func (w *lintWalker) terms(path string, v interface{}) {
+	m, fields := w.clauseFields(v)
+	for _, field := range fields {
+		// A terms lookup is an object, so only arrays are checked
+		if values, ok := m[field].([]interface{}); ok && len(values) == 0 {
+			w.report(joinDSLPath(path, field), LintRuleEmptyTerms, "terms on %q has no terms", field)
+		}
+	}
+}
+
+// leadingWildcard reports the pattern of a wildcard or regexp clause
+// if leading returns true. The pattern is either given directly, e.g.
+// {"user":"*y"}, or as one of keys, e.g. {"user":{"value":"*y"}}.
+func (w *lintWalker) leadingWildcard(path string, v interface{}, keys []string, leading func(string) bool) {
+	m, fields := w.clauseFields(v)
+	for _, field := range fields {
+		pattern, ok := m[field].(string)
+		if params, isObject := m[field].(map[string]interface{}); isObject {
+			for _, key := range keys {
+				if pattern, ok = params[key].(string); ok {
+					break
+				}
+			}
+		}
+		if ok && leading(pattern) {
+			w.report(joinDSLPath(path, field), LintRuleLeadingWildcard, "pattern %q on %q starts with a wildcard and has to scan all terms", pattern, field)
+		}
+	}
+}
+
+func (w *lintWalker) aggregations(path string, v interface{}) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, name := range sortedDSLKeys(m) {
+		w.aggregation(joinDSLPath(path, name), m[name])
+	}
+}
+
+// lintValuesSourceAggregations are aggregations that need a field or
+// script to operate on.
+var lintValuesSourceAggregations = map[string]bool{
+	"avg":               true,
+	"cardinality":       true,
+	"date_histogram":    true,
+	"date_range":        true,
+	"extended_stats":    true,
+	"geo_bounds":        true,
+	"geo_distance":      true,
+	"geohash_grid":      true,
+	"histogram":         true,
+	"max":               true,
+	"min":               true,
+	"missing":           true,
+	"percentile_ranks":  true,
+	"percentiles":       true,
+	"range":             true,
+	"significant_terms": true,
+	"stats":             true,
+	"sum":               true,
+	"terms":             true,
+	"value_count":       true,
+}
+
+func (w *lintWalker) aggregation(path string, v interface{}) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, typ := range sortedDSLKeys(m) {
+		body := m[typ]
+		p := joinDSLPath(path, typ)
+		switch typ {
+		case "aggregations", "aggs":
+			w.aggregations(p, body)
+			continue
+		case "meta":
+			continue
+		case "filter":
+			w.filter(p, body)
+		case "filters":
+			if params, ok := body.(map[string]interface{}); ok {
+				if filters, ok := params["filters"].(map[string]interface{}); ok {
+					for _, name := range sortedDSLKeys(filters) {
+						w.filter(joinDSLPath(p, "filters."+name), filters[name])
+					}
+				} else {
+					w.children(p, body, w.filter, "filters")
+				}
+			}
+		case "significant_terms":
+			w.children(p, body, w.filter, "background_filter")
+		}
+
+		params, _ := body.(map[string]interface{})
+		if params == nil {
+			continue
+		}
+		if lintValuesSourceAggregations[typ] && params["field"] == nil && params["script"] == nil && params["script_file"] == nil && params["script_id"] == nil {
+			w.report(p, LintRuleMissingField, "%s aggregation has neither a field nor a script", typ)
+		}
+		if (typ == "histogram" || typ == "date_histogram") && lintIsZero(params["interval"]) {
+			w.report(p, LintRuleMissingInterval, "%s aggregation has no interval", typ)
+		}
+		if typ == "terms" || typ == "significant_terms" {
+			if size, found := params["size"]; found {
+				if n, err := dslInt64(size); err == nil && n == 0 {
+					w.report(p, LintRuleUnboundedTermsSize, "%s aggregation with size 0 returns all terms of the field", typ)
+				}
+			}
+		}
+	}
+}
+
+// lintIsZero returns true if v is missing, null, an empty string or 0.
+func lintIsZero(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	}
+	return false
+}
@@ -0,0 +1,253 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// lintIssueStrings returns the issues as "severity path rule" strings.
+func lintIssueStrings(issues LintIssues) []string {
+	var list []string
+	for _, issue := range issues {
+		list = append(list, issue.Severity.String()+" "+issue.Path+" "+issue.Rule)
+	}
+	return list
+}
+
+func TestLinterSearchSource(t *testing.T) {
+	tests := []struct {
+		Source   *SearchSource
+		Expected []string
+	}{
+		// #0
+		{
+			NewSearchSource().Query(NewTermQuery("user", "olivere")),
+			nil,
+		},
+		// #1
+		{
+			NewSearchSource().Query(NewBoolQuery()),
+			[]string{"warning query.bool empty_bool"},
+		},
+		// #2
+		{
+			NewSearchSource().Query(NewBoolQuery().
+				Must(NewRangeQuery("age")).
+				Should(NewWildcardQuery("user", "*chy"), NewWildcardQuery("user", "ki*"))),
+			[]string{
+				"error query.bool.must.range.age range_without_bounds",
+				"warning query.bool.should[0].wildcard.user leading_wildcard",
+			},
+		},
+		// #3
+		{
+			NewSearchSource().Query(NewFilteredQuery(NewMatchAllQuery()).
+				Filter(NewAndFilter(NewBoolFilter(), NewTermsFilter("user"), NewRangeFilter("age").Gte(18)))),
+			[]string{
+				"warning query.filtered.filter.and.filters[0].bool empty_bool",
+				"error query.filtered.filter.and.filters[1].terms.user empty_terms",
+			},
+		},
+		// #4
+		{
+			NewSearchSource().
+				Query(NewNestedQuery("comments").Query(NewRegexpQuery("comments.text", ".*error"))).
+				PostFilter(NewNotFilter(NewRangeFilter("age").FilterName("adults"))),
+			[]string{
+				"warning query.nested.query.regexp.comments.text leading_wildcard",
+				"error post_filter.not.filter.range.age range_without_bounds",
+			},
+		},
+		// #5
+		{
+			NewSearchSource().From(9990).Size(20),
+			[]string{"warning  deep_paging"},
+		},
+		// #6
+		{
+			NewSearchSource().
+				Aggregation("users", NewTermsAggregation().Field("user").Size(0).
+					SubAggregation("histogram", NewDateHistogramAggregation().Field("created")).
+					SubAggregation("avg", NewAvgAggregation())).
+				Aggregation("errors", NewFilterAggregation().Filter(NewBoolFilter())),
+			[]string{
+				"warning aggregations.errors.filter.bool empty_bool",
+				"error aggregations.users.aggregations.avg.avg missing_field",
+				"error aggregations.users.aggregations.histogram.date_histogram missing_interval",
+				"warning aggregations.users.terms unbounded_terms_size",
+			},
+		},
+		// #7
+		{
+			NewSearchSource().Query(NewFunctionScoreQuery().
+				Query(NewTermsQuery("tags")).
+				Add(NewRangeFilter("age"), NewWeightFactorFunction(2))),
+			[]string{
+				"error query.function_score.query.terms.tags empty_terms",
+				"error query.function_score.functions[0].filter.range.age range_without_bounds",
+			},
+		},
+	}
+	for i, test := range tests {
+		issues, err := NewLinter().Lint(test.Source)
+		if err != nil {
+			t.Fatalf("#%d: expected no error; got: %v", i, err)
+		}
+		got := lintIssueStrings(issues)
+		if strings.Join(got, "\n") != strings.Join(test.Expected, "\n") {
+			t.Errorf("#%d: expected\n%s\n,got:\n%s", i, strings.Join(test.Expected, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestLinterRawSource(t *testing.T) {
+	body := `{"query":{"bool":{"must":[],"should":{"wildcard":{"host":{"wildcard":"?b*"}}}}},"size":0}`
+	issues, err := NewLinter().Lint(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(lintIssueStrings(issues), "\n")
+	expected := "warning query.bool.should.wildcard.host leading_wildcard"
+	if got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+
+	if _, err := NewLinter().Lint(`{"query":`); err == nil {
+		t.Errorf("expected error for invalid JSON")
+	}
+}
+
+func TestLinterConfiguration(t *testing.T) {
+	source := NewSearchSource().
+		Query(NewBoolQuery().Must(NewWildcardQuery("user", "*chy"), NewRangeQuery("age"))).
+		From(100).Size(100)
+
+	// Defaults
+	issues, err := NewLinter().Lint(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(issues.Errors()), 1; got != want {
+		t.Errorf("expected %d errors; got %d", want, got)
+	}
+	if got, want := len(issues.Warnings()), 1; got != want {
+		t.Errorf("expected %d warnings; got %d", want, got)
+	}
+
+	// Disable rules, change severities and thresholds
+	linter := NewLinter().
+		Disable(LintRuleRangeWithoutBounds).
+		Severity(LintRuleLeadingWildcard, LintSeverityError).
+		MaxResultWindow(100)
+	issues, err = linter.Lint(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(lintIssueStrings(issues), "\n")
+	expected := "error query.bool.must[0].wildcard.user leading_wildcard\nwarning  deep_paging"
+	if got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+
+	// Re-enable rules
+	issues, err = linter.Enable(LintRuleRangeWithoutBounds).Lint(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(issues), 3; got != want {
+		t.Errorf("expected %d issues; got %d", want, got)
+	}
+}
+
+func TestLinterValidate(t *testing.T) {
+	warnOnly := NewSearchSource().Query(NewWildcardQuery("user", "*chy"))
+
+	if err := NewLinter().Validate(warnOnly); err != nil {
+		t.Errorf("expected no error for warnings; got: %v", err)
+	}
+	err := NewLinter().Strict(true).Validate(warnOnly)
+	if err == nil {
+		t.Fatal("expected error in strict mode")
+	}
+	lerr, ok := err.(*LintError)
+	if !ok {
+		t.Fatalf("expected *LintError; got: %T", err)
+	}
+	if got, want := len(lerr.Issues), 1; got != want {
+		t.Errorf("expected %d issues; got %d", want, got)
+	}
+
+	if err := NewLinter().Validate(NewSearchSource().Query(NewBoolQuery())); err != nil {
+		t.Errorf("expected no error for empty bool query; got: %v", err)
+	}
+
+	err = NewLinter().Validate(NewSearchSource().Query(NewBoolQuery().Must(NewBoolQuery(), NewRangeQuery("age"), NewTermsQuery("tags"))))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	expected := `elastic: search request failed validation: error: query.bool.must[1].range.age: range on "age" has neither a lower nor an upper bound (range_without_bounds) (and 1 more)`
+	if got := err.Error(); got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+}
+
+func TestLinterQueryFilterAggregation(t *testing.T) {
+	issues, err := NewLinter().LintQuery(NewBoolQuery().Must(NewRangeQuery("age")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(lintIssueStrings(issues), "\n"), "error bool.must.range.age range_without_bounds"; got != want {
+		t.Errorf("expected %q; got %q", want, got)
+	}
+
+	issues, err = NewLinter().LintFilter(NewOrFilter(NewTermsFilter("user")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(lintIssueStrings(issues), "\n"), "error or.filters[0].terms.user empty_terms"; got != want {
+		t.Errorf("expected %q; got %q", want, got)
+	}
+
+	issues, err = NewLinter().LintAggregation(NewHistogramAggregation().Field("price"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(lintIssueStrings(issues), "\n"), "error histogram missing_interval"; got != want {
+		t.Errorf("expected %q; got %q", want, got)
+	}
+}
+
+func TestSearchServiceValidateWithLinter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected no request; got %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	client, err := NewSimpleClient(SetURL(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a linter, nothing is checked
+	if err := client.Search().Query(NewRangeQuery("age")).Validate(); err != nil {
+		t.Errorf("expected no error; got: %v", err)
+	}
+
+	_, err = client.Search().Index(testIndexName).Query(NewRangeQuery("age")).Linter(NewLinter()).Do()
+	if _, ok := err.(*LintError); !ok {
+		t.Errorf("expected *LintError; got: %v", err)
+	}
+
+	// Raw sources are checked, too
+	_, err = client.Search().Index(testIndexName).Source(`{"query":{"range":{"age":{}}}}`).Linter(NewLinter()).Do()
+	if _, ok := err.(*LintError); !ok {
+		t.Errorf("expected *LintError; got: %v", err)
+	}
+}
@@ -0,0 +1,1071 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QueryParserFunc parses the body of a query clause, e.g. the object
+// following "term" in {"term":{"user":"olivere"}}, into a Query.
+type QueryParserFunc func(p *DSLParser, body interface{}) (Query, error)
+
+// FilterParserFunc parses the body of a filter clause into a Filter.
+type FilterParserFunc func(p *DSLParser, body interface{}) (Filter, error)
+
+// AggregationParserFunc parses the body of an aggregation, e.g. the object
+// following "terms" in {"terms":{"field":"user"}}, into an Aggregation.
+// The sub-aggregations and meta data of the aggregation are parsed
+// already; subAggs is never nil.
+type AggregationParserFunc func(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error)
+
+// DSLParser parses the JSON representation of queries, filters, and
+// aggregations back into the builders of this package, e.g. to modify
+// a saved search before running it again:
+//
+//	src, err := elastic.ParseSearchSource(savedSearch)
+//	...
+//	res, err := client.Search().Index("twitter").SearchSource(src.Size(50)).Do()
+//
+// Clauses are looked up in a registry by name. NewDSLParser registers
+// parsers for all builders of this package; use RegisterQuery,
+// RegisterFilter, and RegisterAggregation to add or replace parsers.
+// Unknown clauses and parameters result in a *DSLError.
+//
+// A DSLParser is safe for concurrent use once all parsers are registered.
+type DSLParser struct {
+	queries map[string]QueryParserFunc
+	filters map[string]FilterParserFunc
+	aggs    map[string]AggregationParserFunc
+}
+
+// defaultDSLParser is used by ParseQuery, ParseFilter etc.
+var defaultDSLParser = NewDSLParser()
+
+// NewDSLParser creates a new DSLParser with parsers for all queries,
+// filters, and aggregations of this package.
+func NewDSLParser() *DSLParser {
+	p := &DSLParser{
+		queries: make(map[string]QueryParserFunc),
+		filters: make(map[string]FilterParserFunc),
+		aggs:    make(map[string]AggregationParserFunc),
+	}
+	for name, fn := range dslQueryParsers {
+		p.queries[name] = fn
+	}
+	for name, fn := range dslFilterParsers {
+		p.filters[name] = fn
+	}
+	for name, fn := range dslAggregationParsers {
+		p.aggs[name] = fn
+	}
+	return p
+}
+
+// RegisterQuery registers the parser for the query with the given name,
+// e.g. "match".
+func (p *DSLParser) RegisterQuery(name string, fn QueryParserFunc) *DSLParser {
+	p.queries[name] = fn
+	return p
+}
+
+// RegisterFilter registers the parser for the filter with the given name,
+// e.g. "term".
+func (p *DSLParser) RegisterFilter(name string, fn FilterParserFunc) *DSLParser {
+	p.filters[name] = fn
+	return p
+}
+
+// RegisterAggregation registers the parser for the aggregation of the
+// given type, e.g. "terms".
+func (p *DSLParser) RegisterAggregation(name string, fn AggregationParserFunc) *DSLParser {
+	p.aggs[name] = fn
+	return p
+}
+
+// ParseQuery parses a query with the default parser (see DSLParser.ParseQuery).
+func ParseQuery(source interface{}) (Query, error) {
+	return defaultDSLParser.ParseQuery(source)
+}
+
+// ParseFilter parses a filter with the default parser (see DSLParser.ParseFilter).
+func ParseFilter(source interface{}) (Filter, error) {
+	return defaultDSLParser.ParseFilter(source)
+}
+
+// ParseAggregation parses an aggregation with the default parser
+// (see DSLParser.ParseAggregation).
+func ParseAggregation(source interface{}) (Aggregation, error) {
+	return defaultDSLParser.ParseAggregation(source)
+}
+
+// ParseAggregations parses named aggregations with the default parser
+// (see DSLParser.ParseAggregations).
+func ParseAggregations(source interface{}) (map[string]Aggregation, error) {
+	return defaultDSLParser.ParseAggregations(source)
+}
+
+// ParseSearchSource parses a search request body with the default parser
+// (see DSLParser.ParseSearchSource).
+func ParseSearchSource(source interface{}) (*SearchSource, error) {
+	return defaultDSLParser.ParseSearchSource(source)
+}
+
+// ParseQuery parses a query, e.g. {"term":{"user":"olivere"}}.
+//
+// The source can be JSON as a string, []byte, or json.RawMessage,
+// a builder (anything with a Source method), or any other value
+// that serializes to JSON, e.g. a map[string]interface{}.
+func (p *DSLParser) ParseQuery(source interface{}) (Query, error) {
+	v, err := decodeDSL(source)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseQuery(v)
+}
+
+// ParseFilter parses a filter, e.g. {"term":{"user":"olivere"}}.
+// See ParseQuery for the supported types of source.
+func (p *DSLParser) ParseFilter(source interface{}) (Filter, error) {
+	v, err := decodeDSL(source)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseFilter(v)
+}
+
+// ParseAggregation parses a single aggregation, including its
+// sub-aggregations, e.g. {"terms":{"field":"user"},"aggs":{...}}.
+// See ParseQuery for the supported types of source.
+func (p *DSLParser) ParseAggregation(source interface{}) (Aggregation, error) {
+	v, err := decodeDSL(source)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseAggregation(v)
+}
+
+// ParseAggregations parses an object of named aggregations, i.e. the
+// "aggregations" section of a search request.
+// See ParseQuery for the supported types of source.
+func (p *DSLParser) ParseAggregations(source interface{}) (map[string]Aggregation, error) {
+	v, err := decodeDSL(source)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseAggregations(v)
+}
+
+// ParseSearchSource parses a search request body. Facets, highlighting,
+// suggesters, rescoring, and partial fields are not supported and
+// result in an error. See ParseQuery for the supported types of source.
+func (p *DSLParser) ParseSearchSource(source interface{}) (*SearchSource, error) {
+	v, err := decodeDSL(source)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseSearchSource(v)
+}
+
+// -- Errors --
+
+// DSLError is returned from DSLParser if the source cannot be parsed.
+type DSLError struct {
+	Path string // location of the error, e.g. "bool.must[1].term"
+	Err  error
+}
+
+// Error returns a string representation of the error.
+func (e *DSLError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("elastic: invalid query DSL: %v", e.Err)
+	}
+	return fmt.Sprintf("elastic: invalid query DSL at %s: %v", e.Path, e.Err)
+}
+
+// wrapDSLError prefixes the path of err with path.
+func wrapDSLError(err error, path string) error {
+	if e, ok := err.(*DSLError); ok {
+		e.Path = joinDSLPath(path, e.Path)
+		return e
+	}
+	return &DSLError{Path: path, Err: err}
+}
+
+// joinDSLPath joins two parts of the location of an error.
+func joinDSLPath(parent, child string) string {
+	switch {
+	case parent == "":
+		return child
+	case child == "":
+		return parent
+	case strings.HasPrefix(child, "["):
+		return parent + child
+	default:
+		return parent + "." + child
+	}
+}
+
+// -- Decoding --
+
+// decodeDSL converts source into the generic representation used by the
+// parsers: map[string]interface{}, []interface{}, string, bool, nil,
+// int64 for integers, and float64 for all other numbers.
+func decodeDSL(source interface{}) (interface{}, error) {
+	data, err := marshalSource(source)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, &DSLError{Err: err}
+	}
+	return normalizeDSL(v), nil
+}
+
+// marshalSource returns the JSON representation of source, which may be
+// JSON text (string, []byte, or json.RawMessage), a builder with a Source
+// method, or any other value that can be serialized.
+func marshalSource(source interface{}) ([]byte, error) {
+	switch s := source.(type) {
+	case []byte:
+		return s, nil
+	case string:
+		return []byte(s), nil
+	case json.RawMessage:
+		return s, nil
+	case *json.RawMessage:
+		if s != nil {
+			return *s, nil
+		}
+		return nil, nil
+	case interface {
+		Source() interface{}
+	}:
+		return json.Marshal(s.Source())
+	}
+	return json.Marshal(source)
+}
+
+// normalizeDSL replaces json.Number values by int64 or float64. Numbers
+// that would change when serialized as float64, e.g. integers beyond the
+// range of int64, are kept as json.Number so they round-trip exactly.
+func normalizeDSL(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil && jsonNumbersEqual(v, json.Number(strconv.FormatFloat(f, 'g', -1, 64))) {
+			return f
+		}
+		return v
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalizeDSL(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeDSL(item)
+		}
+	}
+	return v
+}
+
+// dslTypeName returns the JSON type name of v for error messages.
+func dslTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int64, float64, json.Number:
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// dslClause returns the name and body of an object with a single key,
+// e.g. {"term":{...}}.
+func dslClause(v interface{}) (string, interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "", nil, &DSLError{Err: fmt.Errorf("expected an object; got %s", dslTypeName(v))}
+	}
+	if len(m) != 1 {
+		return "", nil, &DSLError{Err: fmt.Errorf("expected a single clause; got %v", sortedDSLKeys(m))}
+	}
+	for name, body := range m {
+		return name, body, nil
+	}
+	return "", nil, nil
+}
+
+func sortedDSLKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (p *DSLParser) parseQuery(v interface{}) (Query, error) {
+	name, body, err := dslClause(v)
+	if err != nil {
+		return nil, err
+	}
+	fn, found := p.queries[name]
+	if !found {
+		return nil, &DSLError{Path: name, Err: fmt.Errorf("unknown query %q", name)}
+	}
+	q, err := fn(p, body)
+	if err != nil {
+		return nil, wrapDSLError(err, name)
+	}
+	return q, nil
+}
+
+func (p *DSLParser) parseFilter(v interface{}) (Filter, error) {
+	name, body, err := dslClause(v)
+	if err != nil {
+		return nil, err
+	}
+	fn, found := p.filters[name]
+	if !found {
+		return nil, &DSLError{Path: name, Err: fmt.Errorf("unknown filter %q", name)}
+	}
+	f, err := fn(p, body)
+	if err != nil {
+		return nil, wrapDSLError(err, name)
+	}
+	return f, nil
+}
+
+func (p *DSLParser) parseAggregation(v interface{}) (Aggregation, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, &DSLError{Err: fmt.Errorf("expected an object; got %s", dslTypeName(v))}
+	}
+	var typ string
+	var body interface{}
+	subAggs := make(map[string]Aggregation)
+	var meta map[string]interface{}
+	for _, k := range sortedDSLKeys(m) {
+		switch k {
+		case "aggregations", "aggs":
+			aggs, err := p.parseAggregations(m[k])
+			if err != nil {
+				return nil, wrapDSLError(err, k)
+			}
+			for name, agg := range aggs {
+				subAggs[name] = agg
+			}
+		case "meta":
+			if meta, ok = m[k].(map[string]interface{}); !ok {
+				return nil, &DSLError{Path: k, Err: fmt.Errorf("expected an object; got %s", dslTypeName(m[k]))}
+			}
+		default:
+			if typ != "" {
+				return nil, &DSLError{Path: k, Err: fmt.Errorf("expected a single aggregation type; got %q and %q", typ, k)}
+			}
+			typ, body = k, m[k]
+		}
+	}
+	if typ == "" {
+		return nil, &DSLError{Err: errors.New("missing aggregation type")}
+	}
+	fn, found := p.aggs[typ]
+	if !found {
+		return nil, &DSLError{Path: typ, Err: fmt.Errorf("unknown aggregation %q", typ)}
+	}
+	a, err := fn(p, body, subAggs, meta)
+	if err != nil {
+		return nil, wrapDSLError(err, typ)
+	}
+	return a, nil
+}
+
+func (p *DSLParser) parseAggregations(v interface{}) (map[string]Aggregation, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, &DSLError{Err: fmt.Errorf("expected an object; got %s", dslTypeName(v))}
+	}
+	aggs := make(map[string]Aggregation)
+	for _, name := range sortedDSLKeys(m) {
+		a, err := p.parseAggregation(m[name])
+		if err != nil {
+			return nil, wrapDSLError(err, name)
+		}
+		aggs[name] = a
+	}
+	return aggs, nil
+}
+
+// -- Search source --
+
+func (p *DSLParser) parseSearchSource(v interface{}) (*SearchSource, error) {
+	s := NewSearchSource()
+	o := p.object(v)
+	o.decode("from", &s.from)
+	o.decode("size", &s.size)
+	o.decode("timeout", &s.timeout)
+	o.decode("query", &s.query)
+	o.decode("post_filter", &s.postFilter)
+	if s.postFilter == nil {
+		o.decode("filter", &s.postFilter)
+	}
+	o.decode("min_score", &s.minScore)
+	o.decode("version", &s.version)
+	o.decode("explain", &s.explain)
+	o.decode("_source", &s.fetchSourceContext)
+	if o.has("fields") {
+		s.fieldNames = make([]string, 0)
+		o.decode("fields", &s.fieldNames)
+	}
+	o.decode("fielddata_fields", &s.fieldDataFields)
+	if c := o.object("script_fields"); c != nil {
+		for _, name := range c.keys() {
+			sf := c.object(name)
+			var script, lang string
+			var params map[string]interface{}
+			sf.decode("script", &script)
+			sf.decode("lang", &lang)
+			sf.decode("params", &params)
+			s.scriptFields = append(s.scriptFields, NewScriptField(name, script, lang, params))
+		}
+	}
+	o.decode("sort", &s.sorters)
+	o.decode("track_scores", &s.trackScores)
+	if c := o.object("indices_boost"); c != nil {
+		for _, index := range c.keys() {
+			var boost float64
+			c.decode(index, &boost)
+			s.indexBoosts[index] = boost
+		}
+	}
+	for _, key := range []string{"aggregations", "aggs"} {
+		if v, ok := o.get(key); ok {
+			aggs, err := p.parseAggregations(v)
+			if err != nil {
+				o.setErr(key, err)
+				continue
+			}
+			for name, agg := range aggs {
+				s.aggregations[name] = agg
+			}
+		}
+	}
+	o.decode("stats", &s.stats)
+	if c := o.object("inner_hits"); c != nil {
+		for _, name := range c.keys() {
+			hit := c.object(name)
+			for _, kind := range hit.keys() {
+				target := hit.object(kind)
+				for _, t := range target.keys() {
+					var ih *InnerHit
+					target.decode(t, &ih)
+					if ih == nil {
+						continue
+					}
+					switch kind {
+					case "path":
+						ih.path = t
+					case "type":
+						ih.typ = t
+					default:
+						hit.failf(kind, "expected path or type")
+					}
+					s.innerHits[name] = ih
+				}
+			}
+		}
+	}
+	for _, key := range []string{"facets", "highlight", "suggest", "rescore", "partial_fields"} {
+		if o.has(key) {
+			o.failf(key, "%s is not supported", key)
+		}
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseInnerHit parses the body of inner_hits in a nested or
+// parent/child query or filter.
+func (p *DSLParser) parseInnerHit(v interface{}) (*InnerHit, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, &DSLError{Err: fmt.Errorf("expected an object; got %s", dslTypeName(v))}
+	}
+	hit := NewInnerHit()
+	body := make(map[string]interface{})
+	for k, item := range m {
+		if k != "name" {
+			body[k] = item
+		}
+	}
+	if name, found := m["name"]; found {
+		s, err := dslString(name)
+		if err != nil {
+			return nil, &DSLError{Path: "name", Err: err}
+		}
+		hit.name = s
+	}
+	src, err := p.parseSearchSource(body)
+	if err != nil {
+		return nil, err
+	}
+	hit.source = src
+	return hit, nil
+}
+
+// parseFetchSourceContext parses the "_source" parameter.
+func parseFetchSourceContext(v interface{}) (*FetchSourceContext, error) {
+	switch v := v.(type) {
+	case bool:
+		return NewFetchSourceContext(v), nil
+	case string, []interface{}:
+		fsc := NewFetchSourceContext(true)
+		includes, err := dslStrings(v)
+		if err != nil {
+			return nil, err
+		}
+		fsc.includes = includes
+		return fsc, nil
+	case map[string]interface{}:
+		fsc := NewFetchSourceContext(true)
+		for k, item := range v {
+			list, err := dslStrings(item)
+			if err != nil {
+				return nil, &DSLError{Path: k, Err: err}
+			}
+			switch k {
+			case "includes", "include":
+				fsc.includes = list
+			case "excludes", "exclude":
+				fsc.excludes = list
+			default:
+				return nil, &DSLError{Path: k, Err: fmt.Errorf("unknown parameter %q", k)}
+			}
+		}
+		return fsc, nil
+	}
+	return nil, fmt.Errorf("expected a boolean, string, array, or object; got %s", dslTypeName(v))
+}
+
+// parseSorter parses a single entry of the "sort" parameter. Sorting by
+// geo distance or script is not supported.
+func (p *DSLParser) parseSorter(v interface{}) (Sorter, error) {
+	if field, ok := v.(string); ok {
+		if field == "_score" {
+			return NewScoreSort(), nil
+		}
+		return NewFieldSort(field), nil
+	}
+	field, body, err := dslClause(v)
+	if err != nil {
+		return nil, err
+	}
+	if field == "_geo_distance" || field == "_script" {
+		return nil, &DSLError{Path: field, Err: fmt.Errorf("sorting by %s is not supported", field)}
+	}
+	ascending := field != "_score"
+	if order, ok := body.(string); ok {
+		body = map[string]interface{}{"order": order}
+	}
+	o := p.object(body)
+	var order string
+	var reverse bool
+	o.decode("order", &order)
+	o.decode("reverse", &reverse)
+	switch order {
+	case "":
+	case "asc":
+		ascending = true
+	case "desc":
+		ascending = false
+	default:
+		o.failf("order", "expected asc or desc; got %q", order)
+	}
+	if reverse {
+		ascending = !ascending
+	}
+	if field == "_score" {
+		if err := o.done(); err != nil {
+			return nil, wrapDSLError(err, field)
+		}
+		return NewScoreSort().Order(ascending), nil
+	}
+	s := NewFieldSort(field).Order(ascending)
+	o.decode("missing", &s.missing)
+	o.decode("ignore_unmapped", &s.ignoreUnmapped)
+	o.decode("unmapped_type", &s.unmappedType)
+	o.decode("mode", &s.sortMode)
+	o.decode("nested_filter", &s.nestedFilter)
+	o.decode("nested_path", &s.nestedPath)
+	if err := o.done(); err != nil {
+		return nil, wrapDSLError(err, field)
+	}
+	return s, nil
+}
+
+// -- Parameters --
+
+// dslObject reads the parameters of a JSON object and keeps track of the
+// parameters used, so that unknown parameters can be reported. The first
+// error is recorded and returned from done. Nested objects share the error
+// of their parent.
+type dslObject struct {
+	p        *DSLParser
+	path     string
+	m        map[string]interface{}
+	used     map[string]bool
+	children []*dslObject
+	err      *error
+}
+
+// object returns a dslObject for v, which must be a JSON object.
+func (p *DSLParser) object(v interface{}) *dslObject {
+	var err error
+	o := &dslObject{p: p, used: make(map[string]bool), err: &err}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		o.failf("", "expected an object; got %s", dslTypeName(v))
+		m = make(map[string]interface{})
+	}
+	o.m = m
+	return o
+}
+
+// object returns the nested object with the given key, or nil if it
+// does not exist.
+func (o *dslObject) object(key string) *dslObject {
+	v, ok := o.get(key)
+	if !ok {
+		return nil
+	}
+	return o.objectAt(key, v)
+}
+
+// objectAt returns a nested object for v, which has been read from the
+// location key, e.g. "functions[0]".
+func (o *dslObject) objectAt(key string, v interface{}) *dslObject {
+	c := &dslObject{p: o.p, path: joinDSLPath(o.path, key), used: make(map[string]bool), err: o.err}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		c.failf("", "expected an object; got %s", dslTypeName(v))
+		m = make(map[string]interface{})
+	}
+	c.m = m
+	o.children = append(o.children, c)
+	return c
+}
+
+// failf records an error for the parameter key.
+func (o *dslObject) failf(key, format string, args ...interface{}) {
+	if *o.err == nil {
+		*o.err = &DSLError{Path: joinDSLPath(o.path, key), Err: fmt.Errorf(format, args...)}
+	}
+}
+
+// setErr records err for the parameter key.
+func (o *dslObject) setErr(key string, err error) {
+	if *o.err == nil {
+		*o.err = wrapDSLError(err, joinDSLPath(o.path, key))
+	}
+}
+
+// has returns true if the parameter exists.
+func (o *dslObject) has(key string) bool {
+	_, found := o.m[key]
+	return found
+}
+
+// get returns the parameter and marks it as used. Parameters that are
+// null are treated like missing parameters.
+func (o *dslObject) get(key string) (interface{}, bool) {
+	v, found := o.m[key]
+	if !found {
+		return nil, false
+	}
+	o.used[key] = true
+	return v, v != nil
+}
+
+// keys returns the names of all parameters and marks them as used.
+func (o *dslObject) keys() []string {
+	keys := sortedDSLKeys(o.m)
+	for _, k := range keys {
+		o.used[k] = true
+	}
+	return keys
+}
+
+// field returns the name and value of the single parameter that has not
+// been used yet, e.g. the field name in {"term":{"user":"olivere"}}.
+func (o *dslObject) field() (string, interface{}) {
+	var unused []string
+	for _, k := range sortedDSLKeys(o.m) {
+		if !o.used[k] {
+			unused = append(unused, k)
+		}
+	}
+	switch len(unused) {
+	case 0:
+		o.failf("", "missing field")
+		return "", nil
+	case 1:
+		o.used[unused[0]] = true
+		return unused[0], o.m[unused[0]]
+	default:
+		o.failf("", "expected a single field; got %v", unused)
+		return "", nil
+	}
+}
+
+// fieldObject is like field, but additionally returns the value as a
+// nested object if it is a JSON object, or nil otherwise.
+func (o *dslObject) fieldObject() (string, interface{}, *dslObject) {
+	name, v := o.field()
+	if _, ok := v.(map[string]interface{}); !ok {
+		return name, v, nil
+	}
+	return name, v, o.object(name)
+}
+
+// done reports unknown parameters and returns the first error.
+func (o *dslObject) done() error {
+	for _, c := range o.children {
+		c.done()
+	}
+	if *o.err == nil {
+		for _, k := range sortedDSLKeys(o.m) {
+			if !o.used[k] {
+				o.failf(k, "unknown parameter %q", k)
+				break
+			}
+		}
+	}
+	return *o.err
+}
+
+// decode sets dst to the parameter with the given key, converting it to
+// the type of dst. It does nothing if the parameter does not exist.
+func (o *dslObject) decode(key string, dst interface{}) {
+	v, ok := o.get(key)
+	if !ok {
+		return
+	}
+	if err := o.convert(v, dst); err != nil {
+		o.setErr(key, err)
+	}
+}
+
+// convert sets dst to v, converting it to the type of dst.
+func (o *dslObject) convert(v interface{}, dst interface{}) error {
+	var err error
+	switch dst := dst.(type) {
+	case *string:
+		*dst, err = dslString(v)
+	case **string:
+		var s string
+		if s, err = dslString(v); err == nil {
+			*dst = &s
+		}
+	case *bool:
+		*dst, err = dslBool(v)
+	case **bool:
+		var b bool
+		if b, err = dslBool(v); err == nil {
+			*dst = &b
+		}
+	case *int:
+		var i int64
+		i, err = dslInt64(v)
+		*dst = int(i)
+	case **int:
+		var i int64
+		if i, err = dslInt64(v); err == nil {
+			n := int(i)
+			*dst = &n
+		}
+	case *int64:
+		*dst, err = dslInt64(v)
+	case **int64:
+		var i int64
+		if i, err = dslInt64(v); err == nil {
+			*dst = &i
+		}
+	case *float32:
+		var f float64
+		f, err = dslFloat64(v)
+		*dst = float32(f)
+	case **float32:
+		var f float64
+		if f, err = dslFloat64(v); err == nil {
+			n := float32(f)
+			*dst = &n
+		}
+	case *float64:
+		*dst, err = dslFloat64(v)
+	case **float64:
+		var f float64
+		if f, err = dslFloat64(v); err == nil {
+			*dst = &f
+		}
+	case *[]string:
+		*dst, err = dslStrings(v)
+	case *[]float64:
+		list, ok := v.([]interface{})
+		if !ok {
+			list = []interface{}{v}
+		}
+		values := make([]float64, len(list))
+		for i, item := range list {
+			if values[i], err = dslFloat64(item); err != nil {
+				return &DSLError{Path: fmt.Sprintf("[%d]", i), Err: err}
+			}
+		}
+		*dst = values
+	case *[]interface{}:
+		list, ok := v.([]interface{})
+		if !ok {
+			list = []interface{}{v}
+		}
+		*dst = list
+	case *interface{}:
+		*dst = v
+	case **interface{}:
+		*dst = &v
+	case *map[string]interface{}:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object; got %s", dslTypeName(v))
+		}
+		*dst = m
+	case *Query:
+		*dst, err = o.p.parseQuery(v)
+	case *Filter:
+		*dst, err = o.p.parseFilter(v)
+	case *[]Query:
+		err = dslEach(v, func(item interface{}) error {
+			q, err := o.p.parseQuery(item)
+			*dst = append(*dst, q)
+			return err
+		})
+	case *[]Filter:
+		err = dslEach(v, func(item interface{}) error {
+			f, err := o.p.parseFilter(item)
+			*dst = append(*dst, f)
+			return err
+		})
+	case *[]Sorter:
+		err = dslEach(v, func(item interface{}) error {
+			s, err := o.p.parseSorter(item)
+			*dst = append(*dst, s)
+			return err
+		})
+	case **InnerHit:
+		*dst, err = o.p.parseInnerHit(v)
+	case **FetchSourceContext:
+		*dst, err = parseFetchSourceContext(v)
+	case **GeoPoint:
+		*dst, err = dslGeoPoint(v)
+	default:
+		panic(fmt.Sprintf("elastic: cannot decode query DSL into %T", dst))
+	}
+	return err
+}
+
+// dslEach calls fn for every element of v if v is an array, or for v
+// otherwise. Errors are prefixed with the index of the element.
+func dslEach(v interface{}, fn func(item interface{}) error) error {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fn(v)
+	}
+	for i, item := range list {
+		if err := fn(item); err != nil {
+			return wrapDSLError(err, fmt.Sprintf("[%d]", i))
+		}
+	}
+	return nil
+}
+
+func dslString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("expected a string; got %s", dslTypeName(v))
+}
+
+func dslBool(v interface{}) (bool, error) {
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	return false, fmt.Errorf("expected a boolean; got %s", dslTypeName(v))
+}
+
+func dslInt64(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v), nil
+		}
+	case json.Number:
+		if _, ok := new(big.Int).SetString(string(v), 10); ok {
+			return 0, fmt.Errorf("integer %s out of range", v)
+		}
+	}
+	return 0, fmt.Errorf("expected an integer; got %s", dslTypeName(v))
+}
+
+func dslFloat64(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f, nil
+		}
+		return 0, fmt.Errorf("number %s out of range", v)
+	}
+	return 0, fmt.Errorf("expected a number; got %s", dslTypeName(v))
+}
+
+// dslStrings accepts a string or an array of strings.
+func dslStrings(v interface{}) ([]string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		s, err := dslString(v)
+		if err != nil {
+			return nil, fmt.Errorf("expected a string or an array of strings; got %s", dslTypeName(v))
+		}
+		return []string{s}, nil
+	}
+	values := make([]string, len(list))
+	for i, item := range list {
+		s, err := dslString(item)
+		if err != nil {
+			return nil, &DSLError{Path: fmt.Sprintf("[%d]", i), Err: err}
+		}
+		values[i] = s
+	}
+	return values, nil
+}
+
+// dslGeoPoint accepts a geo point as an object with lat and lon,
+// a "lat,lon" string, or a [lon, lat] array.
+func dslGeoPoint(v interface{}) (*GeoPoint, error) {
+	switch v := v.(type) {
+	case string:
+		return GeoPointFromString(v)
+	case []interface{}:
+		if len(v) == 2 {
+			lon, err1 := dslFloat64(v[0])
+			lat, err2 := dslFloat64(v[1])
+			if err1 == nil && err2 == nil {
+				return GeoPointFromLatLon(lat, lon), nil
+			}
+		}
+	case map[string]interface{}:
+		if len(v) == 2 {
+			lat, err1 := dslFloat64(v["lat"])
+			lon, err2 := dslFloat64(v["lon"])
+			if err1 == nil && err2 == nil {
+				return GeoPointFromLatLon(lat, lon), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("expected a geo point; got %s", dslTypeName(v))
+}
+
+// dslFieldBoosts splits fields like "name^2" into the field names and
+// their boosts, as used by MultiMatchQuery and QueryStringQuery.
+func dslFieldBoosts(fields []string) ([]string, map[string]*float32) {
+	names := make([]string, 0, len(fields))
+	boosts := make(map[string]*float32)
+	for _, field := range fields {
+		if i := strings.LastIndex(field, "^"); i > 0 {
+			if f, err := strconv.ParseFloat(field[i+1:], 32); err == nil {
+				boost := float32(f)
+				field = field[:i]
+				boosts[field] = &boost
+			}
+		}
+		names = append(names, field)
+	}
+	return names, boosts
+}
+
+// order parses the order of buckets, e.g. {"_count":"desc"}.
+func (o *dslObject) order(key string, order *string, asc *bool) {
+	c := o.object(key)
+	if c == nil {
+		return
+	}
+	keys := c.keys()
+	if len(keys) != 1 {
+		c.failf("", "expected a single order; got %v", keys)
+		return
+	}
+	var dir string
+	c.decode(keys[0], &dir)
+	switch dir {
+	case "asc":
+		*asc = true
+	case "desc":
+		*asc = false
+	default:
+		c.failf(keys[0], "expected asc or desc; got %q", dir)
+	}
+	*order = keys[0]
+}
+
+// dslNoMeta returns an error if meta data is specified for an
+// aggregation that does not support it.
+func dslNoMeta(meta map[string]interface{}) error {
+	if len(meta) > 0 {
+		return errors.New("meta is not supported")
+	}
+	return nil
+}
+
+// dslNoSubAggregations returns an error if sub-aggregations are specified
+// for an aggregation that does not support them.
+func dslNoSubAggregations(subAggs map[string]Aggregation) error {
+	if len(subAggs) > 0 {
+		return errors.New("sub-aggregations are not supported")
+	}
+	return nil
+}
@@ -0,0 +1,567 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"fmt"
+)
+
+// dslAggregationParsers are the aggregation parsers registered by NewDSLParser.
+var dslAggregationParsers = map[string]AggregationParserFunc{
+	"avg":               parseAvgAggregation,
+	"cardinality":       parseCardinalityAggregation,
+	"children":          parseChildrenAggregation,
+	"date_histogram":    parseDateHistogramAggregation,
+	"date_range":        parseDateRangeAggregation,
+	"extended_stats":    parseExtendedStatsAggregation,
+	"filter":            parseFilterAggregation,
+	"filters":           parseFiltersAggregation,
+	"geo_bounds":        parseGeoBoundsAggregation,
+	"geo_distance":      parseGeoDistanceAggregation,
+	"geohash_grid":      parseGeoHashGridAggregation,
+	"global":            parseGlobalAggregation,
+	"histogram":         parseHistogramAggregation,
+	"max":               parseMaxAggregation,
+	"min":               parseMinAggregation,
+	"missing":           parseMissingAggregation,
+	"nested":            parseNestedAggregation,
+	"percentile_ranks":  parsePercentileRanksAggregation,
+	"percentiles":       parsePercentilesAggregation,
+	"range":             parseRangeAggregation,
+	"reverse_nested":    parseReverseNestedAggregation,
+	"significant_terms": parseSignificantTermsAggregation,
+	"stats":             parseStatsAggregation,
+	"sum":               parseSumAggregation,
+	"terms":             parseTermsAggregation,
+	"top_hits":          parseTopHitsAggregation,
+	"value_count":       parseValueCountAggregation,
+}
+
+// valuesSource reads the parameters that specify the values of an
+// aggregation, i.e. a field or a script.
+func (o *dslObject) valuesSource(field, script, scriptFile, lang *string, params *map[string]interface{}) {
+	o.decode("field", field)
+	o.decode("script", script)
+	o.decode("script_file", scriptFile)
+	o.decode("lang", lang)
+	o.decode("params", params)
+}
+
+// aggregationRange is a single range of a range, date range, or
+// geo distance aggregation.
+type aggregationRange struct {
+	Key      string
+	From, To interface{}
+}
+
+// ranges reads the "ranges" parameter of range aggregations.
+func (o *dslObject) ranges() []aggregationRange {
+	var list []interface{}
+	o.decode("ranges", &list)
+	ranges := make([]aggregationRange, 0, len(list))
+	for i, v := range list {
+		var r aggregationRange
+		c := o.objectAt(fmt.Sprintf("ranges[%d]", i), v)
+		c.decode("key", &r.Key)
+		c.decode("from", &r.From)
+		c.decode("to", &r.To)
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+func parseAvgAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewAvgAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("format", &a.format)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseCardinalityAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewCardinalityAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("format", &a.format)
+	o.decode("precision_threshold", &a.precisionThreshold)
+	o.decode("rehash", &a.rehash)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseChildrenAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewChildrenAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.decode("type", &a.typ)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseDateHistogramAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewDateHistogramAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("interval", &a.interval)
+	o.decode("min_doc_count", &a.minDocCount)
+	o.order("order", &a.order, &a.orderAsc)
+	o.decode("pre_zone", &a.preZone)
+	o.decode("post_zone", &a.postZone)
+	o.decode("pre_zone_adjust_large_interval", &a.preZoneAdjustLargeInterval)
+	o.decode("pre_offset", &a.preOffset)
+	o.decode("post_offset", &a.postOffset)
+	o.decode("factor", &a.factor)
+	o.decode("format", &a.format)
+	if c := o.object("extended_bounds"); c != nil {
+		c.decode("min", &a.extendedBoundsMin)
+		c.decode("max", &a.extendedBoundsMax)
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseDateRangeAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewDateRangeAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("keyed", &a.keyed)
+	o.decode("unmapped", &a.unmapped)
+	o.decode("format", &a.format)
+	for _, r := range o.ranges() {
+		a.entries = append(a.entries, DateRangeAggregationEntry{Key: r.Key, From: r.From, To: r.To})
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseExtendedStatsAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewExtendedStatsAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("format", &a.format)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseFilterAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	filter, err := p.parseFilter(body)
+	if err != nil {
+		return nil, err
+	}
+	a := NewFilterAggregation().Filter(filter)
+	a.subAggregations = subAggs
+	return a, nil
+}
+
+func parseFiltersAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewFiltersAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	if v, ok := o.get("filters"); ok {
+		if _, isList := v.([]interface{}); isList {
+			o.decode("filters", &a.unnamedFilters)
+		} else if c := o.objectAt("filters", v); c != nil {
+			for _, name := range c.keys() {
+				var filter Filter
+				c.decode(name, &filter)
+				a.namedFilters[name] = filter
+			}
+		}
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseGeoBoundsAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	if err := dslNoSubAggregations(subAggs); err != nil {
+		return nil, err
+	}
+	a := NewGeoBoundsAggregation()
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("wrap_longitude", &a.wrapLongitude)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseGeoDistanceAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewGeoDistanceAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.decode("field", &a.field)
+	o.decode("unit", &a.unit)
+	o.decode("distance_type", &a.distanceType)
+	if v, ok := o.get("origin"); ok {
+		if s, isString := v.(string); isString {
+			a.point = s
+		} else {
+			var pt *GeoPoint
+			if err := o.convert(v, &pt); err != nil {
+				o.setErr("origin", err)
+			} else {
+				a.point = fmt.Sprintf("%v,%v", pt.Lat, pt.Lon)
+			}
+		}
+	}
+	for _, r := range o.ranges() {
+		a.ranges = append(a.ranges, geoDistAggRange{Key: r.Key, From: r.From, To: r.To})
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseGeoHashGridAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	a := NewGeoHashGridAggregation()
+	a.subAggregations = subAggs
+	a.meta = meta
+	o := p.object(body)
+	o.decode("field", &a.field)
+	o.decode("precision", &a.precision)
+	o.decode("size", &a.size)
+	o.decode("shard_size", &a.shardSize)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseGlobalAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	if err := p.object(body).done(); err != nil {
+		return nil, err
+	}
+	a := NewGlobalAggregation()
+	a.subAggregations = subAggs
+	return a, nil
+}
+
+func parseHistogramAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewHistogramAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("interval", &a.interval)
+	o.order("order", &a.order, &a.orderAsc)
+	o.decode("min_doc_count", &a.minDocCount)
+	if c := o.object("extended_bounds"); c != nil {
+		c.decode("min", &a.extendedBoundsMin)
+		c.decode("max", &a.extendedBoundsMax)
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseMaxAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewMaxAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("format", &a.format)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseMinAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewMinAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("format", &a.format)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseMissingAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewMissingAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.decode("field", &a.field)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseNestedAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewNestedAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.decode("path", &a.path)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parsePercentileRanksAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewPercentileRanksAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("format", &a.format)
+	o.decode("values", &a.values)
+	o.decode("compression", &a.compression)
+	o.decode("estimator", &a.estimator)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parsePercentilesAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewPercentilesAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("format", &a.format)
+	o.decode("percents", &a.percentiles)
+	o.decode("compression", &a.compression)
+	o.decode("estimator", &a.estimator)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseRangeAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewRangeAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("keyed", &a.keyed)
+	o.decode("unmapped", &a.unmapped)
+	for _, r := range o.ranges() {
+		a.entries = append(a.entries, rangeAggregationEntry{Key: r.Key, From: r.From, To: r.To})
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseReverseNestedAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	a := NewReverseNestedAggregation()
+	a.subAggregations = subAggs
+	a.meta = meta
+	o := p.object(body)
+	o.decode("path", &a.path)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseSignificantTermsAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewSignificantTermsAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.decode("field", &a.field)
+	o.decode("size", &a.requiredSize)
+	o.decode("shard_size", &a.shardSize)
+	o.decode("min_doc_count", &a.minDocCount)
+	o.decode("shard_min_doc_count", &a.shardMinDocCount)
+	o.decode("background_filter", &a.filter)
+	o.decode("execution_hint", &a.executionHint)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseStatsAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewStatsAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("format", &a.format)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseSumAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewSumAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("format", &a.format)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseTermsAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewTermsAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("size", &a.size)
+	o.decode("shard_size", &a.shardSize)
+	o.decode("required_size", &a.requiredSize)
+	o.decode("min_doc_count", &a.minDocCount)
+	o.decode("shard_min_doc_count", &a.shardMinDocCount)
+	o.decode("show_term_doc_count_error", &a.showTermDocCountError)
+	o.decode("collect_mode", &a.collectionMode)
+	o.decode("value_type", &a.valueType)
+	o.order("order", &a.order, &a.orderAsc)
+	o.termsPattern("include", &a.includeTerms, &a.includePattern, &a.includeFlags)
+	o.termsPattern("exclude", &a.excludeTerms, &a.excludePattern, &a.excludeFlags)
+	o.decode("execution_hint", &a.executionHint)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// termsPattern reads the include or exclude parameter of a terms
+// aggregation, which is either a list of terms, a pattern, or an object
+// with a pattern and flags.
+func (o *dslObject) termsPattern(key string, terms *[]string, pattern *string, flags **int) {
+	v, ok := o.get(key)
+	if !ok {
+		return
+	}
+	switch v.(type) {
+	case []interface{}:
+		o.decode(key, terms)
+	case map[string]interface{}:
+		c := o.objectAt(key, v)
+		c.decode("pattern", pattern)
+		c.decode("flags", flags)
+	default:
+		o.decode(key, pattern)
+	}
+}
+
+func parseTopHitsAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	if err := dslNoSubAggregations(subAggs); err != nil {
+		return nil, err
+	}
+	src, err := p.parseSearchSource(body)
+	if err != nil {
+		return nil, err
+	}
+	a := NewTopHitsAggregation()
+	a.searchSource = src
+	return a, nil
+}
+
+func parseValueCountAggregation(p *DSLParser, body interface{}, subAggs map[string]Aggregation, meta map[string]interface{}) (Aggregation, error) {
+	if err := dslNoMeta(meta); err != nil {
+		return nil, err
+	}
+	a := NewValueCountAggregation()
+	a.subAggregations = subAggs
+	o := p.object(body)
+	o.valuesSource(&a.field, &a.script, &a.scriptFile, &a.lang, &a.params)
+	o.decode("format", &a.format)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,402 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"strings"
+)
+
+// dslFilterParsers are the filter parsers registered by NewDSLParser.
+var dslFilterParsers = map[string]FilterParserFunc{
+	"and":          parseAndFilter,
+	"bool":         parseBoolFilter,
+	"exists":       parseExistsFilter,
+	"geo_distance": parseGeoDistanceFilter,
+	"geo_polygon":  parseGeoPolygonFilter,
+	"has_child":    parseHasChildFilter,
+	"has_parent":   parseHasParentFilter,
+	"ids":          parseIdsFilter,
+	"limit":        parseLimitFilter,
+	"match_all":    parseMatchAllFilter,
+	"missing":      parseMissingFilter,
+	"nested":       parseNestedFilter,
+	"not":          parseNotFilter,
+	"or":           parseOrFilter,
+	"prefix":       parsePrefixFilter,
+	"query":        parseQueryFilter,
+	"fquery":       parseFQueryFilter,
+	"range":        parseRangeFilter,
+	"regexp":       parseRegexpFilter,
+	"term":         parseTermFilter,
+	"terms":        parseTermsFilter,
+	"in":           parseTermsFilter,
+	"type":         parseTypeFilter,
+}
+
+func parseAndFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewAndFilter()
+	if _, ok := body.([]interface{}); ok {
+		body = map[string]interface{}{"filters": body}
+	}
+	o := p.object(body)
+	o.decode("filters", &f.filters)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	o.decode("_name", &f.filterName)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseBoolFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewBoolFilter()
+	o := p.object(body)
+	o.decode("must", &f.mustClauses)
+	o.decode("should", &f.shouldClauses)
+	o.decode("must_not", &f.mustNotClauses)
+	o.decode("_name", &f.filterName)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseExistsFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewExistsFilter("")
+	o := p.object(body)
+	o.decode("field", &f.name)
+	o.decode("_name", &f.filterName)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseGeoDistanceFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewGeoDistanceFilter("")
+	o := p.object(body)
+	o.decode("distance", &f.distance)
+	o.decode("distance_type", &f.distanceType)
+	o.decode("optimize_bbox", &f.optimizeBbox)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	o.decode("_name", &f.filterName)
+	name, v := o.field()
+	f.name = name
+	if s, ok := v.(string); ok && !strings.Contains(s, ",") {
+		f.geohash = s
+	} else if v != nil {
+		var pt *GeoPoint
+		if err := o.convert(v, &pt); err != nil {
+			o.setErr(name, err)
+		} else {
+			f.lat, f.lon = pt.Lat, pt.Lon
+		}
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseGeoPolygonFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewGeoPolygonFilter("")
+	o := p.object(body)
+	o.decode("_name", &f.filterName)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	name, _, c := o.fieldObject()
+	if c == nil {
+		o.failf(name, "expected an object")
+		return nil, o.done()
+	}
+	f.name = name
+	var points []interface{}
+	c.decode("points", &points)
+	for _, v := range points {
+		var pt *GeoPoint
+		if err := c.convert(v, &pt); err != nil {
+			c.setErr("points", err)
+			break
+		}
+		f.points = append(f.points, pt)
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseHasChildFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewHasChildFilter("")
+	o := p.object(body)
+	o.decode("query", &f.query)
+	o.decode("filter", &f.filter)
+	o.decode("type", &f.childType)
+	o.decode("_name", &f.filterName)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	o.decode("short_circuit_cutoff", &f.shortCircuitCutoff)
+	o.decode("min_children", &f.minChildren)
+	o.decode("max_children", &f.maxChildren)
+	o.decode("inner_hits", &f.innerHit)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseHasParentFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewHasParentFilter("")
+	o := p.object(body)
+	o.decode("query", &f.query)
+	o.decode("filter", &f.filter)
+	o.decode("parent_type", &f.parentType)
+	o.decode("_name", &f.filterName)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	o.decode("inner_hits", &f.innerHit)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseIdsFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewIdsFilter()
+	o := p.object(body)
+	o.decode("type", &f.types)
+	o.decode("types", &f.types)
+	o.decode("values", &f.values)
+	o.decode("_name", &f.filterName)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseLimitFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewLimitFilter(0)
+	o := p.object(body)
+	o.decode("value", &f.limit)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseMatchAllFilter(p *DSLParser, body interface{}) (Filter, error) {
+	if err := p.object(body).done(); err != nil {
+		return nil, err
+	}
+	return NewMatchAllFilter(), nil
+}
+
+func parseMissingFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewMissingFilter("")
+	o := p.object(body)
+	o.decode("field", &f.name)
+	o.decode("null_value", &f.nullValue)
+	o.decode("existence", &f.existence)
+	o.decode("_name", &f.filterName)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseNestedFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewNestedFilter("")
+	o := p.object(body)
+	o.decode("query", &f.query)
+	o.decode("filter", &f.filter)
+	o.decode("join", &f.join)
+	o.decode("path", &f.path)
+	o.decode("_name", &f.filterName)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	o.decode("inner_hits", &f.innerHit)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseNotFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewNotFilter(nil)
+	o := p.object(body)
+	if !o.has("filter") {
+		// Short form, e.g. {"not":{"term":{...}}}
+		filter, err := p.parseFilter(body)
+		if err != nil {
+			return nil, err
+		}
+		f.filter = filter
+		return f, nil
+	}
+	o.decode("filter", &f.filter)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	o.decode("_name", &f.filterName)
+	if f.filter == nil {
+		o.failf("filter", "missing filter")
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseOrFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewOrFilter()
+	if _, ok := body.([]interface{}); ok {
+		body = map[string]interface{}{"filters": body}
+	}
+	o := p.object(body)
+	o.decode("filters", &f.filters)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	o.decode("_name", &f.filterName)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parsePrefixFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewPrefixFilter("", "")
+	o := p.object(body)
+	o.decode("_name", &f.filterName)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	name, v := o.field()
+	f.name = name
+	if v != nil {
+		if err := o.convert(v, &f.prefix); err != nil {
+			o.setErr(name, err)
+		}
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseQueryFilter(p *DSLParser, body interface{}) (Filter, error) {
+	q, err := p.parseQuery(body)
+	if err != nil {
+		return nil, err
+	}
+	return NewQueryFilter(q), nil
+}
+
+func parseFQueryFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewQueryFilter(nil)
+	o := p.object(body)
+	o.decode("query", &f.query)
+	o.decode("_name", &f.filterName)
+	o.decode("_cache", &f.cache)
+	if f.query == nil {
+		o.failf("query", "missing query")
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseRangeFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewRangeFilter("")
+	o := p.object(body)
+	o.decode("_name", &f.filterName)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	o.decode("execution", &f.execution)
+	name, _, c := o.fieldObject()
+	if c == nil {
+		o.failf(name, "expected an object")
+		return nil, o.done()
+	}
+	f.name = name
+	r := parseRange(c)
+	f.from, f.to = r.from, r.to
+	f.includeLower, f.includeUpper = r.includeLower, r.includeUpper
+	f.timeZone, f.format = r.timeZone, r.format
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseRegexpFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewRegexpFilter("", "")
+	o := p.object(body)
+	o.decode("_name", &f.filterName)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	name, v, c := o.fieldObject()
+	f.name = name
+	if c == nil {
+		if v != nil {
+			if err := o.convert(v, &f.regexp); err != nil {
+				o.setErr(name, err)
+			}
+		}
+	} else {
+		c.decode("value", &f.regexp)
+		c.decode("flags", &f.flags)
+		c.decode("max_determinized_states", &f.maxDeterminizedStates)
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseTermFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewTermFilter("", nil)
+	o := p.object(body)
+	o.decode("_name", &f.filterName)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	f.name, f.value = o.field()
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseTermsFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewTermsFilter("")
+	o := p.object(body)
+	o.decode("_name", &f.filterName)
+	o.decode("execution", &f.execution)
+	o.decode("_cache", &f.cache)
+	o.decode("_cache_key", &f.cacheKey)
+	name, v := o.field()
+	f.name = name
+	if v != nil {
+		if err := o.convert(v, &f.values); err != nil {
+			o.setErr(name, err)
+		}
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseTypeFilter(p *DSLParser, body interface{}) (Filter, error) {
+	f := NewTypeFilter("")
+	o := p.object(body)
+	o.decode("value", &f.typ)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,855 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"fmt"
+)
+
+// dslQueryParsers are the query parsers registered by NewDSLParser.
+var dslQueryParsers = map[string]QueryParserFunc{
+	"bool":                  parseBoolQuery,
+	"boosting":              parseBoostingQuery,
+	"common":                parseCommonQuery,
+	"constant_score":        parseConstantScoreQuery,
+	"custom_filters_score":  parseCustomFiltersScoreQuery,
+	"custom_score":          parseCustomScoreQuery,
+	"dis_max":               parseDisMaxQuery,
+	"filtered":              parseFilteredQuery,
+	"function_score":        parseFunctionScoreQuery,
+	"fuzzy":                 parseFuzzyQuery,
+	"fuzzy_like_this":       parseFuzzyLikeThisQuery,
+	"flt":                   parseFuzzyLikeThisQuery,
+	"fuzzy_like_this_field": parseFuzzyLikeThisFieldQuery,
+	"flt_field":             parseFuzzyLikeThisFieldQuery,
+	"has_child":             parseHasChildQuery,
+	"has_parent":            parseHasParentQuery,
+	"ids":                   parseIdsQuery,
+	"match":                 parseMatchQuery,
+	"match_phrase":          parseMatchPhraseQuery,
+	"match_phrase_prefix":   parseMatchPhrasePrefixQuery,
+	"match_all":             parseMatchAllQuery,
+	"mlt":                   parseMoreLikeThisQuery,
+	"more_like_this":        parseMoreLikeThisQuery,
+	"more_like_this_field":  parseMoreLikeThisFieldQuery,
+	"mlt_field":             parseMoreLikeThisFieldQuery,
+	"multi_match":           parseMultiMatchQuery,
+	"nested":                parseNestedQuery,
+	"prefix":                parsePrefixQuery,
+	"query_string":          parseQueryStringQuery,
+	"range":                 parseRangeQuery,
+	"regexp":                parseRegexpQuery,
+	"simple_query_string":   parseSimpleQueryStringQuery,
+	"template":              parseTemplateQuery,
+	"term":                  parseTermQuery,
+	"terms":                 parseTermsQuery,
+	"in":                    parseTermsQuery,
+	"wildcard":              parseWildcardQuery,
+}
+
+func parseBoolQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewBoolQuery()
+	o := p.object(body)
+	o.decode("must", &q.mustClauses)
+	o.decode("should", &q.shouldClauses)
+	o.decode("must_not", &q.mustNotClauses)
+	o.decode("boost", &q.boost)
+	o.decode("disable_coord", &q.disableCoord)
+	o.decode("minimum_should_match", &q.minimumShouldMatch)
+	o.decode("adjust_pure_negative", &q.adjustPureNegative)
+	o.decode("_name", &q.queryName)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseBoostingQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewBoostingQuery()
+	o := p.object(body)
+	o.decode("positive", &q.positiveClause)
+	o.decode("negative", &q.negativeClause)
+	o.decode("negative_boost", &q.negativeBoost)
+	o.decode("boost", &q.boost)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseCommonQuery(p *DSLParser, body interface{}) (Query, error) {
+	var q CommonQuery
+	o := p.object(body)
+	name, _, c := o.fieldObject()
+	if c == nil {
+		o.failf(name, "expected an object")
+		return nil, o.done()
+	}
+	q.name = name
+	c.decode("query", &q.query)
+	c.decode("cutoff_frequency", &q.cutoffFreq)
+	c.decode("high_freq", &q.highFreq)
+	c.decode("high_freq_operator", &q.highFreqOp)
+	c.decode("low_freq", &q.lowFreq)
+	c.decode("low_freq_operator", &q.lowFreqOp)
+	if _, ok := c.m["minimum_should_match"].(map[string]interface{}); ok {
+		mmo := c.object("minimum_should_match")
+		mmo.decode("low_freq", &q.lowFreqMinMatch)
+		mmo.decode("high_freq", &q.highFreqMinMatch)
+	} else {
+		c.decode("minimum_should_match", &q.lowFreqMinMatch)
+	}
+	c.decode("analyzer", &q.analyzer)
+	c.decode("disable_coords", &q.disableCoords)
+	c.decode("boost", &q.boost)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseConstantScoreQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewConstantScoreQuery()
+	o := p.object(body)
+	o.decode("query", &q.query)
+	o.decode("filter", &q.filter)
+	o.decode("boost", &q.boost)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseCustomFiltersScoreQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewCustomFiltersScoreQuery()
+	o := p.object(body)
+	o.decode("query", &q.query)
+	o.decode("filters", &q.filters)
+	o.decode("score_mode", &q.scoreMode)
+	o.decode("max_boost", &q.maxBoost)
+	o.decode("script", &q.script)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseCustomScoreQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewCustomScoreQuery()
+	o := p.object(body)
+	o.decode("query", &q.query)
+	o.decode("filter", &q.filter)
+	o.decode("script", &q.script)
+	o.decode("lang", &q.lang)
+	o.decode("params", &q.params)
+	o.decode("boost", &q.boost)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseDisMaxQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewDisMaxQuery()
+	o := p.object(body)
+	o.decode("queries", &q.queries)
+	o.decode("boost", &q.boost)
+	o.decode("tie_breaker", &q.tieBreaker)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseFilteredQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewFilteredQuery(nil)
+	o := p.object(body)
+	o.decode("query", &q.query)
+	var filter Filter
+	o.decode("filter", &filter)
+	if filter != nil {
+		q.filters = append(q.filters, filter)
+	}
+	o.decode("boost", &q.boost)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// dslScoreFunctions are the names of the score functions of a
+// function_score query.
+var dslScoreFunctions = []string{
+	"exp", "gauss", "linear", "script_score", "boost_factor", "field_value_factor", "random_score",
+}
+
+func parseFunctionScoreQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewFunctionScoreQuery()
+	o := p.object(body)
+	o.decode("query", &q.query)
+	o.decode("filter", &q.filter)
+	if v, ok := o.get("functions"); ok {
+		list, isList := v.([]interface{})
+		if !isList {
+			o.failf("functions", "expected an array; got %s", dslTypeName(v))
+		}
+		for i, item := range list {
+			fo := o.objectAt(fmt.Sprintf("functions[%d]", i), item)
+			var filter Filter
+			fo.decode("filter", &filter)
+			if fn := parseScoreFunction(fo); fn != nil {
+				q.filters = append(q.filters, filter)
+				q.scoreFuncs = append(q.scoreFuncs, fn)
+			} else {
+				fo.failf("", "missing score function")
+			}
+		}
+	} else if fn := parseScoreFunction(o); fn != nil {
+		q.filters = append(q.filters, nil)
+		q.scoreFuncs = append(q.scoreFuncs, fn)
+	}
+	o.decode("score_mode", &q.scoreMode)
+	o.decode("boost_mode", &q.boostMode)
+	o.decode("max_boost", &q.maxBoost)
+	o.decode("boost", &q.boost)
+	o.decode("min_score", &q.minScore)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// parseScoreFunction parses the score function in o, along with its
+// weight. It returns nil if o contains no score function.
+func parseScoreFunction(o *dslObject) ScoreFunction {
+	var name string
+	for _, fn := range dslScoreFunctions {
+		if o.has(fn) {
+			if name != "" {
+				o.failf(fn, "expected a single score function; got %q and %q", name, fn)
+				return nil
+			}
+			name = fn
+		}
+	}
+	var weight *float64
+	o.decode("weight", &weight)
+	if name == "" {
+		if weight == nil {
+			return nil
+		}
+		return NewWeightFactorFunction(*weight)
+	}
+
+	switch name {
+	case "exp", "gauss", "linear":
+		c := o.object(name)
+		if c == nil {
+			o.failf(name, "expected an object")
+			return nil
+		}
+		var d struct {
+			fieldName      string
+			origin         interface{}
+			scale          interface{}
+			decay          *float64
+			offset         interface{}
+			multiValueMode string
+		}
+		c.decode("multi_value_mode", &d.multiValueMode)
+		field, _, fc := c.fieldObject()
+		if fc == nil {
+			c.failf(field, "expected an object")
+			return nil
+		}
+		d.fieldName = field
+		fc.decode("origin", &d.origin)
+		fc.decode("scale", &d.scale)
+		fc.decode("decay", &d.decay)
+		fc.decode("offset", &d.offset)
+		switch name {
+		case "exp":
+			return ExponentialDecayFunction{fieldName: d.fieldName, origin: d.origin, scale: d.scale, decay: d.decay, offset: d.offset, multiValueMode: d.multiValueMode, weight: weight}
+		case "gauss":
+			return GaussDecayFunction{fieldName: d.fieldName, origin: d.origin, scale: d.scale, decay: d.decay, offset: d.offset, multiValueMode: d.multiValueMode, weight: weight}
+		default:
+			return LinearDecayFunction{fieldName: d.fieldName, origin: d.origin, scale: d.scale, decay: d.decay, offset: d.offset, multiValueMode: d.multiValueMode, weight: weight}
+		}
+	case "script_score":
+		fn := NewScriptFunction("")
+		fn.weight = weight
+		if c := o.object(name); c != nil {
+			c.decode("script", &fn.script)
+			c.decode("lang", &fn.lang)
+			c.decode("params", &fn.params)
+		}
+		return fn
+	case "boost_factor":
+		if weight != nil {
+			o.failf("weight", "weight is not supported with boost_factor")
+			return nil
+		}
+		fn := NewFactorFunction()
+		o.decode(name, &fn.boostFactor)
+		return fn
+	case "field_value_factor":
+		fn := NewFieldValueFactorFunction()
+		fn.weight = weight
+		if c := o.object(name); c != nil {
+			c.decode("field", &fn.field)
+			c.decode("factor", &fn.factor)
+			c.decode("missing", &fn.missing)
+			c.decode("modifier", &fn.modifier)
+		}
+		return fn
+	default: // random_score
+		fn := NewRandomFunction()
+		fn.weight = weight
+		if c := o.object(name); c != nil {
+			c.decode("seed", &fn.seed)
+		}
+		return fn
+	}
+}
+
+func parseFuzzyQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewFuzzyQuery()
+	o := p.object(body)
+	name, v, c := o.fieldObject()
+	q.name = name
+	if c == nil {
+		q.value = v
+	} else {
+		c.decode("value", &q.value)
+		c.decode("boost", &q.boost)
+		c.decode("transpositions", &q.transpositions)
+		c.decode("fuzziness", &q.fuzziness)
+		c.decode("prefix_length", &q.prefixLength)
+		c.decode("max_expansions", &q.maxExpansions)
+		c.decode("_name", &q.queryName)
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseFuzzyLikeThisQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewFuzzyLikeThisQuery()
+	o := p.object(body)
+	o.decode("fields", &q.fields)
+	o.decode("like_text", &q.likeText)
+	o.decode("max_query_terms", &q.maxQueryTerms)
+	o.decode("fuzziness", &q.fuzziness)
+	o.decode("prefix_length", &q.prefixLength)
+	o.decode("ignore_tf", &q.ignoreTF)
+	o.decode("boost", &q.boost)
+	o.decode("analyzer", &q.analyzer)
+	o.decode("fail_on_unsupported_field", &q.failOnUnsupportedField)
+	o.decode("_name", &q.queryName)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseFuzzyLikeThisFieldQuery(p *DSLParser, body interface{}) (Query, error) {
+	o := p.object(body)
+	name, _, c := o.fieldObject()
+	if c == nil {
+		o.failf(name, "expected an object")
+		return nil, o.done()
+	}
+	q := NewFuzzyLikeThisFieldQuery(name)
+	c.decode("like_text", &q.likeText)
+	c.decode("max_query_terms", &q.maxQueryTerms)
+	c.decode("fuzziness", &q.fuzziness)
+	c.decode("prefix_length", &q.prefixLength)
+	c.decode("ignore_tf", &q.ignoreTF)
+	c.decode("boost", &q.boost)
+	c.decode("analyzer", &q.analyzer)
+	c.decode("fail_on_unsupported_field", &q.failOnUnsupportedField)
+	c.decode("_name", &q.queryName)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseHasChildQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewHasChildQuery("", nil)
+	o := p.object(body)
+	o.decode("query", &q.query)
+	o.decode("type", &q.childType)
+	o.decode("boost", &q.boost)
+	o.decode("score_type", &q.scoreType)
+	o.decode("min_children", &q.minChildren)
+	o.decode("max_children", &q.maxChildren)
+	o.decode("short_circuit_cutoff", &q.shortCircuitCutoff)
+	o.decode("_name", &q.queryName)
+	o.decode("inner_hits", &q.innerHit)
+	if q.query == nil {
+		o.failf("query", "missing query")
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseHasParentQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewHasParentQuery("", nil)
+	o := p.object(body)
+	o.decode("query", &q.query)
+	o.decode("parent_type", &q.parentType)
+	o.decode("boost", &q.boost)
+	o.decode("score_type", &q.scoreType)
+	o.decode("_name", &q.queryName)
+	o.decode("inner_hits", &q.innerHit)
+	if q.query == nil {
+		o.failf("query", "missing query")
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseIdsQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewIdsQuery()
+	o := p.object(body)
+	o.decode("type", &q.types)
+	o.decode("types", &q.types)
+	o.decode("values", &q.values)
+	o.decode("boost", &q.boost)
+	o.decode("_name", &q.queryName)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseMatchQuery(p *DSLParser, body interface{}) (Query, error) {
+	return parseMatchQueryWithType(p, body, "")
+}
+
+func parseMatchPhraseQuery(p *DSLParser, body interface{}) (Query, error) {
+	return parseMatchQueryWithType(p, body, "phrase")
+}
+
+func parseMatchPhrasePrefixQuery(p *DSLParser, body interface{}) (Query, error) {
+	return parseMatchQueryWithType(p, body, "phrase_prefix")
+}
+
+func parseMatchQueryWithType(p *DSLParser, body interface{}, typ string) (Query, error) {
+	q := NewMatchQuery("", nil)
+	q.matchQueryType = typ
+	o := p.object(body)
+	name, v, c := o.fieldObject()
+	q.name = name
+	if c == nil {
+		q.value = v
+	} else {
+		c.decode("query", &q.value)
+		c.decode("type", &q.matchQueryType)
+		c.decode("operator", &q.operator)
+		c.decode("analyzer", &q.analyzer)
+		c.decode("boost", &q.boost)
+		c.decode("slop", &q.slop)
+		c.decode("fuzziness", &q.fuzziness)
+		c.decode("prefix_length", &q.prefixLength)
+		c.decode("max_expansions", &q.maxExpansions)
+		c.decode("minimum_should_match", &q.minimumShouldMatch)
+		c.decode("rewrite", &q.rewrite)
+		c.decode("fuzzy_rewrite", &q.fuzzyRewrite)
+		c.decode("lenient", &q.lenient)
+		c.decode("fuzzy_transpositions", &q.fuzzyTranspositions)
+		c.decode("zero_terms_query", &q.zeroTermsQuery)
+		c.decode("cutoff_frequency", &q.cutoffFrequency)
+		c.decode("_name", &q.queryName)
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseMatchAllQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewMatchAllQuery()
+	o := p.object(body)
+	o.decode("boost", &q.boost)
+	o.decode("norms_field", &q.normsField)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseMoreLikeThisQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewMoreLikeThisQuery("")
+	o := p.object(body)
+	o.decode("fields", &q.fields)
+	o.decode("like_text", &q.likeText)
+	o.decode("minimum_should_match", &q.minimumShouldMatch)
+	o.decode("min_term_freq", &q.minTermFreq)
+	o.decode("max_query_terms", &q.maxQueryTerms)
+	o.decode("stop_words", &q.stopWords)
+	o.decode("min_doc_freq", &q.minDocFreq)
+	o.decode("max_doc_freq", &q.maxDocFreq)
+	o.decode("min_word_len", &q.minWordLen)
+	o.decode("max_word_len", &q.maxWordLen)
+	o.decode("boost_terms", &q.boostTerms)
+	o.decode("boost", &q.boost)
+	o.decode("analyzer", &q.analyzer)
+	o.decode("fail_on_unsupported_field", &q.failOnUnsupportedField)
+	o.decode("_name", &q.queryName)
+	o.decode("ids", &q.ids)
+	var exclude *bool
+	o.decode("exclude", &exclude)
+	if exclude != nil {
+		include := !*exclude
+		q.include = &include
+	}
+	if v, ok := o.get("docs"); ok {
+		list, isList := v.([]interface{})
+		if !isList {
+			o.failf("docs", "expected an array; got %s", dslTypeName(v))
+		}
+		for i, item := range list {
+			doc := NewMoreLikeThisQueryItem()
+			if s, ok := item.(string); ok {
+				doc.likeText = s
+				q.docs = append(q.docs, doc)
+				continue
+			}
+			c := o.objectAt(fmt.Sprintf("docs[%d]", i), item)
+			c.decode("_index", &doc.index)
+			c.decode("_type", &doc.typ)
+			c.decode("_id", &doc.id)
+			c.decode("doc", &doc.doc)
+			c.decode("fields", &doc.fields)
+			c.decode("_routing", &doc.routing)
+			c.decode("_source", &doc.fsc)
+			c.decode("_version", &doc.version)
+			c.decode("_version_type", &doc.versionType)
+			q.docs = append(q.docs, doc)
+		}
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseMoreLikeThisFieldQuery(p *DSLParser, body interface{}) (Query, error) {
+	o := p.object(body)
+	name, _, c := o.fieldObject()
+	if c == nil {
+		o.failf(name, "expected an object")
+		return nil, o.done()
+	}
+	q := NewMoreLikeThisFieldQuery(name, "")
+	c.decode("like_text", &q.likeText)
+	c.decode("percent_terms_to_match", &q.percentTermsToMatch)
+	c.decode("min_term_freq", &q.minTermFreq)
+	c.decode("max_query_terms", &q.maxQueryTerms)
+	c.decode("stop_words", &q.stopWords)
+	c.decode("min_doc_freq", &q.minDocFreq)
+	c.decode("max_doc_freq", &q.maxDocFreq)
+	c.decode("min_word_len", &q.minWordLen)
+	c.decode("max_word_len", &q.maxWordLen)
+	c.decode("boost_terms", &q.boostTerms)
+	c.decode("boost", &q.boost)
+	c.decode("analyzer", &q.analyzer)
+	c.decode("fail_on_unsupported_field", &q.failOnUnsupportedField)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseMultiMatchQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewMultiMatchQuery(nil)
+	o := p.object(body)
+	o.decode("query", &q.text)
+	var fields []string
+	o.decode("fields", &fields)
+	q.fields, q.fieldBoosts = dslFieldBoosts(fields)
+	o.decode("type", &q.matchQueryType)
+	o.decode("operator", &q.operator)
+	o.decode("analyzer", &q.analyzer)
+	o.decode("boost", &q.boost)
+	o.decode("slop", &q.slop)
+	o.decode("fuzziness", &q.fuzziness)
+	o.decode("prefix_length", &q.prefixLength)
+	o.decode("max_expansions", &q.maxExpansions)
+	o.decode("minimum_should_match", &q.minimumShouldMatch)
+	o.decode("rewrite", &q.rewrite)
+	o.decode("fuzzy_rewrite", &q.fuzzyRewrite)
+	o.decode("use_dis_max", &q.useDisMax)
+	o.decode("tie_breaker", &q.tieBreaker)
+	o.decode("lenient", &q.lenient)
+	o.decode("cutoff_frequency", &q.cutoffFrequency)
+	o.decode("zero_terms_query", &q.zeroTermsQuery)
+	o.decode("_name", &q.queryName)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseNestedQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewNestedQuery("")
+	o := p.object(body)
+	o.decode("query", &q.query)
+	o.decode("filter", &q.filter)
+	o.decode("path", &q.path)
+	o.decode("score_mode", &q.scoreMode)
+	o.decode("boost", &q.boost)
+	o.decode("_name", &q.queryName)
+	o.decode("inner_hits", &q.innerHit)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parsePrefixQuery(p *DSLParser, body interface{}) (Query, error) {
+	var q PrefixQuery
+	o := p.object(body)
+	name, v, c := o.fieldObject()
+	q.name = name
+	if c == nil {
+		if err := o.convert(v, &q.prefix); err != nil {
+			o.setErr(name, err)
+		}
+	} else {
+		c.decode("prefix", &q.prefix)
+		c.decode("value", &q.prefix)
+		c.decode("boost", &q.boost)
+		c.decode("rewrite", &q.rewrite)
+		c.decode("_name", &q.queryName)
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseQueryStringQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewQueryStringQuery("")
+	o := p.object(body)
+	o.decode("query", &q.queryString)
+	o.decode("default_field", &q.defaultField)
+	var fields []string
+	o.decode("fields", &fields)
+	q.fields, q.fieldBoosts = dslFieldBoosts(fields)
+	o.decode("tie_breaker", &q.tieBreaker)
+	o.decode("use_dis_max", &q.useDisMax)
+	o.decode("default_operator", &q.defaultOper)
+	o.decode("analyzer", &q.analyzer)
+	o.decode("quote_analyzer", &q.quoteAnalyzer)
+	o.decode("auto_generate_phrase_queries", &q.autoGeneratePhraseQueries)
+	o.decode("max_determinized_states", &q.maxDeterminizedStates)
+	o.decode("allow_leading_wildcard", &q.allowLeadingWildcard)
+	o.decode("lowercase_expanded_terms", &q.lowercaseExpandedTerms)
+	o.decode("enable_position_increments", &q.enablePositionIncrements)
+	o.decode("fuzzy_min_sim", &q.fuzzyMinSim)
+	o.decode("boost", &q.boost)
+	o.decode("fuzzy_prefix_length", &q.fuzzyPrefixLength)
+	o.decode("fuzzy_max_expansions", &q.fuzzyMaxExpansions)
+	o.decode("fuzzy_rewrite", &q.fuzzyRewrite)
+	o.decode("phrase_slop", &q.phraseSlop)
+	o.decode("analyze_wildcard", &q.analyzeWildcard)
+	o.decode("rewrite", &q.rewrite)
+	o.decode("minimum_should_match", &q.minimumShouldMatch)
+	o.decode("quote_field_suffix", &q.quoteFieldSuffix)
+	o.decode("lenient", &q.lenient)
+	o.decode("time_zone", &q.timeZone)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// dslRange holds the parameters of range queries and filters.
+type dslRange struct {
+	from, to                   *interface{}
+	includeLower, includeUpper bool
+	timeZone, format           string
+}
+
+// parseRange parses the bounds of a range query or filter, given
+// either as from/to or as gt/gte/lt/lte.
+func parseRange(o *dslObject) dslRange {
+	r := dslRange{includeLower: true, includeUpper: true}
+	o.decode("from", &r.from)
+	o.decode("to", &r.to)
+	if o.has("gt") {
+		o.decode("gt", &r.from)
+		r.includeLower = false
+	}
+	if o.has("gte") {
+		o.decode("gte", &r.from)
+		r.includeLower = true
+	}
+	if o.has("lt") {
+		o.decode("lt", &r.to)
+		r.includeUpper = false
+	}
+	if o.has("lte") {
+		o.decode("lte", &r.to)
+		r.includeUpper = true
+	}
+	o.decode("include_lower", &r.includeLower)
+	o.decode("include_upper", &r.includeUpper)
+	o.decode("time_zone", &r.timeZone)
+	o.decode("format", &r.format)
+	return r
+}
+
+func parseRangeQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewRangeQuery("")
+	o := p.object(body)
+	o.decode("_name", &q.queryName)
+	name, _, c := o.fieldObject()
+	if c == nil {
+		o.failf(name, "expected an object")
+		return nil, o.done()
+	}
+	q.name = name
+	r := parseRange(c)
+	q.from, q.to = r.from, r.to
+	q.includeLower, q.includeUpper = r.includeLower, r.includeUpper
+	q.timeZone, q.format = r.timeZone, r.format
+	c.decode("boost", &q.boost)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseRegexpQuery(p *DSLParser, body interface{}) (Query, error) {
+	var q RegexpQuery
+	o := p.object(body)
+	name, v, c := o.fieldObject()
+	q.name = name
+	if c == nil {
+		if err := o.convert(v, &q.regexp); err != nil {
+			o.setErr(name, err)
+		}
+	} else {
+		c.decode("value", &q.regexp)
+		c.decode("flags", &q.flags)
+		c.decode("max_determinized_states", &q.maxDeterminizedStates)
+		c.decode("boost", &q.boost)
+		c.decode("rewrite", &q.rewrite)
+		c.decode("name", &q.queryName)
+		c.decode("_name", &q.queryName)
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseSimpleQueryStringQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewSimpleQueryStringQuery("")
+	o := p.object(body)
+	o.decode("query", &q.queryText)
+	var fields []string
+	o.decode("fields", &fields)
+	q.fields, q.fieldBoosts = dslFieldBoosts(fields)
+	o.decode("analyzer", &q.analyzer)
+	o.decode("default_operator", &q.operator)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseTemplateQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewTemplateQuery("")
+	o := p.object(body)
+	var found []string
+	for _, key := range []string{"query", "file", "id"} {
+		if o.has(key) {
+			found = append(found, key)
+			o.decode(key, &q.template)
+			if key != "query" {
+				q.templateType = key
+			}
+		}
+	}
+	if len(found) != 1 {
+		o.failf("", "expected one of query, file, or id; got %v", found)
+	}
+	o.decode("params", &q.vars)
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseTermQuery(p *DSLParser, body interface{}) (Query, error) {
+	var q TermQuery
+	o := p.object(body)
+	name, v, c := o.fieldObject()
+	q.name = name
+	if c == nil {
+		q.value = v
+	} else {
+		c.decode("value", &q.value)
+		c.decode("term", &q.value)
+		c.decode("boost", &q.boost)
+		c.decode("_name", &q.queryName)
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseTermsQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewTermsQuery("")
+	o := p.object(body)
+	o.decode("minimum_should_match", &q.minimumShouldMatch)
+	o.decode("disable_coord", &q.disableCoord)
+	o.decode("boost", &q.boost)
+	o.decode("_name", &q.queryName)
+	name, v := o.field()
+	q.name = name
+	if v != nil {
+		if err := o.convert(v, &q.values); err != nil {
+			o.setErr(name, err)
+		}
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func parseWildcardQuery(p *DSLParser, body interface{}) (Query, error) {
+	q := NewWildcardQuery("", "")
+	o := p.object(body)
+	name, v, c := o.fieldObject()
+	q.name = name
+	if c == nil {
+		if err := o.convert(v, &q.wildcard); err != nil {
+			o.setErr(name, err)
+		}
+	} else {
+		c.decode("wildcard", &q.wildcard)
+		c.decode("value", &q.wildcard)
+		c.decode("boost", &q.boost)
+		c.decode("rewrite", &q.rewrite)
+		c.decode("_name", &q.queryName)
+	}
+	if err := o.done(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
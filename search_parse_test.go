@@ -0,0 +1,506 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sourceJSON returns the serialized source of a builder, decoded into
+// generic values so that two sources can be compared with DeepEqual.
+func sourceJSON(t *testing.T, builder interface {
+	Source() interface{}
+}) (string, interface{}) {
+	data, err := json.Marshal(builder.Source())
+	if err != nil {
+		t.Fatalf("marshaling to JSON failed: %v", err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return string(data), v
+}
+
+// testParseRoundTrip checks that parsing the source of want returns a
+// builder of the same type with the same source.
+func testParseRoundTrip(t *testing.T, i int, want, got interface {
+	Source() interface{}
+}, err error) {
+	if err != nil {
+		t.Errorf("#%d: expected no error; got: %v", i, err)
+		return
+	}
+	if reflect.TypeOf(got) != reflect.TypeOf(want) {
+		t.Errorf("#%d: expected type %T; got: %T", i, want, got)
+	}
+	wantJSON, wantSource := sourceJSON(t, want)
+	gotJSON, gotSource := sourceJSON(t, got)
+	if !reflect.DeepEqual(wantSource, gotSource) {
+		t.Errorf("#%d: expected\n%s\n,got:\n%s", i, wantJSON, gotJSON)
+	}
+}
+
+func TestParseQueryRoundTrip(t *testing.T) {
+	common := NewCommonQuery("body", "nelly the elephant")
+	common.CutoffFrequency(0.001)
+	common.HighFreqOperator("and")
+	common.LowFreqMinMatch(2)
+	common.HighFreqMinMatch("60%")
+	common.Analyzer("standard")
+	common.Boost(2)
+
+	queries := []Query{
+		// #0
+		NewBoolQuery().
+			Must(NewTermQuery("tag", "wow")).
+			MustNot(NewRangeQuery("age").From(10).To(20)).
+			Should(NewTermQuery("tag", "sometag"), NewTermQuery("tag", "sometagtag")).
+			Boost(10).DisableCoord(true).MinimumShouldMatch("1").AdjustPureNegative(false).QueryName("Test"),
+		NewBoostingQuery().Positive(NewTermQuery("tag", "wow")).Negative(NewRangeQuery("age").From(10).To(20)).NegativeBoost(0.2).Boost(1.5),
+		common,
+		NewConstantScoreQuery().Filter(NewTermFilter("user", "kimchy")).Boost(1.2),
+		NewConstantScoreQuery().Query(NewTermQuery("user", "kimchy")),
+		// #5
+		NewCustomFiltersScoreQuery().Query(NewMatchAllQuery()).
+			Filter(NewRangeFilter("age").From(0).To(10)).
+			Filter(NewRangeFilter("age").From(10).To(20)).
+			ScoreMode("first").MaxBoost(10).Script("_score * 2"),
+		NewCustomScoreQuery().Query(NewMatchAllQuery()).Script("_score * doc['my_numeric_field'].value").Lang("mvel").Param("factor", 2).Boost(1.5),
+		NewDisMaxQuery().Query(NewTermQuery("age", 34)).Query(NewTermQuery("age", 35)).Boost(1.2).TieBreaker(0.7),
+		NewFilteredQuery(NewTermQuery("user", "olivere")).Filter(NewTermFilter("tag", "go")).Boost(2),
+		NewFilteredQuery(NewTermQuery("user", "olivere")).Filter(NewTermFilter("tag", "go")).Filter(NewTermFilter("lang", "en")),
+		// #10
+		NewFunctionScoreQuery().
+			Query(NewTermQuery("name.last", "banon")).
+			Add(NewTermFilter("name.last", "banon"), NewFactorFunction().BoostFactor(3)).
+			AddScoreFunc(NewGaussDecayFunction().FieldName("pin.location").Origin("11, 12").Scale("2km").Offset("0km").Decay(0.33)).
+			AddScoreFunc(NewExponentialDecayFunction().FieldName("date").Origin("2013-09-17").Scale("10d").MultiValueMode("avg").Weight(2)).
+			AddScoreFunc(NewLinearDecayFunction().FieldName("price").Origin(0).Scale(20)).
+			AddScoreFunc(NewScriptFunction("_score * doc['my_numeric_field'].value").Lang("groovy").Param("factor", 1.2)).
+			AddScoreFunc(NewFieldValueFactorFunction().Field("popularity").Factor(1.2).Modifier("sqrt").Missing(1)).
+			AddScoreFunc(NewRandomFunction().Seed(42)).
+			AddScoreFunc(NewWeightFactorFunction(4)).
+			ScoreMode("max").BoostMode("replace").MaxBoost(10).Boost(2).MinScore(0.5),
+		NewFunctionScoreQuery().Query(NewTermQuery("name.last", "banon")).AddScoreFunc(NewFieldValueFactorFunction().Field("income").Weight(2.5)),
+		NewFunctionScoreQuery().Filter(NewTermFilter("user", "olivere")).AddScoreFunc(NewWeightFactorFunction(1.5)),
+		NewFuzzyQuery().Name("user").Value("ki").Boost(1.5).Fuzziness(2).PrefixLength(0).MaxExpansions(100).Transpositions(true).QueryName("fq"),
+		NewFuzzyLikeThisQuery().Fields("name.first", "name.last").LikeText("text like this one").MaxQueryTerms(12).Fuzziness("AUTO").PrefixLength(1).IgnoreTF(true).Analyzer("standard").Boost(1.3).FailOnUnsupportedField(false).QueryName("flt"),
+		// #15
+		NewFuzzyLikeThisFieldQuery("name.first").LikeText("text like this one").MaxQueryTerms(12).Fuzziness(0.5).QueryName("fltf"),
+		NewHasChildQuery("blog_tag", NewTermQuery("tag", "something")).Boost(2).ScoreType("sum").MinChildren(1).MaxChildren(10).ShortCircuitCutoff(5).QueryName("hc"),
+		NewHasChildQuery("blog_tag", NewTermQuery("tag", "something")).InnerHit(NewInnerHit().Name("comments").Size(5).Sort("date", false)),
+		NewHasParentQuery("blog", NewTermQuery("tag", "something")).Boost(2).ScoreType("score").QueryName("hp").InnerHit(NewInnerHit().Name("blogs")),
+		NewIdsQuery("my_type").Ids("1", "4", "100").Boost(10.5).QueryName("my_query"),
+		// #20
+		NewIdsQuery("type1", "type2").Ids("1"),
+		NewMatchQuery("message", "this is a test").Operator("and").Analyzer("whitespace").Boost(2).Fuzziness("AUTO").PrefixLength(1).MaxExpansions(10).MinimumShouldMatch("75%").Rewrite("constant_score_auto").FuzzyRewrite("top_terms_10").Lenient(true).FuzzyTranspositions(false).ZeroTermsQuery("all").CutoffFrequency(0.001).QueryName("mq"),
+		NewMatchPhraseQuery("message", "this is a test").Slop(2),
+		NewMatchPhrasePrefixQuery("message", "this is a test").MaxExpansions(10),
+		NewMatchAllQuery().Boost(3.14).NormsField("title"),
+		// #25
+		NewMoreLikeThisQuery("Golang topic").Field("message").Fields("title").StopWords("a", "the").MinimumShouldMatch("30%").
+			MinTermFreq(2).MaxQueryTerms(25).MinDocFreq(5).MaxDocFreq(100).MinWordLen(2).MaxWordLen(10).
+			BoostTerms(1).Analyzer("standard").Boost(1.5).FailOnUnsupportedField(true).QueryName("mlt").Include(true),
+		NewMoreLikeThisQuery("").Ids("1", "2").Docs(
+			NewMoreLikeThisQueryItem().Index("twitter").Type("tweet").Id("1").Routing("r").Version(3).VersionType("external").Fields("message"),
+			NewMoreLikeThisQueryItem().Doc(map[string]interface{}{"message": "Hello"}).FetchSourceContext(NewFetchSourceContext(true).Include("message")),
+			NewMoreLikeThisQueryItem().LikeText("some text"),
+		),
+		NewMoreLikeThisFieldQuery("message", "this is a test").PercentTermsToMatch(0.3).MinTermFreq(1).MaxQueryTerms(12).StopWords("a", "the").
+			MinDocFreq(5).MaxDocFreq(100).MinWordLen(2).MaxWordLen(10).BoostTerms(2).Boost(1.5).Analyzer("standard").FailOnUnsupportedField(false),
+		NewMultiMatchQuery("this is a test", "subject", "message").FieldWithBoost("title", 3).Type("best_fields").Operator("and").Analyzer("standard").
+			Boost(2).Slop(1).Fuzziness("AUTO").PrefixLength(1).MaxExpansions(10).MinimumShouldMatch("50%").Rewrite("r").FuzzyRewrite("fr").
+			UseDisMax(true).TieBreaker(0.3).Lenient(true).CutoffFrequency(0.01).ZeroTermsQuery("none").QueryName("mm"),
+		NewNestedQuery("obj1").Query(NewBoolQuery().Must(NewTermQuery("obj1.name", "blue"))).ScoreMode("avg").Boost(2).QueryName("nq").InnerHit(NewInnerHit().Name("obj").From(5).Size(3)),
+		// #30
+		NewNestedQuery("obj1").Filter(NewTermFilter("obj1.name", "blue")),
+		NewPrefixQuery("user", "ki"),
+		NewPrefixQuery("user", "ki").Boost(2).Rewrite("constant_score_auto").QueryName("pq"),
+		NewQueryStringQuery("this AND that OR thus").DefaultField("content").Field("title").FieldWithBoost("body", 2).UseDisMax(false).TieBreaker(0.5).
+			DefaultOperator("AND").Analyzer("standard").QuoteAnalyzer("quote").AutoGeneratePhraseQueries(true).MaxDeterminizedState(100).
+			AllowLeadingWildcard(false).LowercaseExpandedTerms(true).EnablePositionIncrements(true).FuzzyMinSim(0.5).FuzzyMaxExpansions(10).
+			FuzzyRewrite("fr").PhraseSlop(2).AnalyzeWildcard(true).Rewrite("r").MinimumShouldMatch("2").Boost(2).QuoteFieldSuffix(".exact").
+			Lenient(true).TimeZone("+01:00"),
+		NewRangeQuery("postDate").From("2010-03-01").To("2010-04-01").TimeZone("+1:00").Format("yyyy-MM-dd").Boost(3).QueryName("my_query"),
+		// #35
+		NewRangeQuery("age").Gt(10).Lte(20),
+		NewRangeQuery("age").Gte(10),
+		NewRegexpQuery("name.first", "s.*y").Flags("INTERSECTION|COMPLEMENT|EMPTY").MaxDeterminizedStates(20000).Boost(1.2).Rewrite("constant_score").QueryName("my_query_name"),
+		NewSimpleQueryStringQuery("\"fried eggs\" +(eggplant | potato) -frittata").Field("body").FieldWithBoost("title", 5).Analyzer("snowball").DefaultOperator("AND"),
+		NewTemplateQuery("{\"match\":{\"text\":\"{{query_string}}\"}}").Var("query_string", "all about search"),
+		// #40
+		NewTemplateQuery("storedTemplate").TemplateType("file").Var("query_string", "all about search"),
+		NewTemplateQuery("indexedTemplate").TemplateType("id"),
+		NewTermQuery("user", "ki"),
+		NewTermQuery("user", "ki").Boost(2).QueryName("my_tq"),
+		NewTermsQuery("user", "ki", "ko").MinimumShouldMatch("1").DisableCoord(true).Boost(2).QueryName("my_tq"),
+		// #45
+		NewWildcardQuery("user", "ki*y??").Boost(1.2).Rewrite("scoring_boolean").QueryName("my_query_name"),
+		NewWildcardQuery("user", "ki*"),
+	}
+	for i, q := range queries {
+		got, err := ParseQuery(q)
+		testParseRoundTrip(t, i, q, got, err)
+	}
+}
+
+func TestParseFilterRoundTrip(t *testing.T) {
+	filters := []Filter{
+		// #0
+		NewAndFilter(NewTermFilter("tag", "wow"), NewRangeFilter("age").From(10).To(20)).Cache(true).CacheKey("MyAndFilter").FilterName("MyFilterName"),
+		NewBoolFilter().
+			Must(NewTermFilter("tag", "wow")).
+			MustNot(NewRangeFilter("age").From(10).To(20)).
+			Should(NewTermFilter("tag", "sometag"), NewTermFilter("tag", "sometagtag")).
+			FilterName("MyFilterName").Cache(true).CacheKey("MyCacheKey"),
+		NewExistsFilter("user").FilterName("_my_filter"),
+		NewGeoDistanceFilter("pin.location").Lat(40).Lon(-70).Distance("200km").DistanceType("plane").OptimizeBbox("memory").Cache(true).CacheKey("k").FilterName("gd"),
+		NewGeoDistanceFilter("pin.location").GeoHash("drm3btev3e86").Distance("12km"),
+		// #5
+		NewGeoPolygonFilter("person.location").AddPoint(&GeoPoint{Lat: 40, Lon: -70}).AddPoint(&GeoPoint{Lat: 30, Lon: -80}).AddPoint(&GeoPoint{Lat: 20, Lon: -90}).Cache(true).CacheKey("k").FilterName("gp"),
+		NewHasChildFilter("blog_tag").Query(NewTermQuery("tag", "something")).FilterName("hc").Cache(true).CacheKey("k").ShortCircuitCutoff(8192).MinChildren(2).MaxChildren(10),
+		NewHasChildFilter("blog_tag").Filter(NewTermFilter("tag", "something")).InnerHit(NewInnerHit().Name("comments").Size(10)),
+		NewHasParentFilter("blog").Query(NewTermQuery("tag", "something")).FilterName("hp").Cache(true).CacheKey("k"),
+		NewHasParentFilter("blog").Filter(NewTermFilter("tag", "something")).InnerHit(NewInnerHit().Name("blogs")),
+		// #10
+		NewIdsFilter("my_type").Ids("1", "4", "100").FilterName("my_query"),
+		NewIdsFilter("type1", "type2").Ids("1"),
+		NewLimitFilter(42),
+		NewMatchAllFilter(),
+		NewMissingFilter("user").FilterName("_my_filter").NullValue(true).Existence(false),
+		// #15
+		NewNestedFilter("obj1").Query(NewBoolQuery().Must(NewTermQuery("obj1.name", "blue"))).Join(false).Cache(true).CacheKey("k").FilterName("nf"),
+		NewNestedFilter("obj1").Filter(NewTermFilter("obj1.name", "blue")).InnerHit(NewInnerHit().Name("obj").Size(3)),
+		NewNotFilter(NewRangeFilter("postDate").From("2010-03-01").To("2010-04-01")).Cache(true).CacheKey("MyNotFilter").FilterName("MyFilterName"),
+		NewOrFilter(NewTermFilter("tag", "wow"), NewRangeFilter("age").From(10).To(20)).Cache(true).CacheKey("MyOrFilter").FilterName("MyFilterName"),
+		NewPrefixFilter("user", "ki").Cache(true).CacheKey("MyPrefixFilter").FilterName("MyFilterName"),
+		// #20
+		NewQueryFilter(NewQueryStringQuery("this AND that OR thus")),
+		NewQueryFilter(NewQueryStringQuery("this AND that OR thus")).FilterName("MyFilterName").Cache(true),
+		NewRangeFilter("postDate").From("2010-03-01").To("2010-04-01").TimeZone("+1:00").Format("yyyy-MM-dd").Cache(true).CacheKey("MyAndFilter").FilterName("MyFilterName").Execution("index"),
+		NewRangeFilter("age").Gt(10).Lt(20),
+		NewRegexpFilter("name.first", "s.*y"),
+		// #25
+		NewRegexpFilter("name.first", "s.*y").Flags("INTERSECTION|COMPLEMENT|EMPTY").MaxDeterminizedStates(20000).FilterName("test").Cache(true).CacheKey("key"),
+		NewTermFilter("user", "ki").Cache(true).CacheKey("MyTermFilter").FilterName("MyFilterName"),
+		NewTermsFilter("user", "kimchy", "elasticsearch").Execution("bool").Cache(true).CacheKey("MyTermsFilter").FilterName("MyFilterName"),
+		NewTypeFilter("my_type"),
+	}
+	for i, f := range filters {
+		got, err := ParseFilter(f)
+		testParseRoundTrip(t, i, f, got, err)
+	}
+}
+
+func TestParseAggregationRoundTrip(t *testing.T) {
+	aggs := []Aggregation{
+		// #0
+		NewAvgAggregation().Field("grade").Format("0000.0").SubAggregation("max", NewMaxAggregation().Field("grade")),
+		NewAvgAggregation().Script("doc['grade'].value").Lang("groovy").Param("factor", 1.2),
+		NewCardinalityAggregation().Field("author.hash").PrecisionThreshold(100).Rehash(true).Format("0000.0"),
+		NewChildrenAggregation().Type("answer").SubAggregation("top-names", NewTermsAggregation().Field("owner.display_name").Size(10)),
+		NewDateHistogramAggregation().Field("date").Interval("month").Format("YYYY-MM").MinDocCount(0).OrderByCountDesc().
+			PreZone("-01:00").PostZone("+01:00").PreZoneAdjustLargeInterval(true).PreOffset(1).PostOffset(2).Factor(1000).
+			ExtendedBoundsMin("2012-01-01").ExtendedBoundsMax("2012-12-31"),
+		// #5
+		NewDateHistogramAggregation().ScriptFile("my_script").Interval("1d").SubAggregation("avg", NewAvgAggregation().Field("price")),
+		NewDateRangeAggregation().Field("created_at").Keyed(true).Unmapped(false).Format("MM-yyy").
+			Lt("2012-01-01").Between("2012-01-01", "2013-01-01").GtWithKey("recent", "now-10M/M"),
+		NewExtendedStatsAggregation().Field("grade").Format("0.00"),
+		NewFilterAggregation().Filter(NewRangeFilter("stock").Gt(0)).SubAggregation("avg_price", NewAvgAggregation().Field("price")),
+		NewFiltersAggregation().Filters(NewTermFilter("body", "error"), NewTermFilter("body", "warning")).SubAggregation("avg_price", NewAvgAggregation().Field("price")),
+		// #10
+		NewFiltersAggregation().FilterWithName("errors", NewTermFilter("body", "error")).FilterWithName("warnings", NewTermFilter("body", "warning")),
+		NewGeoBoundsAggregation().Field("location").WrapLongitude(true),
+		NewGeoDistanceAggregation().Field("location").Point("52.3760, 4.894").Unit("km").DistanceType("plane").
+			AddUnboundedFrom(100).AddRange(100, 300).AddUnboundedToWithKey("far", 300),
+		NewGeoHashGridAggregation().Field("location").Precision(5).Size(10).ShardSize(100).Meta(map[string]interface{}{"name": "grid"}).
+			SubAggregation("avg", NewAvgAggregation().Field("price")),
+		NewGlobalAggregation().SubAggregation("avg_price", NewAvgAggregation().Field("price")),
+		// #15
+		NewHistogramAggregation().Field("price").Interval(50).MinDocCount(1).OrderByKeyAsc().ExtendedBoundsMin(0).ExtendedBoundsMax(500),
+		NewMaxAggregation().Field("price").Format("00000.00"),
+		NewMinAggregation().Field("price").Script("doc['price'].value * 1.2").ScriptFile("f").Lang("groovy"),
+		NewMissingAggregation().Field("price").SubAggregation("avg", NewAvgAggregation().Field("price")),
+		NewNestedAggregation().Path("resellers").SubAggregation("min_price", NewMinAggregation().Field("resellers.price")),
+		// #20
+		NewPercentileRanksAggregation().Field("load_time").Values(15, 30).Compression(200).Estimator("t-digest").Format("0.0"),
+		NewPercentilesAggregation().Field("load_time").Percentiles(1, 5.0, 95, 99.9).Compression(200).Estimator("t-digest"),
+		NewRangeAggregation().Field("price").Keyed(true).Unmapped(true).
+			AddUnboundedFromWithKey("cheap", 50).AddRangeWithKey("average", 50, 100).AddUnboundedTo(100.5),
+		NewReverseNestedAggregation().Path("comments").Meta(map[string]interface{}{"level": 1}).
+			SubAggregation("top_tags", NewTermsAggregation().Field("tags")),
+		NewSignificantTermsAggregation().Field("crime_type").MinDocCount(10).ShardMinDocCount(5).RequiredSize(20).ShardSize(100).
+			BackgroundFilter(NewTermFilter("city", "London")).ExecutionHint("map"),
+		// #25
+		NewStatsAggregation().Field("grade").Format("0000.0"),
+		NewSumAggregation().Field("price").Param("factor", 2),
+		NewTermsAggregation().Field("gender").Size(10).ShardSize(100).RequiredSize(5).MinDocCount(1).ShardMinDocCount(1).
+			ShowTermDocCountError(true).CollectionMode("breadth_first").ValueType("string").OrderByTermAsc().
+			Include("water_.*").ExcludeWithFlags("water_ex.*", 2).ExecutionHint("map"),
+		NewTermsAggregation().Field("tags").IncludeTerms("go", "elasticsearch").ExcludeTerms("java").
+			OrderByAggregation("avg_price", false).SubAggregation("avg_price", NewAvgAggregation().Field("price")),
+		NewTopHitsAggregation().Sort("last_activity_date", false).FetchSourceContext(NewFetchSourceContext(true).Include("title")).
+			Size(1).From(2).TrackScores(true).Explain(true).Version(true).FieldDataFields("tags").
+			ScriptField(NewScriptField("price2", "doc['price'].value * 2", "groovy", map[string]interface{}{"factor": 2})),
+		// #30
+		NewTopHitsAggregation().NoFields().FetchSource(false),
+		NewValueCountAggregation().Field("grade").Format("0"),
+	}
+	for i, a := range aggs {
+		got, err := ParseAggregation(a)
+		testParseRoundTrip(t, i, a, got, err)
+	}
+}
+
+func TestParseRawStringQuery(t *testing.T) {
+	q, err := ParseQuery(NewRawStringQuery(`{"match_all":{}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := q.(MatchAllQuery); !ok {
+		t.Errorf("expected MatchAllQuery; got: %T", q)
+	}
+}
+
+func TestParseQueryAlternativeForms(t *testing.T) {
+	tests := []struct {
+		Source   string
+		Expected string
+	}{
+		// #0
+		{
+			`{"match":{"message":"this is a test"}}`,
+			`{"match":{"message":{"query":"this is a test"}}}`,
+		},
+		// #1
+		{
+			`{"range":{"age":{"gte":10,"lt":20}}}`,
+			`{"range":{"age":{"from":10,"include_lower":true,"include_upper":false,"to":20}}}`,
+		},
+		// #2
+		{
+			`{"fuzzy":{"user":"ki"}}`,
+			`{"fuzzy":{"user":{"value":"ki"}}}`,
+		},
+		// #3
+		{
+			`{"common":{"body":{"query":"nelly","minimum_should_match":2}}}`,
+			`{"common":{"body":{"minimum_should_match":{"low_freq":2},"query":"nelly"}}}`,
+		},
+		// #4
+		{
+			`{"multi_match":{"query":"go","fields":["title^3","body"]}}`,
+			`{"multi_match":{"fields":["title^3.000000","body"],"query":"go"}}`,
+		},
+		// #5
+		{
+			`{"filtered":{"filter":{"not":{"term":{"user":"olivere"}}}}}`,
+			`{"filtered":{"filter":{"not":{"filter":{"term":{"user":"olivere"}}}}}}`,
+		},
+		// #6
+		{
+			`{"constant_score":{"filter":{"and":[{"term":{"a":1}},{"term":{"b":2.5}}]}}}`,
+			`{"constant_score":{"filter":{"and":{"filters":[{"term":{"a":1}},{"term":{"b":2.5}}]}}}}`,
+		},
+		// #7
+		{
+			`{"term":{"id":12345678901234567890}}`,
+			`{"term":{"id":12345678901234567890}}`,
+		},
+		// #8
+		{
+			`{"terms":{"id":[9223372036854775807,9223372036854775809,1e3]}}`,
+			`{"terms":{"id":[9223372036854775807,9223372036854775809,1000]}}`,
+		},
+	}
+	for i, test := range tests {
+		q, err := ParseQuery(test.Source)
+		if err != nil {
+			t.Errorf("#%d: expected no error; got: %v", i, err)
+			continue
+		}
+		data, err := json.Marshal(q.Source())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != test.Expected {
+			t.Errorf("#%d: expected\n%s\n,got:\n%s", i, test.Expected, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		Source string
+		Path   string
+		Error  string
+	}{
+		// #0
+		{`{"foo":{}}`, "foo", `unknown query "foo"`},
+		// #1
+		{`{"bool":{"must":[{"term":{"a":1}},{"foo":{}}]}}`, "bool.must[1].foo", `unknown query "foo"`},
+		// #2
+		{`{"bool":{"mustt":{"term":{"a":1}}}}`, "bool.mustt", `unknown parameter "mustt"`},
+		// #3
+		{`{"filtered":{"filter":{"bar":{}}}}`, "filtered.filter.bar", `unknown filter "bar"`},
+		// #4
+		{`{"bool":{"boost":"high"}}`, "bool.boost", "expected a number; got string"},
+		// #5
+		{`{"term":{"a":1,"b":2}}`, "term", "expected a single field; got [a b]"},
+		// #6
+		{`{"term":{"a":1},"match_all":{}}`, "", "expected a single clause; got [match_all term]"},
+		// #7
+		{`{"range":{"age":{"from":1,"too":2}}}`, "range.age.too", `unknown parameter "too"`},
+		// #8
+		{`{"function_score":{"functions":[{"filter":{"term":{"a":1}}}]}}`, "function_score.functions[0]", "missing score function"},
+		// #9
+		{`{"has_child":{"type":"comment","query":{"match_all":{}},"inner_hits":{"highlight":{}}}}`, "has_child.inner_hits.highlight", "highlight is not supported"},
+		// #10
+		{`{"term":`, "", "unexpected EOF"},
+		// #11
+		{`{"bool":{"boost":1e400}}`, "bool.boost", "number 1e400 out of range"},
+	}
+	for i, test := range tests {
+		_, err := ParseQuery(test.Source)
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+			continue
+		}
+		e, ok := err.(*DSLError)
+		if !ok {
+			t.Errorf("#%d: expected *DSLError; got: %T", i, err)
+			continue
+		}
+		if got, want := e.Path, test.Path; got != want {
+			t.Errorf("#%d: expected path %q; got: %q", i, want, got)
+		}
+		if got, want := e.Err.Error(), test.Error; got != want {
+			t.Errorf("#%d: expected error %q; got: %q", i, want, got)
+		}
+	}
+}
+
+func TestParseAggregationErrors(t *testing.T) {
+	tests := []struct {
+		Source string
+		Error  string
+	}{
+		// #0
+		{`{"foo":{}}`, `elastic: invalid query DSL at foo: unknown aggregation "foo"`},
+		// #1
+		{`{"terms":{"field":"a"},"avg":{"field":"b"}}`, `elastic: invalid query DSL at terms: expected a single aggregation type; got "avg" and "terms"`},
+		// #2
+		{`{"terms":{"field":"a"},"aggs":{"x":{"avg":{"fields":"b"}}}}`, `elastic: invalid query DSL at aggs.x.avg.fields: unknown parameter "fields"`},
+		// #3
+		{`{"avg":{"field":"b"},"meta":{"a":1}}`, `elastic: invalid query DSL at avg: meta is not supported`},
+		// #4
+		{`{"aggs":{}}`, `elastic: invalid query DSL: missing aggregation type`},
+	}
+	for i, test := range tests {
+		_, err := ParseAggregation(test.Source)
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+			continue
+		}
+		if got, want := err.Error(), test.Error; got != want {
+			t.Errorf("#%d: expected %q; got: %q", i, want, got)
+		}
+	}
+}
+
+func TestParseSearchSource(t *testing.T) {
+	body := `{
+		"from": 10,
+		"size": 20,
+		"query": {"filtered": {"query": {"match": {"message": {"query": "golang"}}}, "filter": {"term": {"user": "olivere"}}}},
+		"post_filter": {"term": {"tag": "go"}},
+		"sort": ["_score", {"created": "desc"}, {"user": {"order": "asc", "missing": "_last"}}],
+		"_source": {"includes": ["message"], "excludes": []},
+		"aggs": {"users": {"terms": {"field": "user"}, "aggs": {"latest": {"top_hits": {"size": 1}}}}},
+		"indices_boost": {"twitter": 2},
+		"min_score": 0.5,
+		"version": true
+	}`
+	src, err := ParseSearchSource(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Modify the saved search
+	src = src.Size(50).PostFilter(NewAndFilter(src.postFilter, NewTermFilter("lang", "en")))
+
+	data, err := json.Marshal(src.Source())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	expected := `{"_source":{"excludes":[],"includes":["message"]},"aggregations":{"users":{"aggregations":{"latest":{"top_hits":{"size":1}}},"terms":{"field":"user"}}},"from":10,"indices_boost":{"twitter":2},"min_score":0.5,"post_filter":{"and":{"filters":[{"term":{"tag":"go"}},{"term":{"lang":"en"}}]}},"query":{"filtered":{"filter":{"term":{"user":"olivere"}},"query":{"match":{"message":{"query":"golang"}}}}},"size":50,"sort":[{"_score":{}},{"created":{"order":"desc"}},{"user":{"missing":"_last","order":"asc"}}],"version":true}`
+	if got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+
+	if _, err := ParseSearchSource(`{"highlight":{"fields":{"message":{}}}}`); err == nil {
+		t.Errorf("expected error for unsupported highlight")
+	}
+}
+
+type parseTestGeoShapeFilter struct {
+	field string
+	shape map[string]interface{}
+}
+
+func (f parseTestGeoShapeFilter) Source() interface{} {
+	return map[string]interface{}{
+		"geo_shape": map[string]interface{}{
+			f.field: map[string]interface{}{"shape": f.shape},
+		},
+	}
+}
+
+func TestParseWithCustomParser(t *testing.T) {
+	p := NewDSLParser().RegisterFilter("geo_shape", func(p *DSLParser, body interface{}) (Filter, error) {
+		m, ok := body.(map[string]interface{})
+		if !ok || len(m) != 1 {
+			return nil, &DSLError{Err: fmt.Errorf("expected a single field")}
+		}
+		for field, v := range m {
+			params, _ := v.(map[string]interface{})
+			shape, _ := params["shape"].(map[string]interface{})
+			return parseTestGeoShapeFilter{field: field, shape: shape}, nil
+		}
+		return nil, nil
+	})
+
+	source := `{"bool":{"must":{"geo_shape":{"location":{"shape":{"coordinates":[[13,53],[14,52]],"type":"envelope"}}}}}}`
+	f, err := p.ParseFilter(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(f.Source())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != source {
+		t.Errorf("expected\n%s\n,got:\n%s", source, got)
+	}
+
+	// The default parser is not affected
+	_, err = ParseFilter(source)
+	if err == nil || !strings.Contains(err.Error(), `unknown filter "geo_shape"`) {
+		t.Errorf("expected unknown filter error; got: %v", err)
+	}
+
+	// Errors from custom parsers are prefixed with their location
+	_, err = p.ParseFilter(`{"not":{"filter":{"geo_shape":{}}}}`)
+	if e, ok := err.(*DSLError); !ok || e.Path != "not.filter.geo_shape" {
+		t.Errorf("expected error at not.filter.geo_shape; got: %v", err)
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StructMapping generates the mapping of a document type from a Go struct.
+//
+// The names of the fields are taken from the json struct tag, just like
+// encoding/json does. The type of each field is derived from its Go type:
+// strings are mapped to string, integers to long/integer/short/byte,
+// floats to double/float, bools to boolean, time.Time to date,
+// GeoPoint to geo_point, and []byte to binary. Structs are mapped to
+// objects, slices of structs to nested documents. Fields of type
+// interface{}, maps, and json.RawMessage are left to dynamic mapping.
+//
+// Use the elastic struct tag to override the type and to set additional
+// mapping parameters, e.g.:
+//
+//	type Tweet struct {
+//		User     string    `json:"user" elastic:"type=string,index=not_analyzed"`
+//		Message  string    `json:"message" elastic:"analyzer=english"`
+//		Created  time.Time `json:"created" elastic:"format=dateOptionalTime"`
+//		Comments []Comment `json:"comments" elastic:"type=object"`
+//		Internal string    `json:"internal" elastic:"-"`
+//	}
+//
+// Parameters without a value, e.g. elastic:"store", are set to true.
+// Use elastic:"-" to omit a field from the mapping. Metadata like
+// elastic:"_id" (see Repository) is not part of the mapping.
+//
+// The generated mapping can be passed to PutMappingService.BodyJson.
+// Use Check to compare it with the output of GetMappingService.
+type StructMapping struct {
+	typ     string
+	value   reflect.Type
+	dynamic string
+}
+
+// NewStructMapping creates a new StructMapping for the given document
+// type and a struct value (or pointer to a struct).
+func NewStructMapping(typ string, v interface{}) *StructMapping {
+	return &StructMapping{
+		typ:   typ,
+		value: reflect.TypeOf(v),
+	}
+}
+
+// Dynamic sets the dynamic mapping behavior of the type,
+// i.e. "true", "false", or "strict".
+func (m *StructMapping) Dynamic(dynamic string) *StructMapping {
+	m.dynamic = dynamic
+	return m
+}
+
+// Source returns the mapping of the type, e.g.
+// {"tweet":{"properties":{"user":{"type":"string"}}}}.
+func (m *StructMapping) Source() (map[string]interface{}, error) {
+	properties, err := m.Properties()
+	if err != nil {
+		return nil, err
+	}
+	mapping := map[string]interface{}{
+		"properties": properties,
+	}
+	if m.dynamic != "" {
+		mapping["dynamic"] = m.dynamic
+	}
+	return map[string]interface{}{
+		m.typ: mapping,
+	}, nil
+}
+
+// Properties returns the properties of the mapping, i.e. the mapping
+// of all fields of the struct.
+func (m *StructMapping) Properties() (map[string]interface{}, error) {
+	if m.typ == "" {
+		return nil, fmt.Errorf("elastic: missing type for struct mapping")
+	}
+	t := m.value
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("elastic: struct mapping requires a struct; got %v", m.value)
+	}
+	return structMappingProperties(t, nil)
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	geoPointType   = reflect.TypeOf(GeoPoint{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// structMappingProperties returns the properties of the struct type t.
+// Parents is used to detect recursive types.
+func structMappingProperties(t reflect.Type, parents []reflect.Type) (map[string]interface{}, error) {
+	for _, parent := range parents {
+		if parent == t {
+			return nil, fmt.Errorf("elastic: struct mapping of recursive type %v", t)
+		}
+	}
+	parents = append(parents, t)
+
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+		name, ok := structMappingFieldName(field)
+		if !ok {
+			continue
+		}
+		params, err := parseStructMappingTag(field.Tag.Get("elastic"))
+		if err != nil {
+			return nil, fmt.Errorf("elastic: invalid tag of field %s.%s: %v", t.Name(), field.Name, err)
+		}
+		if params == nil {
+			continue
+		}
+
+		// Embedded structs without a json name are inlined
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && field.Tag.Get("json") == "" && ft.Kind() == reflect.Struct {
+			inner, err := structMappingProperties(ft, parents)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range inner {
+				properties[k] = v
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue // unexported embedded non-struct
+		}
+
+		mapping, err := structMappingField(ft, params, parents)
+		if err != nil {
+			return nil, fmt.Errorf("elastic: field %s.%s: %v", t.Name(), field.Name, err)
+		}
+		if mapping != nil {
+			properties[name] = mapping
+		}
+	}
+	return properties, nil
+}
+
+// structMappingFieldName returns the name of the field in the JSON
+// document, or false if the field is not serialized.
+func structMappingFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag != "" {
+		return tag, true
+	}
+	return field.Name, true
+}
+
+// structMappingField returns the mapping of a field of type t with the
+// parameters from the elastic struct tag. It returns nil if the field
+// should be mapped dynamically.
+func structMappingField(t reflect.Type, params map[string]interface{}, parents []reflect.Type) (map[string]interface{}, error) {
+	mapping := make(map[string]interface{})
+	for k, v := range params {
+		mapping[k] = v
+	}
+	typ, _ := params["type"].(string)
+
+	// Slices are mapped like their elements, except for []byte
+	isSlice := false
+	if t != rawMessageType && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8 {
+		isSlice = true
+		t = t.Elem()
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+
+	if typ != "" && typ != "object" && typ != "nested" {
+		// Explicit type, e.g. geo_shape for a struct
+		return mapping, nil
+	}
+
+	switch t {
+	case timeType:
+		mapping["type"] = "date"
+		return mapping, nil
+	case geoPointType:
+		mapping["type"] = "geo_point"
+		return mapping, nil
+	case rawMessageType:
+		if len(params) == 0 {
+			return nil, nil
+		}
+		return mapping, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		mapping["type"] = "string"
+	case reflect.Bool:
+		mapping["type"] = "boolean"
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		mapping["type"] = "long"
+	case reflect.Int32, reflect.Uint16:
+		mapping["type"] = "integer"
+	case reflect.Int16, reflect.Uint8:
+		mapping["type"] = "short"
+	case reflect.Int8:
+		mapping["type"] = "byte"
+	case reflect.Float32:
+		mapping["type"] = "float"
+	case reflect.Float64:
+		mapping["type"] = "double"
+	case reflect.Slice, reflect.Array:
+		// []byte
+		mapping["type"] = "binary"
+	case reflect.Struct:
+		properties, err := structMappingProperties(t, parents)
+		if err != nil {
+			return nil, err
+		}
+		mapping["properties"] = properties
+		if typ == "" && isSlice {
+			mapping["type"] = "nested"
+		} else if typ == "object" {
+			// Elasticsearch omits the type of objects
+			delete(mapping, "type")
+		}
+	case reflect.Map:
+		if len(params) == 0 {
+			return nil, nil
+		}
+		if typ == "" {
+			mapping["type"] = "object"
+		}
+	case reflect.Interface:
+		if len(params) == 0 {
+			return nil, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %v", t)
+	}
+	return mapping, nil
+}
+
+// parseStructMappingTag parses the elastic struct tag, e.g.
+// "type=string,index=not_analyzed". It returns nil if the field
+// should be omitted.
+func parseStructMappingTag(tag string) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	tag = strings.TrimSpace(tag)
+	if tag == "-" {
+		return nil, nil
+	}
+	if tag == "" {
+		return params, nil
+	}
+	for _, part := range strings.Split(tag, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			return nil, fmt.Errorf("missing name of parameter in %q", tag)
+		}
+		if strings.HasPrefix(key, "_") {
+			// Metadata like _id, see Repository
+			continue
+		}
+		if len(kv) == 1 {
+			params[key] = true
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+		if value == "true" || value == "false" {
+			params[key] = value == "true"
+		} else if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			params[key] = n
+		} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+			params[key] = f
+		} else {
+			params[key] = value
+		}
+	}
+	return params, nil
+}
+
+// -- Compatibility check --
+
+// MappingConflict describes a field whose mapping in an index differs
+// from the generated mapping.
+type MappingConflict struct {
+	Index    string      // name of the index
+	Field    string      // path to the field, e.g. "user.name"
+	Param    string      // mapping parameter, e.g. "type" or "analyzer"
+	Expected interface{} // value in the generated mapping
+	Actual   interface{} // value in the index, or nil if unset
+}
+
+// String returns a string representation of the conflict.
+func (c *MappingConflict) String() string {
+	return fmt.Sprintf("%s: field %s: %s is %v, expected %v", c.Index, c.Field, c.Param, c.Actual, c.Expected)
+}
+
+// MappingCheckResult is the result of StructMapping.Check.
+type MappingCheckResult struct {
+	// Conflicts lists the parameters of fields that differ between the
+	// generated mapping and the mapping in the index. These conflicts
+	// cannot be resolved without reindexing.
+	Conflicts []*MappingConflict
+	// Missing lists fields (as "index/field") that are not yet mapped in
+	// the index. These can be added by putting the generated mapping.
+	Missing []string
+}
+
+// Compatible returns true if the generated mapping can be put into the
+// checked indices without conflicts.
+func (r *MappingCheckResult) Compatible() bool {
+	return len(r.Conflicts) == 0
+}
+
+// structMappingDefaults are the values Elasticsearch assumes for
+// parameters that are omitted from the output of GetMappingService.
+// See structMappingDefault for parameters that depend on the type.
+var structMappingDefaults = map[string]interface{}{
+	"store":          false,
+	"doc_values":     false,
+	"include_in_all": true,
+	"dynamic":        true,
+}
+
+// Check compares the generated mapping with the mappings returned by
+// GetMappingService, e.g.:
+//
+//	mappings, err := client.GetMapping().Index("twitter").Type("tweet").Do()
+//	...
+//	res, err := NewStructMapping("tweet", Tweet{}).Check(mappings)
+//	...
+//	if !res.Compatible() {
+//		for _, c := range res.Conflicts {
+//			fmt.Println(c)
+//		}
+//	}
+func (m *StructMapping) Check(mappings map[string]interface{}) (*MappingCheckResult, error) {
+	properties, err := m.Properties()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &MappingCheckResult{}
+	indices := make([]string, 0, len(mappings))
+	for index := range mappings {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	for _, index := range indices {
+		var actual map[string]interface{}
+		if im, ok := mappings[index].(map[string]interface{}); ok {
+			if types, ok := im["mappings"].(map[string]interface{}); ok {
+				if tm, ok := types[m.typ].(map[string]interface{}); ok {
+					actual, _ = tm["properties"].(map[string]interface{})
+				}
+			}
+		}
+		checkStructMappingProperties(ret, index, "", properties, actual)
+	}
+	return ret, nil
+}
+
+// checkStructMappingProperties compares the expected with the actual
+// properties and records differences in ret.
+func checkStructMappingProperties(ret *MappingCheckResult, index, prefix string, expected, actual map[string]interface{}) {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := prefix + name
+		exp, _ := expected[name].(map[string]interface{})
+		act, found := actual[name].(map[string]interface{})
+		if !found {
+			ret.Missing = append(ret.Missing, index+"/"+path)
+			continue
+		}
+
+		params := make([]string, 0, len(exp))
+		for param := range exp {
+			params = append(params, param)
+		}
+		sort.Strings(params)
+		for _, param := range params {
+			want := exp[param]
+			if param == "properties" {
+				wantProps, _ := want.(map[string]interface{})
+				actProps, _ := act["properties"].(map[string]interface{})
+				checkStructMappingProperties(ret, index, path+".", wantProps, actProps)
+				continue
+			}
+			got, found := act[param]
+			if !found {
+				got = structMappingDefault(param, act)
+			}
+			if !structMappingEqual(want, got) {
+				var actualValue interface{}
+				if found {
+					actualValue = got
+				}
+				ret.Conflicts = append(ret.Conflicts, &MappingConflict{
+					Index:    index,
+					Field:    path,
+					Param:    param,
+					Expected: want,
+					Actual:   actualValue,
+				})
+			}
+		}
+	}
+}
+
+// structMappingDefault returns the value Elasticsearch assumes for
+// param if it is omitted from the mapping act of a field. Only string
+// fields are analyzed by default; numeric, date and boolean fields
+// are not_analyzed.
+func structMappingDefault(param string, act map[string]interface{}) interface{} {
+	switch param {
+	case "type":
+		if act["properties"] != nil {
+			return "object"
+		}
+	case "index":
+		if typ, ok := act["type"].(string); ok && typ != "string" {
+			return "not_analyzed"
+		}
+		return "analyzed"
+	}
+	return structMappingDefaults[param]
+}
+
+// structMappingEqual compares two parameter values, regardless of
+// whether they are serialized as strings, numbers, or booleans.
+func structMappingEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
@@ -0,0 +1,182 @@
+// Copyright 2012-present Oliver Eilhard. All rights reserved.
+// Use of this source code is governed by a MIT-license.
+// See http://olivere.mit-license.org/license.txt for details.
+
+package elastic
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type structMappingComment struct {
+	User    string    `json:"user" elastic:"index=not_analyzed"`
+	Comment string    `json:"comment"`
+	Created time.Time `json:"created"`
+}
+
+type structMappingBase struct {
+	Id string `json:"id" elastic:"index=not_analyzed"`
+}
+
+type structMappingTweet struct {
+	structMappingBase
+	User     string                 `json:"user" elastic:"type=string,index=not_analyzed"`
+	Message  string                 `json:"message,omitempty" elastic:"analyzer=english,store"`
+	Retweets int                    `json:"retweets"`
+	Rating   float32                `json:"rating"`
+	Public   bool                   `json:"public"`
+	Created  time.Time              `json:"created" elastic:"format=dateOptionalTime"`
+	Location *GeoPoint              `json:"location"`
+	Tags     []string               `json:"tags" elastic:"ignore_above=256"`
+	Image    []byte                 `json:"image"`
+	Author   structMappingComment   `json:"author"`
+	Comments []structMappingComment `json:"comments"`
+	Replies  []structMappingComment `json:"replies" elastic:"type=object"`
+	Extra    map[string]interface{} `json:"extra"`
+	Raw      json.RawMessage        `json:"raw"`
+	Ignored  string                 `json:"ignored" elastic:"-"`
+	Skipped  string                 `json:"-"`
+	internal string
+}
+
+func TestStructMapping(t *testing.T) {
+	src, err := NewStructMapping("tweet", &structMappingTweet{}).Dynamic("strict").Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(src)
+	if err != nil {
+		t.Fatalf("marshaling to JSON failed: %v", err)
+	}
+	got := string(data)
+	comment := `{"properties":{"comment":{"type":"string"},"created":{"type":"date"},"user":{"index":"not_analyzed","type":"string"}}`
+	expected := `{"tweet":{"dynamic":"strict","properties":{` +
+		`"author":` + comment + `},` +
+		`"comments":` + comment + `,"type":"nested"},` +
+		`"created":{"format":"dateOptionalTime","type":"date"},` +
+		`"id":{"index":"not_analyzed","type":"string"},` +
+		`"image":{"type":"binary"},` +
+		`"location":{"type":"geo_point"},` +
+		`"message":{"analyzer":"english","store":true,"type":"string"},` +
+		`"public":{"type":"boolean"},` +
+		`"rating":{"type":"float"},` +
+		`"replies":` + comment + `},` +
+		`"retweets":{"type":"long"},` +
+		`"tags":{"ignore_above":256,"type":"string"},` +
+		`"user":{"index":"not_analyzed","type":"string"}}}}`
+	if got != expected {
+		t.Errorf("expected\n%s\n,got:\n%s", expected, got)
+	}
+}
+
+func TestStructMappingErrors(t *testing.T) {
+	type recursive struct {
+		Children []recursive `json:"children"`
+	}
+	type unsupported struct {
+		Ch chan int `json:"ch"`
+	}
+	type invalidTag struct {
+		Name string `json:"name" elastic:"=string"`
+	}
+
+	tests := []struct {
+		Value    interface{}
+		Expected string
+	}{
+		// #0
+		{"tweet", "requires a struct"},
+		// #1
+		{recursive{}, "recursive type"},
+		// #2
+		{unsupported{}, "unsupported type"},
+		// #3
+		{invalidTag{}, "invalid tag"},
+	}
+	for i, test := range tests {
+		_, err := NewStructMapping("tweet", test.Value).Source()
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.Expected) {
+			t.Errorf("#%d: expected error containing %q; got %v", i, test.Expected, err)
+		}
+	}
+}
+
+func TestStructMappingCheck(t *testing.T) {
+	type comment struct {
+		User string `json:"user" elastic:"index=not_analyzed"`
+	}
+	type tweet struct {
+		User     string    `json:"user" elastic:"index=not_analyzed"`
+		Message  string    `json:"message" elastic:"index=analyzed"`
+		Retweets int       `json:"retweets"`
+		Likes    int       `json:"likes" elastic:"index=not_analyzed"`
+		Created  time.Time `json:"created" elastic:"index=not_analyzed"`
+		Comments []comment `json:"comments"`
+		Tags     []string  `json:"tags"`
+	}
+
+	// Output of GetMappingService
+	var mappings map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"twitter": {
+			"mappings": {
+				"tweet": {
+					"properties": {
+						"user": {"type": "string"},
+						"message": {"type": "string"},
+						"retweets": {"type": "string", "index": "not_analyzed"},
+						"likes": {"type": "long"},
+						"created": {"type": "date", "format": "dateOptionalTime"},
+						"comments": {"properties": {"user": {"type": "string", "index": "not_analyzed"}}}
+					}
+				}
+			}
+		},
+		"twitter2": {
+			"mappings": {}
+		}
+	}`), &mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := NewStructMapping("tweet", tweet{}).Check(mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Compatible() {
+		t.Errorf("expected Compatible() = %v; got %v", false, res.Compatible())
+	}
+	var conflicts []string
+	for _, c := range res.Conflicts {
+		conflicts = append(conflicts, c.String())
+	}
+	expectedConflicts := []string{
+		"twitter: field comments: type is <nil>, expected nested",
+		"twitter: field retweets: type is string, expected long",
+		"twitter: field user: index is <nil>, expected not_analyzed",
+	}
+	if got, want := strings.Join(conflicts, "\n"), strings.Join(expectedConflicts, "\n"); got != want {
+		t.Errorf("expected conflicts\n%s\n,got:\n%s", want, got)
+	}
+	expectedMissing := []string{
+		"twitter/tags",
+		"twitter2/comments",
+		"twitter2/created",
+		"twitter2/likes",
+		"twitter2/message",
+		"twitter2/retweets",
+		"twitter2/tags",
+		"twitter2/user",
+	}
+	if got, want := strings.Join(res.Missing, ","), strings.Join(expectedMissing, ","); got != want {
+		t.Errorf("expected missing fields %q; got %q", want, got)
+	}
+}